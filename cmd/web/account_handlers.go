@@ -0,0 +1,73 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/justinas/nosurf"
+)
+
+// the showAccount handles requests to display the account page
+func (app *application) showAccount(w http.ResponseWriter, r *http.Request) {
+	// Get the user ID from the session
+	id := app.session.GetInt(r, "user_id")
+	if id == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userID := int64(id)
+
+	data, err := app.newAccountData(r, userID)
+	if err != nil {
+		app.logger.Error("failed to load account page", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	data.Flash = app.session.PopString(r, "flash")
+	data.CalendarFeedURL = app.session.PopString(r, "calendar_feed_url")
+	data.NewAPIToken = app.session.PopString(r, "api_token")
+
+	err = app.render(w, http.StatusOK, "account.tmpl", data)
+	if err != nil {
+		app.logger.Error("failed to render account page", "template", "account.tmpl", "error", err, "url", r.URL.Path, "method", r.Method)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// newAccountData loads what the account page shows for the user
+func (app *application) newAccountData(r *http.Request, userID int64) (*TemplateData, error) {
+	user, err := app.users.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// A missing token just means the calendar feed is turned off
+	calendarToken, err := app.calendarTokens.Get(userID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	apiTokens, err := app.tokens.TokenList(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	twoFactor, err := app.twoFactor.Get(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	data := NewTemplateData()
+	data.Title = "Account"
+	data.HeaderText = "Account"
+	data.IsAuthenticated = app.isAuthenticated(r)
+	data.CSRFToken = nosurf.Token(r)
+	data.User = user
+	data.CalendarToken = calendarToken
+	data.APITokens = apiTokens
+	data.TwoFactor = twoFactor
+
+	return data, nil
+}
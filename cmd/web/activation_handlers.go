@@ -0,0 +1,114 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/abankelsey/study_helper/internal/validator"
+	"github.com/justinas/nosurf"
+)
+
+// the activateUser activates the account of the emailed link's token
+func (app *application) activateUser(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+
+	user, err := app.users.Activate(token)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			data := NewTemplateData()
+			data.Title = "Activate Account"
+			data.HeaderText = "Activate Account"
+			data.IsAuthenticated = app.isAuthenticated(r)
+			data.CSRFToken = nosurf.Token(r)
+			data.FormErrors = map[string]string{
+				"generic": "This activation link is invalid, has expired or was already used. Enter your email to get a new one.",
+			}
+
+			err := app.render(w, http.StatusBadRequest, "activate.tmpl", data)
+			if err != nil {
+				app.logger.Error("failed to render activation page", "template", "activate.tmpl", "error", err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			}
+			return
+		}
+		app.logger.Error("failed to activate user", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	app.logger.Info("user activated", "user_id", user.User_id)
+	app.session.Put(r, "flash", "Your account is activated, you can log in now")
+
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+// the showResendActivationForm handles requests to display the resend activation form
+func (app *application) showResendActivationForm(w http.ResponseWriter, r *http.Request) {
+	data := NewTemplateData()
+	data.Title = "Activate Account"
+	data.HeaderText = "Activate Account"
+	data.IsAuthenticated = app.isAuthenticated(r)
+	data.CSRFToken = nosurf.Token(r)
+
+	err := app.render(w, http.StatusOK, "activate.tmpl", data)
+	if err != nil {
+		app.logger.Error("failed to render activation page", "template", "activate.tmpl", "error", err, "url", r.URL.Path, "method", r.Method)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// the resendActivation emails a new activation link. The reply is the same whether
+// or not the email belongs to an inactive account.
+func (app *application) resendActivation(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.logger.Error("failed to parse form", "error", err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	email := r.PostForm.Get("email")
+
+	v := validator.NewValidator()
+	v.Check(validator.NotBlank(email), "email", "This field cannot be left blank")
+	v.Check(validator.IsValidEmail(email), "email", "Must be a valid email address")
+	if !v.ValidData() {
+		data := NewTemplateData()
+		data.Title = "Activate Account"
+		data.HeaderText = "Activate Account"
+		data.IsAuthenticated = app.isAuthenticated(r)
+		data.CSRFToken = nosurf.Token(r)
+		data.FormErrors = v.Errors
+		data.FormData = map[string]string{
+			"email": email,
+		}
+
+		err := app.render(w, http.StatusUnprocessableEntity, "activate.tmpl", data)
+		if err != nil {
+			app.logger.Error("failed to render activation page", "template", "activate.tmpl", "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	user, err := app.users.GetByEmail(email)
+	switch {
+	case err == nil && !user.Activated:
+		err = app.sendActivationEmail(user, r.Host)
+		if err != nil {
+			app.logger.Error("failed to create activation token", "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	case err != nil && !errors.Is(err, sql.ErrNoRows):
+		app.logger.Error("failed to fetch user", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	app.session.Put(r, "flash", "If "+email+" belongs to an account waiting for activation, a new link is on its way")
+
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
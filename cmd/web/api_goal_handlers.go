@@ -0,0 +1,205 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/abankelsey/study_helper/internal/data"
+	"github.com/abankelsey/study_helper/internal/validator"
+)
+
+// the apiListGoals returns a page of the user's goals, sorted, grouped and filtered by the query string
+func (app *application) apiListGoals(w http.ResponseWriter, r *http.Request) {
+	v := validator.NewValidator()
+	filters := readListFilters(r, data.GoalSortSafelist, data.GoalGroupSafelist, v)
+	if !v.ValidData() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	goals, metadata, err := app.goals.GoalPage(app.apiUserID(r), filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"goals": goals, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// the apiCreateGoal adds a new goal
+func (app *application) apiCreateGoal(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Goal_text    string `json:"goal_text"`
+		Target_date  string `json:"target_date"`
+		Is_completed bool   `json:"is_completed"`
+		Priority     string `json:"priority"`
+		Category     string `json:"category"`
+		Status       string `json:"status"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	goal := &data.Goals{
+		User_id:      app.apiUserID(r),
+		Goal_text:    input.Goal_text,
+		Is_completed: input.Is_completed,
+		Priority:     input.Priority,
+		Category:     input.Category,
+		Status:       input.Status,
+	}
+
+	v := validator.NewValidator()
+	goal.Target_date, err = parseAPIDate(input.Target_date)
+	v.Check(err == nil, "target_date", "You must provide a valid date (YYYY-MM-DD)")
+
+	data.ValidateGoals(v, goal)
+	if !v.ValidData() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.goals.Insert(goal)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/api/v1/goals/%d", goal.Goal_id))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"goal": goal}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// the apiShowGoal returns a single goal
+func (app *application) apiShowGoal(w http.ResponseWriter, r *http.Request) {
+	goal, ok := app.apiGoal(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"goal": goal}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// the apiUpdateGoal changes the fields sent in the request, leaving the others alone
+func (app *application) apiUpdateGoal(w http.ResponseWriter, r *http.Request) {
+	goal, ok := app.apiGoal(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Goal_text    *string `json:"goal_text"`
+		Target_date  *string `json:"target_date"`
+		Is_completed *bool   `json:"is_completed"`
+		Priority     *string `json:"priority"`
+		Category     *string `json:"category"`
+		Status       *string `json:"status"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.NewValidator()
+	if input.Goal_text != nil {
+		goal.Goal_text = *input.Goal_text
+	}
+	if input.Target_date != nil {
+		goal.Target_date, err = parseAPIDate(*input.Target_date)
+		v.Check(err == nil, "target_date", "You must provide a valid date (YYYY-MM-DD)")
+	}
+	if input.Is_completed != nil {
+		goal.SetCompleted(*input.Is_completed)
+	}
+	if input.Priority != nil {
+		goal.Priority = *input.Priority
+	}
+	if input.Category != nil {
+		goal.Category = *input.Category
+	}
+	// A status sent with is_completed wins
+	if input.Status != nil {
+		goal.Status = *input.Status
+	}
+
+	data.ValidateGoals(v, goal)
+	if !v.ValidData() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.goals.EditGoal(goal, app.apiUserID(r))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			app.notFoundResponse(w, r)
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"goal": goal}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// the apiDeleteGoal removes a goal
+func (app *application) apiDeleteGoal(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.goals.DeleteGoal(id, app.apiUserID(r))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			app.notFoundResponse(w, r)
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// apiGoal loads the goal named in the URL. Other users' goals are reported as missing
+// rather than forbidden.
+func (app *application) apiGoal(w http.ResponseWriter, r *http.Request) (*data.Goals, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	goal, err := app.goals.GetGoalByID(id, app.apiUserID(r))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			app.notFoundResponse(w, r)
+			return nil, false
+		}
+		app.serverErrorResponse(w, r, err)
+		return nil, false
+	}
+
+	return goal, true
+}
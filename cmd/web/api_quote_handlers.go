@@ -0,0 +1,171 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/abankelsey/study_helper/internal/data"
+	"github.com/abankelsey/study_helper/internal/validator"
+)
+
+// the apiListQuotes returns a page of the user's quotes, sorted and filtered by the query string
+func (app *application) apiListQuotes(w http.ResponseWriter, r *http.Request) {
+	v := validator.NewValidator()
+	filters := readListFilters(r, data.QuoteSortSafelist, nil, v)
+	if !v.ValidData() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	quotes, metadata, err := app.quotes.QuotePage(app.apiUserID(r), filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"quotes": quotes, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// the apiCreateQuote adds a new quote
+func (app *application) apiCreateQuote(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Content string `json:"content"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	quote := &data.Quotes{
+		User_id: app.apiUserID(r),
+		Content: input.Content,
+	}
+
+	v := validator.NewValidator()
+	data.ValidateQuotes(v, quote)
+	if !v.ValidData() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.quotes.Insert(quote)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/api/v1/quotes/%d", quote.Quote_id))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"quote": quote}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// the apiShowQuote returns a single quote
+func (app *application) apiShowQuote(w http.ResponseWriter, r *http.Request) {
+	quote, ok := app.apiQuote(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"quote": quote}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// the apiUpdateQuote changes the content of a quote
+func (app *application) apiUpdateQuote(w http.ResponseWriter, r *http.Request) {
+	quote, ok := app.apiQuote(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Content *string `json:"content"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Content != nil {
+		quote.Content = *input.Content
+	}
+
+	v := validator.NewValidator()
+	data.ValidateQuotes(v, quote)
+	if !v.ValidData() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.quotes.EditQuote(quote, app.apiUserID(r))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			app.notFoundResponse(w, r)
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"quote": quote}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// the apiDeleteQuote removes a quote
+func (app *application) apiDeleteQuote(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.quotes.DeleteQuote(id, app.apiUserID(r))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			app.notFoundResponse(w, r)
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// apiQuote loads the quote named in the URL. Other users' quotes are reported as missing
+// rather than forbidden.
+func (app *application) apiQuote(w http.ResponseWriter, r *http.Request) (*data.Quotes, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	quote, err := app.quotes.GetQuoteByID(id, app.apiUserID(r))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			app.notFoundResponse(w, r)
+			return nil, false
+		}
+		app.serverErrorResponse(w, r, err)
+		return nil, false
+	}
+
+	return quote, true
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/abankelsey/study_helper/internal/data"
+	"github.com/abankelsey/study_helper/internal/validator"
+)
+
+// the apiListSessions returns the user's sessions. Recurring sessions are returned once
+// with their rrule, or as individual occurrences with ?expand=true. The list is sorted,
+// filtered and paged by the query string.
+func (app *application) apiListSessions(w http.ResponseWriter, r *http.Request) {
+	v := validator.NewValidator()
+	filters := readListFilters(r, data.SessionSortSafelist, nil, v)
+	if !v.ValidData() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	expand := r.URL.Query().Get("expand") == "true"
+	sessions, metadata, err := app.sessions.SessionPage(app.apiUserID(r), filters, expand)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"sessions": sessions, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// the apiCreateSession adds a new study session
+func (app *application) apiCreateSession(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Title       string `json:"title"`
+		Description string `json:"description"`
+		Subject     string `json:"subject"`
+		Start_date  string `json:"start_date"`
+		End_date    string `json:"end_date"`
+		Rrule       string `json:"rrule"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	session := &data.Sessions{
+		User_id:     app.apiUserID(r),
+		Title:       input.Title,
+		Description: input.Description,
+		Subject:     input.Subject,
+		Rrule:       input.Rrule,
+	}
+
+	v := validator.NewValidator()
+	session.Start_date, err = parseAPIDate(input.Start_date)
+	v.Check(err == nil, "start_date", "Start date must be a valid date (YYYY-MM-DD)")
+	session.End_date, err = parseAPIDate(input.End_date)
+	v.Check(err == nil, "end_date", "End date must be a valid date (YYYY-MM-DD)")
+
+	data.ValidateSessions(v, session)
+	if !v.ValidData() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.sessions.Insert(session)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/api/v1/sessions/%d", session.Session_id))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"session": session}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// the apiShowSession returns a single study session
+func (app *application) apiShowSession(w http.ResponseWriter, r *http.Request) {
+	session, ok := app.apiSession(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"session": session}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// the apiUpdateSession changes the fields sent in the request, leaving the others alone.
+// For recurring sessions the whole series is changed.
+func (app *application) apiUpdateSession(w http.ResponseWriter, r *http.Request) {
+	session, ok := app.apiSession(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Title       *string `json:"title"`
+		Description *string `json:"description"`
+		Subject     *string `json:"subject"`
+		Start_date  *string `json:"start_date"`
+		End_date    *string `json:"end_date"`
+		Rrule       *string `json:"rrule"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.NewValidator()
+	if input.Title != nil {
+		session.Title = *input.Title
+	}
+	if input.Description != nil {
+		session.Description = *input.Description
+	}
+	if input.Subject != nil {
+		session.Subject = *input.Subject
+	}
+	if input.Start_date != nil {
+		session.Start_date, err = parseAPIDate(*input.Start_date)
+		v.Check(err == nil, "start_date", "Start date must be a valid date (YYYY-MM-DD)")
+	}
+	if input.End_date != nil {
+		session.End_date, err = parseAPIDate(*input.End_date)
+		v.Check(err == nil, "end_date", "End date must be a valid date (YYYY-MM-DD)")
+	}
+	if input.Rrule != nil {
+		session.Rrule = *input.Rrule
+	}
+
+	data.ValidateSessions(v, session)
+	if !v.ValidData() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.sessions.EditSession(session, app.apiUserID(r))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			app.notFoundResponse(w, r)
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"session": session}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// the apiDeleteSession removes a study session, with all its occurrences if it repeats
+func (app *application) apiDeleteSession(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.sessions.DeleteSession(id, app.apiUserID(r))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			app.notFoundResponse(w, r)
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// apiSession loads the session named in the URL. Other users' sessions are reported as missing
+// rather than forbidden.
+func (app *application) apiSession(w http.ResponseWriter, r *http.Request) (*data.Sessions, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	session, err := app.sessions.GetSessionByID(id, app.apiUserID(r))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			app.notFoundResponse(w, r)
+			return nil, false
+		}
+		app.serverErrorResponse(w, r, err)
+		return nil, false
+	}
+
+	return session, true
+}
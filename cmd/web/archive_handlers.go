@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/abankelsey/study_helper/internal/data"
+	"github.com/abankelsey/study_helper/internal/validator"
+	"github.com/justinas/nosurf"
+)
+
+// maxArchiveSize limits the size of uploaded archives
+const maxArchiveSize = 10 << 20
+
+// the exportArchive downloads everything the logged in user saved as a JSON archive
+func (app *application) exportArchive(w http.ResponseWriter, r *http.Request) {
+	// Get the user ID from the session
+	id := app.session.GetInt(r, "user_id")
+	if id == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	archive, err := app.archives.Export(int64(id))
+	if err != nil {
+		app.logger.Error("failed to export archive", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	filename := fmt.Sprintf("study-helper-%s.json", archive.Exported_at.Format("2006-01-02"))
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+	// Encoding straight to the response avoids holding a second copy in memory
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	err = enc.Encode(archive)
+	if err != nil {
+		app.logger.Error("failed to write archive", "error", err)
+	}
+}
+
+// renderArchiveImport shows the archive upload form, with message as the upload error when set
+func (app *application) renderArchiveImport(w http.ResponseWriter, r *http.Request, status int, message string) {
+	data := NewTemplateData()
+	data.Title = "Restore Archive"
+	data.HeaderText = "Restore Archive"
+	data.IsAuthenticated = app.isAuthenticated(r)
+	data.CSRFToken = nosurf.Token(r)
+	data.Flash = app.session.PopString(r, "flash")
+	if message != "" {
+		data.FormErrors["archive"] = message
+	}
+
+	err := app.render(w, status, "archive_import.tmpl", data)
+	if err != nil {
+		app.logger.Error("failed to render archive import page", "template", "archive_import.tmpl", "error", err, "url", r.URL.Path, "method", r.Method)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// the showArchiveImportForm handles requests to display the archive upload form
+func (app *application) showArchiveImportForm(w http.ResponseWriter, r *http.Request) {
+	app.renderArchiveImport(w, r, http.StatusOK, "")
+}
+
+// the importArchive restores an uploaded archive into the logged in user's account
+func (app *application) importArchive(w http.ResponseWriter, r *http.Request) {
+	// Get the user ID from the session
+	id := app.session.GetInt(r, "user_id")
+	if id == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userID := int64(id)
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxArchiveSize+4096)
+	err := r.ParseMultipartForm(maxArchiveSize)
+	if err != nil {
+		app.logger.Error("failed to parse upload", "error", err)
+		http.Error(w, "The file is too large or the upload was invalid", http.StatusBadRequest)
+		return
+	}
+
+	file, _, err := r.FormFile("archive")
+	if err != nil {
+		app.renderArchiveImport(w, r, http.StatusUnprocessableEntity, "Choose an archive file to upload")
+		return
+	}
+	defer file.Close()
+
+	var archive data.Archive
+	err = json.NewDecoder(file).Decode(&archive)
+	if err != nil {
+		app.renderArchiveImport(w, r, http.StatusUnprocessableEntity, "The file is not a valid JSON archive")
+		return
+	}
+
+	v := validator.NewValidator()
+	data.ValidateArchive(v, &archive)
+	if !v.ValidData() {
+		app.renderArchiveImport(w, r, http.StatusUnprocessableEntity, v.Errors["archive"])
+		return
+	}
+
+	err = app.archives.Import(userID, &archive)
+	if err != nil {
+		if errors.Is(err, data.ErrAccountNotEmpty) {
+			app.renderArchiveImport(w, r, http.StatusConflict, "Archives can only be restored into an account without any goals, sessions or quotes")
+			return
+		}
+		app.logger.Error("failed to import archive", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	app.logger.Info("archive imported", "user_id", userID, "exported_at", archive.Exported_at.Format(time.RFC3339),
+		"goals", len(archive.Goals), "sessions", len(archive.Sessions), "quotes", len(archive.Quotes))
+	app.session.Put(r, "flash", fmt.Sprintf("Restored %d goals, %d sessions and %d quotes", len(archive.Goals), len(archive.Sessions), len(archive.Quotes)))
+
+	http.Redirect(w, r, "/account", http.StatusSeeOther)
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/abankelsey/study_helper/internal/data"
+	"github.com/abankelsey/study_helper/internal/ical"
+)
+
+// buildCalendar serializes the user's study sessions as VEVENTs and daily goals as VTODOs
+func (app *application) buildCalendar(userID int64) (*ical.Calendar, error) {
+	sessions, err := app.sessions.SeriesList(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	exceptions, err := app.sessions.Exceptions(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	goals, err := app.goals.GoalList(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	cal := ical.NewCalendar("-//Study Helper//Study Helper//EN", "Study Helper")
+
+	for _, s := range sessions {
+		event := ical.NewComponent("VEVENT")
+		event.Add("UID", sessionUID(s))
+		event.AddDateTime("DTSTAMP", now)
+		event.AddDateTime("CREATED", s.Created_at)
+		event.AddText("SUMMARY", sessionSummary(s.Title, s.Is_completed))
+		event.AddText("DESCRIPTION", s.Description)
+		event.AddText("CATEGORIES", s.Subject)
+		event.AddDate("DTSTART", s.Start_date)
+		// DTEND is exclusive for all-day events
+		event.AddDate("DTEND", s.End_date.AddDate(0, 0, 1))
+		if s.Rrule != "" {
+			event.Add("RRULE", s.Rrule)
+		}
+		cal.AddComponent(event)
+
+		// Cancelled occurrences become EXDATEs, edited and timed ones get their own VEVENT
+		for date, e := range exceptions[s.Session_id] {
+			if !s.IsOccurrence(date) {
+				continue
+			}
+			if e.Is_cancelled {
+				event.AddDate("EXDATE", date)
+				continue
+			}
+
+			o := *s
+			o.Start_date = date
+			o.End_date = date.Add(s.End_date.Sub(s.Start_date))
+			e.Apply(&o)
+
+			override := ical.NewComponent("VEVENT")
+			override.Add("UID", sessionUID(s))
+			override.AddDate("RECURRENCE-ID", date)
+			override.AddDateTime("DTSTAMP", now)
+			override.AddText("SUMMARY", sessionSummary(o.Title, o.Is_completed))
+			override.AddText("DESCRIPTION", o.Description)
+			override.AddText("CATEGORIES", o.Subject)
+			override.AddDate("DTSTART", o.Start_date)
+			override.AddDate("DTEND", o.End_date.AddDate(0, 0, 1))
+			cal.AddComponent(override)
+		}
+	}
+
+	for _, g := range goals {
+		todo := ical.NewComponent("VTODO")
+		todo.Add("UID", goalUID(g))
+		todo.AddDateTime("DTSTAMP", now)
+		todo.AddDateTime("CREATED", g.Created_at)
+		todo.AddText("SUMMARY", g.Goal_text)
+		todo.AddDate("DUE", g.Target_date)
+		if g.Is_completed {
+			todo.Add("STATUS", "COMPLETED")
+			todo.Add("PERCENT-COMPLETE", "100")
+		} else {
+			todo.Add("STATUS", "NEEDS-ACTION")
+		}
+		cal.AddComponent(todo)
+	}
+
+	return cal, nil
+}
+
+// sessionUID keeps the UID of imported sessions so calendar clients see the same event
+func sessionUID(s *data.Sessions) string {
+	if s.Ical_uid != "" {
+		return s.Ical_uid
+	}
+	return fmt.Sprintf("session-%d@study-helper", s.Session_id)
+}
+
+// goalUID keeps the UID of imported goals so calendar clients see the same todo
+func goalUID(g *data.Goals) string {
+	if g.Ical_uid != "" {
+		return g.Ical_uid
+	}
+	return fmt.Sprintf("goal-%d@study-helper", g.Goal_id)
+}
+
+// sessionSummary marks completed sessions in the title, since VEVENT has no completed status
+func sessionSummary(title string, completed bool) string {
+	if completed {
+		return "✔ " + title
+	}
+	return title
+}
+
+// writeCalendar sends the calendar of a user as a text/calendar response
+func (app *application) writeCalendar(w http.ResponseWriter, userID int64, attachment bool) {
+	cal, err := app.buildCalendar(userID)
+	if err != nil {
+		app.logger.Error("failed to build calendar", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	if attachment {
+		w.Header().Set("Content-Disposition", `attachment; filename="study-helper.ics"`)
+	}
+
+	_, err = cal.WriteTo(w)
+	if err != nil {
+		app.logger.Error("failed to write calendar", "error", err)
+	}
+}
+
+// the exportCalendar downloads the logged in user's sessions and goals as an .ics file
+func (app *application) exportCalendar(w http.ResponseWriter, r *http.Request) {
+	// Get the user ID from the session
+	id := app.session.GetInt(r, "user_id")
+	if id == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	app.writeCalendar(w, int64(id), true)
+}
+
+// the calendarFeed serves the private subscription feed identified by a secret token
+func (app *application) calendarFeed(w http.ResponseWriter, r *http.Request) {
+	userID, err := app.calendarTokens.GetUserID(r.PathValue("token"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.NotFound(w, r)
+			return
+		}
+		app.logger.Error("failed to look up calendar token", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	app.writeCalendar(w, userID, false)
+}
+
+// the regenerateCalendarToken creates a new feed URL, invalidating the old one
+func (app *application) regenerateCalendarToken(w http.ResponseWriter, r *http.Request) {
+	// Get the user ID from the session
+	id := app.session.GetInt(r, "user_id")
+	if id == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	token, err := app.calendarTokens.New(int64(id))
+	if err != nil {
+		app.logger.Error("failed to create calendar token", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// The token is only stored hashed, so the URL can only be shown this once
+	app.session.Put(r, "calendar_feed_url", fmt.Sprintf("https://%s/feeds/%s/calendar.ics", r.Host, token))
+	app.session.Put(r, "flash", "New calendar feed created, copy the link now as it will not be shown again")
+
+	http.Redirect(w, r, "/account", http.StatusSeeOther)
+}
+
+// the revokeCalendarToken turns off the private calendar feed
+func (app *application) revokeCalendarToken(w http.ResponseWriter, r *http.Request) {
+	// Get the user ID from the session
+	id := app.session.GetInt(r, "user_id")
+	if id == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	err := app.calendarTokens.Revoke(int64(id))
+	if err != nil {
+		app.logger.Error("failed to revoke calendar token", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	app.session.Put(r, "flash", "Calendar feed revoked")
+
+	http.Redirect(w, r, "/account", http.StatusSeeOther)
+}
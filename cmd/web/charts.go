@@ -0,0 +1,283 @@
+package main
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/abankelsey/study_helper/internal/data"
+)
+
+// chart sizes, in SVG user units. The charts scale to the page width.
+const (
+	chartWidth  = 640
+	chartHeight = 220
+	chartLeft   = 40 // room for the value labels
+	chartBottom = 24 // room for the date labels
+	chartTop    = 10
+	maxLabels   = 8
+	donutSize   = 220
+)
+
+// StatsCharts holds the charts of the statistics page
+type StatsCharts struct {
+	DailyHours  *BarChart
+	WeeklyHours *BarChart
+	Subjects    *DonutChart
+	Goals       *LineChart
+	Sessions    *LineChart
+}
+
+// BarChart is a bar chart laid out for an SVG
+type BarChart struct {
+	Width, Height int
+	Bars          []ChartBar
+	Ticks         []ChartTick
+	Labels        []ChartLabel
+}
+
+// ChartBar is one bar, with Title shown when hovering over it
+type ChartBar struct {
+	X, Y, W, H float64
+	Title      string
+}
+
+// ChartTick is a horizontal grid line across the plot, with its value written left of it
+type ChartTick struct {
+	Y, X1, X2 float64
+	LabelX    float64
+	Label     string
+}
+
+// ChartLabel is a label under the x axis
+type ChartLabel struct {
+	X, Y float64
+	Text string
+}
+
+// LineChart is a line chart of percentages laid out for an SVG
+type LineChart struct {
+	Width, Height int
+	Points        string // the points of the polyline
+	Dots          []ChartDot
+	Ticks         []ChartTick
+	Labels        []ChartLabel
+}
+
+// ChartDot marks one point of a line chart
+type ChartDot struct {
+	X, Y  float64
+	Title string
+}
+
+// DonutChart is a donut chart laid out for an SVG
+type DonutChart struct {
+	Size   int
+	Slices []ChartSlice
+}
+
+// ChartSlice is one slice of a donut chart
+type ChartSlice struct {
+	Path    string
+	Colour  string
+	Name    string
+	Hours   float64
+	Percent float64
+}
+
+// newStatsCharts lays out the charts of the statistics
+func newStatsCharts(stats *data.Stats) *StatsCharts {
+	return &StatsCharts{
+		DailyHours:  hoursBarChart(stats.Daily, "Jan 2", "Mon Jan 2"),
+		WeeklyHours: hoursBarChart(stats.Weekly, "Jan 2", "week of Jan 2"),
+		Subjects:    subjectDonut(stats.Subjects),
+		Goals:       completionLineChart(stats.Goals, "goals"),
+		Sessions:    completionLineChart(stats.Sessions, "sessions"),
+	}
+}
+
+// round keeps one decimal place, which is plenty for SVG coordinates
+func round(f float64) float64 {
+	return math.Round(f*10) / 10
+}
+
+// niceScale picks the top of a value axis and the step between its grid lines, so that
+// max fits under about four steps of 1, 2 or 5 times a power of ten
+func niceScale(max float64) (float64, float64) {
+	if max <= 0 {
+		return 1, 0.25
+	}
+	raw := max / 4
+	magnitude := math.Pow(10, math.Floor(math.Log10(raw)))
+	step := magnitude * 10
+	for _, m := range []float64{1, 2, 5} {
+		if m*magnitude >= raw {
+			step = m * magnitude
+			break
+		}
+	}
+	return tidy(math.Ceil(max/step) * step), step
+}
+
+// tidy drops the floating point noise left by adding up steps like 0.1
+func tidy(f float64) float64 {
+	return math.Round(f*1e6) / 1e6
+}
+
+// plotWidth and plotHeight are the size of the area inside the axes
+func plotWidth() float64  { return chartWidth - chartLeft }
+func plotHeight() float64 { return chartHeight - chartTop - chartBottom }
+
+// yTicks lays out the grid lines of a value axis going up to top
+func yTicks(top, step float64, format string) []ChartTick {
+	ticks := []ChartTick{}
+	for i := 0; float64(i)*step <= top+step/2; i++ {
+		v := tidy(float64(i) * step)
+		ticks = append(ticks, ChartTick{
+			Y:      round(chartTop + plotHeight() - v/top*plotHeight()),
+			X1:     chartLeft,
+			X2:     chartWidth,
+			LabelX: chartLeft - 6,
+			Label:  fmt.Sprintf(format, v),
+		})
+	}
+	return ticks
+}
+
+// xLabel places a date label under the x axis at x
+func xLabel(x float64, text string) ChartLabel {
+	return ChartLabel{X: x, Y: chartHeight - 6, Text: text}
+}
+
+// labelEvery returns how many points to skip between date labels so they do not overlap
+func labelEvery(n int) int {
+	return max(1, (n+maxLabels-1)/maxLabels)
+}
+
+// hoursBarChart lays out a bar per day or week
+func hoursBarChart(periods []*data.PeriodHours, labelFormat, titleFormat string) *BarChart {
+	chart := &BarChart{Width: chartWidth, Height: chartHeight, Bars: []ChartBar{}, Labels: []ChartLabel{}}
+
+	most := 0.0
+	for _, p := range periods {
+		most = max(most, p.Hours)
+	}
+	top, step := niceScale(most)
+	chart.Ticks = yTicks(top, step, "%gh")
+
+	if len(periods) == 0 {
+		return chart
+	}
+
+	slot := plotWidth() / float64(len(periods))
+	gap := min(slot*0.2, 4)
+	every := labelEvery(len(periods))
+
+	for i, p := range periods {
+		h := p.Hours / top * plotHeight()
+		x := chartLeft + float64(i)*slot
+		chart.Bars = append(chart.Bars, ChartBar{
+			X:     round(x + gap/2),
+			Y:     round(chartTop + plotHeight() - h),
+			W:     round(slot - gap),
+			H:     round(h),
+			Title: fmt.Sprintf("%s: %.1f hours", p.Start.Format(titleFormat), p.Hours),
+		})
+		if i%every == 0 {
+			chart.Labels = append(chart.Labels, xLabel(round(x+slot/2), p.Start.Format(labelFormat)))
+		}
+	}
+
+	return chart
+}
+
+// completionLineChart lays out the weekly completion percentage. Weeks without any
+// entries have no rate, so they are left out of the line.
+func completionLineChart(rates []*data.CompletionRate, noun string) *LineChart {
+	chart := &LineChart{Width: chartWidth, Height: chartHeight, Dots: []ChartDot{}, Labels: []ChartLabel{}}
+	chart.Ticks = yTicks(100, 25, "%g%%")
+
+	if len(rates) == 0 {
+		return chart
+	}
+
+	slot := plotWidth() / float64(len(rates))
+	every := labelEvery(len(rates))
+
+	for i, r := range rates {
+		x := round(chartLeft + float64(i)*slot + slot/2)
+		if i%every == 0 {
+			chart.Labels = append(chart.Labels, xLabel(x, r.Start.Format("Jan 2")))
+		}
+		if r.Total == 0 {
+			continue
+		}
+
+		y := round(chartTop + plotHeight() - r.Percent()/100*plotHeight())
+		chart.Dots = append(chart.Dots, ChartDot{
+			X:     x,
+			Y:     y,
+			Title: fmt.Sprintf("week of %s: %d of %d %s completed", r.Start.Format("Jan 2"), r.Completed, r.Total, noun),
+		})
+		chart.Points += fmt.Sprintf("%g,%g ", x, y)
+	}
+
+	return chart
+}
+
+// subjectDonut lays out a slice per subject, sized by the hours studied
+func subjectDonut(subjects []*data.SubjectHours) *DonutChart {
+	chart := &DonutChart{Size: donutSize, Slices: []ChartSlice{}}
+
+	total := 0.0
+	for _, s := range subjects {
+		total += s.Hours
+	}
+	if total <= 0 {
+		return chart
+	}
+
+	centre := float64(donutSize) / 2
+	outer := centre - 2
+	inner := outer * 0.6
+
+	// Slices go clockwise from the top
+	point := func(r, angle float64) string {
+		return fmt.Sprintf("%g %g", round(centre+r*math.Sin(angle)), round(centre-r*math.Cos(angle)))
+	}
+
+	// arc continues a path along the circle of radius r to the angle
+	arc := func(r, to float64, large, clockwise int) string {
+		return fmt.Sprintf(" A %g %g 0 %d %d %s", round(r), round(r), large, clockwise, point(r, to))
+	}
+
+	angle := 0.0
+	for _, s := range subjects {
+		share := s.Hours / total
+		end := angle + share*2*math.Pi
+
+		var path string
+		if share > 0.999 {
+			// An arc can not end where it starts, so a whole ring is drawn as two halves
+			path = "M " + point(outer, 0) + arc(outer, math.Pi, 0, 1) + arc(outer, 0, 0, 1) +
+				" M " + point(inner, 0) + arc(inner, math.Pi, 0, 0) + arc(inner, 0, 0, 0) + " Z"
+		} else {
+			large := 0
+			if share > 0.5 {
+				large = 1
+			}
+			path = "M " + point(outer, angle) + arc(outer, end, large, 1) +
+				" L " + point(inner, end) + arc(inner, angle, large, 0) + " Z"
+		}
+
+		chart.Slices = append(chart.Slices, ChartSlice{
+			Path:    path,
+			Colour:  s.Colour,
+			Name:    s.Name,
+			Hours:   s.Hours,
+			Percent: share * 100,
+		})
+		angle = end
+	}
+
+	return chart
+}
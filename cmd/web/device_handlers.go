@@ -0,0 +1,107 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/justinas/nosurf"
+)
+
+// the showDevices lists the browsers the user is logged in on
+func (app *application) showDevices(w http.ResponseWriter, r *http.Request) {
+	// Get the user ID from the session
+	id := app.session.GetInt(r, "user_id")
+	if id == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	userSessions, err := app.userSessions.SessionList(int64(id))
+	if err != nil {
+		app.logger.Error("failed to fetch sessions", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	data := NewTemplateData()
+	data.Title = "Active Devices"
+	data.HeaderText = "Active Devices"
+	data.IsAuthenticated = app.isAuthenticated(r)
+	data.CSRFToken = nosurf.Token(r)
+	data.Flash = app.session.PopString(r, "flash")
+	data.UserSessions = userSessions
+	if current := userSessionFromContext(r); current != nil {
+		data.CurrentSessionID = current.Session_id
+	}
+
+	err = app.render(w, http.StatusOK, "devices.tmpl", data)
+	if err != nil {
+		app.logger.Error("failed to render devices page", "template", "devices.tmpl", "error", err, "url", r.URL.Path, "method", r.Method)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// the revokeDevice signs out one of the user's sessions. Signing out this device
+// also logs the user out here.
+func (app *application) revokeDevice(w http.ResponseWriter, r *http.Request) {
+	// Get the user ID from the session
+	id := app.session.GetInt(r, "user_id")
+	if id == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	sessionID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || sessionID < 1 {
+		http.NotFound(w, r)
+		return
+	}
+
+	err = app.userSessions.Revoke(sessionID, int64(id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.NotFound(w, r)
+			return
+		}
+		app.logger.Error("failed to revoke session", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	app.logger.Info("session revoked", "user_id", id, "session_id", sessionID)
+
+	if current := userSessionFromContext(r); current != nil && current.Session_id == sessionID {
+		app.session.Destroy(r)
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	app.session.Put(r, "flash", "Device signed out")
+
+	http.Redirect(w, r, "/account/devices", http.StatusSeeOther)
+}
+
+// the revokeAllDevices signs out every session of the user, including this one
+func (app *application) revokeAllDevices(w http.ResponseWriter, r *http.Request) {
+	// Get the user ID from the session
+	id := app.session.GetInt(r, "user_id")
+	if id == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	err := app.userSessions.RevokeAll(int64(id))
+	if err != nil {
+		app.logger.Error("failed to revoke sessions", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	app.logger.Info("all sessions revoked", "user_id", id)
+	app.session.Destroy(r)
+
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"slices"
+
+	"github.com/abankelsey/study_helper/internal/data"
+	"github.com/justinas/nosurf"
+)
+
+// GoalGroup is a run of goals sharing a priority, category or status, or a column of the board
+type GoalGroup struct {
+	Key   string
+	Label string
+	Goals []*data.Goals
+}
+
+// how the priorities and statuses of goals are written on the page
+var (
+	goalPriorityLabels = map[string]string{
+		data.PriorityLow:    "Low",
+		data.PriorityMedium: "Medium",
+		data.PriorityHigh:   "High",
+		data.PriorityUrgent: "Urgent",
+	}
+	goalStatusLabels = map[string]string{
+		data.GoalTodo:       "To do",
+		data.GoalInProgress: "In progress",
+		data.GoalDone:       "Done",
+		data.GoalMissed:     "Missed",
+	}
+)
+
+// goalCategories returns the logged in user's goal categories for the goal forms. The
+// suggestions are optional, so a failure only leaves them out.
+func (app *application) goalCategories(r *http.Request) []string {
+	categories, err := app.goals.Categories(int64(app.session.GetInt(r, "user_id")))
+	if err != nil {
+		app.logger.Error("failed to fetch goal categories", "error", err)
+		return nil
+	}
+	return categories
+}
+
+// goalGroupKey is the value of the field the goal is grouped by, and how it is labelled
+func goalGroupKey(g *data.Goals, by string) (string, string) {
+	switch by {
+	case "priority":
+		return g.Priority, goalPriorityLabels[g.Priority]
+	case "status":
+		return g.Status, goalStatusLabels[g.Status]
+	default:
+		if g.Category == "" {
+			return "", "No category"
+		}
+		return g.Category, g.Category
+	}
+}
+
+// groupGoals splits a list of goals that is already in group order into its groups.
+// When by is empty the goals are kept together in one group without a label.
+func groupGoals(goals []*data.Goals, by string) []*GoalGroup {
+	groups := []*GoalGroup{}
+	if by == "" {
+		if len(goals) > 0 {
+			groups = append(groups, &GoalGroup{Goals: goals})
+		}
+		return groups
+	}
+
+	for _, g := range goals {
+		key, label := goalGroupKey(g, by)
+		if len(groups) == 0 || groups[len(groups)-1].Key != key {
+			groups = append(groups, &GoalGroup{Key: key, Label: label})
+		}
+		last := groups[len(groups)-1]
+		last.Goals = append(last.Goals, g)
+	}
+
+	return groups
+}
+
+// the showGoalBoard displays the user's goals as cards in a column for each status
+func (app *application) showGoalBoard(w http.ResponseWriter, r *http.Request) {
+	// Get the user ID from the session
+	id := app.session.GetInt(r, "user_id")
+	if id == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	goals, err := app.goals.GoalBoard(int64(id))
+	if err != nil {
+		app.logger.Error("failed to fetch goal board", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	columns := []*GoalGroup{}
+	for _, status := range data.GoalStatuses {
+		column := &GoalGroup{Key: status, Label: goalStatusLabels[status], Goals: []*data.Goals{}}
+		for _, g := range goals {
+			if g.Status == status {
+				column.Goals = append(column.Goals, g)
+			}
+		}
+		columns = append(columns, column)
+	}
+
+	data := NewTemplateData()
+	data.Title = "Goal Board"
+	data.HeaderText = "Goal Board"
+	data.IsAuthenticated = app.isAuthenticated(r)
+	data.CSRFToken = nosurf.Token(r)
+	data.GoalGroups = columns
+	data.Flash = app.session.PopString(r, "flash")
+
+	err = app.render(w, http.StatusOK, "goal_board.tmpl", data)
+	if err != nil {
+		app.logger.Error("failed to render goal board", "template", "goal_board.tmpl", "error", err, "url", r.URL.Path, "method", r.Method)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// the moveGoal moves a card of the board to another column, changing the goal's status
+func (app *application) moveGoal(w http.ResponseWriter, r *http.Request) {
+	// Get the user ID from the session
+	id := app.session.GetInt(r, "user_id")
+	if id == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	goalID, _, err := readGoalItemIDs(r)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		app.logger.Error("failed to parse form", "error", err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	status := r.PostForm.Get("status")
+	if !slices.Contains(data.GoalStatuses, status) {
+		app.logger.Error("invalid goal status", "value", status)
+		http.Error(w, "Invalid status", http.StatusBadRequest)
+		return
+	}
+
+	err = app.goals.SetStatus(goalID, int64(id), status)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.NotFound(w, r)
+			return
+		}
+		app.logger.Error("failed to move goal", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/goals/board", http.StatusSeeOther)
+}
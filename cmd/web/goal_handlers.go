@@ -1,11 +1,13 @@
 package main
 
 import (
+	"database/sql"
+	"errors"
 	"fmt"
 	"net/http"
-	"time"
-
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/abankelsey/study_helper/internal/data"
 	"github.com/abankelsey/study_helper/internal/validator"
@@ -20,6 +22,7 @@ func (app *application) showDailyGoalsForm(w http.ResponseWriter, r *http.Reques
 	data.HeaderText = "Daily Goals"
 	data.IsAuthenticated = app.isAuthenticated(r)
 	data.CSRFToken = nosurf.Token(r)
+	data.GoalCategories = app.goalCategories(r)
 
 	// Render the daily goals form template
 	err := app.render(w, http.StatusOK, "daily_goals.tmpl", data)
@@ -42,17 +45,11 @@ func (app *application) addGoals(w http.ResponseWriter, r *http.Request) {
 
 	// Extract form values
 	goal_text := r.PostForm.Get("goal_text")
-	is_completed_str := r.PostForm.Get("is_completed")
+	status := r.PostForm.Get("status")
+	priority := r.PostForm.Get("priority")
+	category := strings.TrimSpace(r.PostForm.Get("category"))
 	target_date_str := r.PostForm.Get("target_date")
 
-	// Convert the is_completed value from string to bool
-	is_completed, err := strconv.ParseBool(is_completed_str)
-	if err != nil {
-		app.logger.Error("invalid value for is_completed", "value", is_completed_str)
-		http.Error(w, "Invalid value for completion status", http.StatusBadRequest)
-		return
-	}
-
 	// Convert target_date string to time.Time
 	target_date, err := time.Parse("2006-01-02", target_date_str)
 	if err != nil {
@@ -71,10 +68,12 @@ func (app *application) addGoals(w http.ResponseWriter, r *http.Request) {
 
 	// Create a goals object with the submitted data
 	goals := &data.Goals{
-		Goal_text:    goal_text,
-		Is_completed: is_completed,
-		Target_date:  target_date,
-		User_id:      userID,
+		Goal_text:   goal_text,
+		Status:      status,
+		Priority:    priority,
+		Category:    category,
+		Target_date: target_date,
+		User_id:     userID,
 	}
 
 	// Validate the submitted goals data
@@ -88,11 +87,14 @@ func (app *application) addGoals(w http.ResponseWriter, r *http.Request) {
 		data.HeaderText = "Daily Goals"
 		data.IsAuthenticated = app.isAuthenticated(r)
 		data.CSRFToken = nosurf.Token(r)
+		data.GoalCategories = app.goalCategories(r)
 		data.FormErrors = v.Errors         // Store validation errors
 		data.FormData = map[string]string{ // Retain form input values
-			"goal_text":    goal_text,
-			"is_completed": is_completed_str,
-			"target_date":  target_date_str,
+			"goal_text":   goal_text,
+			"status":      status,
+			"priority":    priority,
+			"category":    category,
+			"target_date": target_date_str,
 		}
 
 		// Render the form again with errors
@@ -120,7 +122,7 @@ func (app *application) addGoals(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/goals", http.StatusSeeOther)
 }
 
-// the listGoals retrieves and displays all goal entries
+// the listGoals retrieves and displays a page of goal entries, sorted, grouped and filtered by the query string
 func (app *application) listGoals(w http.ResponseWriter, r *http.Request) {
 
 	// Get the user ID from the session
@@ -131,12 +133,24 @@ func (app *application) listGoals(w http.ResponseWriter, r *http.Request) {
 	}
 	userID := int64(id)
 
-	// Fetch all gaol entries from the database
-	goals, err := app.goals.GoalList(userID) // fetches all stored goal sntries and return them as a list
-	if err != nil {
-		app.logger.Error("failed to fetch goals", "error", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-		return
+	// Read the sort, grouping, filters and page asked for in the query string
+	v := validator.NewValidator()
+	filters := readListFilters(r, data.GoalSortSafelist, data.GoalGroupSafelist, v)
+
+	// Fetch one page of goal entries from the database
+	goals := []*data.Goals{}
+	var metadata data.Metadata
+	status := http.StatusOK
+	if v.ValidData() {
+		var err error
+		goals, metadata, err = app.goals.GoalPage(userID, filters)
+		if err != nil {
+			app.logger.Error("failed to fetch goals", "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	} else {
+		status = http.StatusUnprocessableEntity
 	}
 
 	//Get/Check for the flash message
@@ -149,10 +163,13 @@ func (app *application) listGoals(w http.ResponseWriter, r *http.Request) {
 	data.IsAuthenticated = app.isAuthenticated(r)
 	data.CSRFToken = nosurf.Token(r)
 	data.GoalList = goals // Assign fetched goals entries to the template data
+	data.GoalGroups = groupGoals(goals, filters.GroupBy)
 	data.Flash = flash
+	data.FormErrors = v.Errors
+	setListPage(data, r, metadata)
 
 	// Render the goal list template
-	err = app.render(w, http.StatusOK, "daily_goals_list.tmpl", data)
+	err := app.render(w, status, "daily_goals_list.tmpl", data)
 	if err != nil {
 		app.logger.Error("failed to render goal list", "template", "daily_goals_list.tmpl", "error", err, "url", r.URL.Path, "method", r.Method)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -186,6 +203,10 @@ func (app *application) deleteGoal(w http.ResponseWriter, r *http.Request) {
 
 	err = app.goals.DeleteGoal(goalID, userID)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.NotFound(w, r)
+			return
+		}
 		http.Error(w, "Could not delete goal", http.StatusInternalServerError)
 		return
 	}
@@ -204,11 +225,15 @@ func (app *application) showeditGoalForm(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Fetch the goal from DB using goal_id
-	goal, err := app.goals.GetGoalByID(goalID)
+	// Fetch the goal from DB using goal_id, only if it belongs to the user
+	goal, err := app.goals.GetGoalByID(goalID, int64(app.session.GetInt(r, "user_id")))
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.NotFound(w, r)
+			return
+		}
 		app.logger.Error("failed to fetch goal for editing", "error", err)
-		http.Error(w, "Could not find goal", http.StatusInternalServerError)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
@@ -218,11 +243,14 @@ func (app *application) showeditGoalForm(w http.ResponseWriter, r *http.Request)
 	data.HeaderText = "Edit Goal"
 	data.IsAuthenticated = app.isAuthenticated(r)
 	data.CSRFToken = nosurf.Token(r)
+	data.GoalCategories = app.goalCategories(r)
 	data.FormData = map[string]string{
-		"goal_id":      fmt.Sprintf("%d", goal.Goal_id),
-		"goal_text":    goal.Goal_text,
-		"is_completed": fmt.Sprintf("%t", goal.Is_completed),
-		"target_date":  goal.Target_date.Format("2006-01-02"),
+		"goal_id":     fmt.Sprintf("%d", goal.Goal_id),
+		"goal_text":   goal.Goal_text,
+		"status":      goal.Status,
+		"priority":    goal.Priority,
+		"category":    goal.Category,
+		"target_date": goal.Target_date.Format("2006-01-02"),
 	}
 
 	err = app.render(w, http.StatusOK, "edit_goal.tmpl", data)
@@ -253,17 +281,11 @@ func (app *application) editGoal(w http.ResponseWriter, r *http.Request) {
 
 	// Extract other form values
 	goal_text := r.PostForm.Get("goal_text")
-	is_completed_str := r.PostForm.Get("is_completed")
+	status := r.PostForm.Get("status")
+	priority := r.PostForm.Get("priority")
+	category := strings.TrimSpace(r.PostForm.Get("category"))
 	target_date_str := r.PostForm.Get("target_date")
 
-	// Convert the is_completed value from string to bool
-	is_completed, err := strconv.ParseBool(is_completed_str)
-	if err != nil {
-		app.logger.Error("invalid value for is_completed", "value", is_completed_str)
-		http.Error(w, "Invalid value for completion status", http.StatusBadRequest)
-		return
-	}
-
 	// Convert target_date string to time.Time
 	target_date, err := time.Parse("2006-01-02", target_date_str) // Standard date format (YYYY-MM-DD)
 	if err != nil {
@@ -274,10 +296,12 @@ func (app *application) editGoal(w http.ResponseWriter, r *http.Request) {
 
 	// Create a goals object with the submitted data
 	goals := &data.Goals{
-		Goal_id:      goalID,
-		Goal_text:    goal_text,
-		Is_completed: is_completed,
-		Target_date:  target_date,
+		Goal_id:     goalID,
+		Goal_text:   goal_text,
+		Status:      status,
+		Priority:    priority,
+		Category:    category,
+		Target_date: target_date,
 	}
 
 	// Validate the submitted goals data
@@ -291,12 +315,15 @@ func (app *application) editGoal(w http.ResponseWriter, r *http.Request) {
 		data.HeaderText = "Edit Goal"
 		data.IsAuthenticated = app.isAuthenticated(r)
 		data.CSRFToken = nosurf.Token(r)
+		data.GoalCategories = app.goalCategories(r)
 		data.FormErrors = v.Errors         // Store validation errors
 		data.FormData = map[string]string{ // Retain form input values
-			"goal_id":      goalIDStr,
-			"goal_text":    goal_text,
-			"is_completed": is_completed_str,
-			"target_date":  target_date_str,
+			"goal_id":     goalIDStr,
+			"goal_text":   goal_text,
+			"status":      status,
+			"priority":    priority,
+			"category":    category,
+			"target_date": target_date_str,
 		}
 
 		// Render the form again with errors
@@ -310,8 +337,12 @@ func (app *application) editGoal(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Update the goal in the database
-	err = app.goals.EditGoal(goals)
+	err = app.goals.EditGoal(goals, int64(app.session.GetInt(r, "user_id")))
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.NotFound(w, r)
+			return
+		}
 		app.logger.Error("failed to update goal", "error", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/abankelsey/study_helper/internal/data"
+	"github.com/abankelsey/study_helper/internal/validator"
+	"github.com/justinas/nosurf"
+)
+
+// goalPath is the page of a goal, where its checklist is kept
+func goalPath(goalID int64) string {
+	return fmt.Sprintf("/goals/%d", goalID)
+}
+
+// readGoalItemIDs reads the goal and, when the route has one, the checklist item from the path
+func readGoalItemIDs(r *http.Request) (int64, int64, error) {
+	goalID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	if r.PathValue("item_id") == "" {
+		return goalID, 0, nil
+	}
+	itemID, err := strconv.ParseInt(r.PathValue("item_id"), 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	return goalID, itemID, nil
+}
+
+// renderGoal shows the page of a goal with its checklist and roll-over history.
+// formErrors and formData are those of the add item form.
+func (app *application) renderGoal(w http.ResponseWriter, r *http.Request, status int, goalID int64, formErrors map[string]string, formData map[string]string) {
+	userID := int64(app.session.GetInt(r, "user_id"))
+
+	goal, err := app.goals.GetGoalByID(goalID, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.NotFound(w, r)
+			return
+		}
+		app.logger.Error("failed to fetch goal", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	items, err := app.goalItems.ItemList(goalID, userID)
+	if err != nil {
+		app.logger.Error("failed to fetch goal checklist", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	history, err := app.goalRollOvers.History(goalID, userID)
+	if err != nil {
+		app.logger.Error("failed to fetch goal roll-overs", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	data := NewTemplateData()
+	data.Title = "Goal"
+	data.HeaderText = goal.Goal_text
+	data.IsAuthenticated = app.isAuthenticated(r)
+	data.CSRFToken = nosurf.Token(r)
+	data.Goal = goal
+	data.GoalItems = items
+	data.GoalRollOvers = history
+	data.Flash = app.session.PopString(r, "flash")
+	if formErrors != nil {
+		data.FormErrors = formErrors
+	}
+	if formData != nil {
+		data.FormData = formData
+	}
+
+	err = app.render(w, status, "goal.tmpl", data)
+	if err != nil {
+		app.logger.Error("failed to render goal page", "template", "goal.tmpl", "error", err, "url", r.URL.Path, "method", r.Method)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// the showGoal displays a goal with its checklist
+func (app *application) showGoal(w http.ResponseWriter, r *http.Request) {
+	goalID, _, err := readGoalItemIDs(r)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	app.renderGoal(w, r, http.StatusOK, goalID, nil, nil)
+}
+
+// the addGoalItem adds an item to the end of a goal's checklist
+func (app *application) addGoalItem(w http.ResponseWriter, r *http.Request) {
+	// Get the user ID from the session
+	id := app.session.GetInt(r, "user_id")
+	if id == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	goalID, _, err := readGoalItemIDs(r)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		app.logger.Error("failed to parse form", "error", err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	item := &data.GoalItems{
+		Goal_id:   goalID,
+		Item_text: strings.TrimSpace(r.PostForm.Get("item_text")),
+	}
+
+	v := validator.NewValidator()
+	data.ValidateGoalItems(v, item)
+	if !v.ValidData() {
+		app.renderGoal(w, r, http.StatusUnprocessableEntity, goalID, v.Errors, map[string]string{"item_text": item.Item_text})
+		return
+	}
+
+	err = app.goalItems.Insert(item, int64(id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.NotFound(w, r)
+			return
+		}
+		app.logger.Error("failed to insert goal item", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, goalPath(goalID), http.StatusSeeOther)
+}
+
+// the goalItemAction ticks, unticks, moves or deletes an item of a goal's checklist.
+// Ticking the last open item completes the goal, and unticking one reopens it.
+func (app *application) goalItemAction(w http.ResponseWriter, r *http.Request) {
+	// Get the user ID from the session
+	id := app.session.GetInt(r, "user_id")
+	if id == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userID := int64(id)
+
+	goalID, itemID, err := readGoalItemIDs(r)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	goal, err := app.goals.GetGoalByID(goalID, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.NotFound(w, r)
+			return
+		}
+		app.logger.Error("failed to fetch goal", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	switch r.PathValue("action") {
+	case "tick":
+		err = app.goalItems.SetDone(itemID, goalID, userID, true)
+	case "untick":
+		err = app.goalItems.SetDone(itemID, goalID, userID, false)
+	case "up":
+		err = app.goalItems.Move(itemID, goalID, userID, true)
+	case "down":
+		err = app.goalItems.Move(itemID, goalID, userID, false)
+	case "delete":
+		err = app.goalItems.Delete(itemID, goalID, userID)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.NotFound(w, r)
+			return
+		}
+		app.logger.Error("failed to change goal item", "action", r.PathValue("action"), "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// Say so when the checklist just finished the goal
+	if !goal.Is_completed && r.PathValue("action") == "tick" {
+		goal, err = app.goals.GetGoalByID(goalID, userID)
+		if err != nil {
+			app.logger.Error("failed to fetch goal", "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if goal.Is_completed {
+			app.session.Put(r, "flash", "Every item is done, goal completed!")
+		}
+	}
+
+	http.Redirect(w, r, goalPath(goalID), http.StatusSeeOther)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/abankelsey/study_helper/internal/data"
+)
+
+// heatmap sizes, in SVG user units
+const (
+	heatmapWeeks = 53
+	heatmapCell  = 11
+	heatmapStep  = 14 // a cell and the gap after it
+	heatmapLeft  = 30 // room for the weekday labels
+	heatmapTop   = 16 // room for the month labels
+)
+
+// Heatmap is a year of activity laid out as an SVG, one column per week starting on Monday
+type Heatmap struct {
+	Width, Height int
+	Cell          int
+	Cells         []HeatmapCell
+	Months        []ChartLabel
+	Weekdays      []ChartLabel
+}
+
+// HeatmapCell is one day. Class picks its colour from how much was completed.
+type HeatmapCell struct {
+	X, Y  int
+	Class string
+	Title string
+}
+
+// heatLevel buckets the number of things completed in a day into the heatmap's shades
+func heatLevel(count int) int {
+	switch {
+	case count == 0:
+		return 0
+	case count <= 2:
+		return count
+	case count <= 4:
+		return 3
+	default:
+		return 4
+	}
+}
+
+// plural writes a count with its noun, adding an s unless there is one
+func plural(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("1 %s", noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// userStreaks works out the user's streaks and their heatmap, with days in the user's time zone
+func (app *application) userStreaks(userID int64) (*data.Streaks, *Heatmap, error) {
+	user, err := app.users.GetUser(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	days, err := app.streaks.Activity(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	today := time.Now().In(user.Location())
+	streaks := data.ComputeStreaks(days, today, user.Streak_freezes)
+
+	return streaks, newHeatmap(streaks, today), nil
+}
+
+// newHeatmap lays out the past year of the streaks' days, ending today
+func newHeatmap(streaks *data.Streaks, today time.Time) *Heatmap {
+	today = time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, time.UTC)
+	start := data.StartOfWeek(today).AddDate(0, 0, -7*(heatmapWeeks-1))
+
+	h := &Heatmap{
+		Width:  heatmapLeft + heatmapWeeks*heatmapStep,
+		Height: heatmapTop + 7*heatmapStep,
+		Cell:   heatmapCell,
+		Cells:  []HeatmapCell{},
+		Months: []ChartLabel{},
+		Weekdays: []ChartLabel{
+			{X: heatmapLeft - 6, Y: heatmapTop + 0*heatmapStep + heatmapCell, Text: "Mon"},
+			{X: heatmapLeft - 6, Y: heatmapTop + 2*heatmapStep + heatmapCell, Text: "Wed"},
+			{X: heatmapLeft - 6, Y: heatmapTop + 4*heatmapStep + heatmapCell, Text: "Fri"},
+		},
+	}
+
+	for day := start; !day.After(today); day = day.AddDate(0, 0, 1) {
+		week := int(day.Sub(start).Hours()/24) / 7
+		weekday := (int(day.Weekday()) + 6) % 7
+		x := heatmapLeft + week*heatmapStep
+
+		// A month is labelled above the first week that starts in it
+		if weekday == 0 && day.Day() <= 7 {
+			h.Months = append(h.Months, ChartLabel{X: float64(x), Y: heatmapTop - 5, Text: day.Format("Jan")})
+		}
+
+		cell := HeatmapCell{X: x, Y: heatmapTop + weekday*heatmapStep}
+		date := day.Format("Jan 2, 2006")
+		switch d := streaks.Days[day]; {
+		case d != nil:
+			cell.Class = fmt.Sprintf("heat-%d", heatLevel(d.Count()))
+			cell.Title = fmt.Sprintf("%s: %s and %s completed", date, plural(d.Goals, "goal"), plural(d.Sessions, "session"))
+		case streaks.Frozen[day]:
+			cell.Class = "heat-frozen"
+			cell.Title = date + ": covered by a streak freeze"
+		default:
+			cell.Class = "heat-0"
+			cell.Title = date + ": nothing completed"
+		}
+		h.Cells = append(h.Cells, cell)
+	}
+
+	return h
+}
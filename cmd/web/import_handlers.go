@@ -0,0 +1,386 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/abankelsey/study_helper/internal/data"
+	"github.com/abankelsey/study_helper/internal/ical"
+	"github.com/abankelsey/study_helper/internal/validator"
+	"github.com/justinas/nosurf"
+)
+
+// maxImportSize limits the size of uploaded .ics files
+const maxImportSize = 1 << 20
+
+// ImportItem is one VEVENT or VTODO of an uploaded calendar, mapped to a session or goal
+type ImportItem struct {
+	UID       string
+	Kind      string // "session" or "goal"
+	Summary   string
+	Session   *data.Sessions
+	Goal      *data.Goals
+	Exdates   []time.Time
+	Errors    map[string]string
+	Duplicate bool
+	Skipped   string // why the item is not imported, if it is not
+}
+
+// Importable reports whether the item can be inserted
+func (i *ImportItem) Importable() bool {
+	return len(i.Errors) == 0 && !i.Duplicate && i.Skipped == ""
+}
+
+// the showImportForm handles requests to display the calendar upload form
+func (app *application) showImportForm(w http.ResponseWriter, r *http.Request) {
+	data := NewTemplateData()
+	data.Title = "Import Calendar"
+	data.HeaderText = "Import Calendar"
+	data.IsAuthenticated = app.isAuthenticated(r)
+	data.CSRFToken = nosurf.Token(r)
+	data.Flash = app.session.PopString(r, "flash")
+
+	err := app.render(w, http.StatusOK, "import.tmpl", data)
+	if err != nil {
+		app.logger.Error("failed to render import page", "template", "import.tmpl", "error", err, "url", r.URL.Path, "method", r.Method)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// the previewImport parses an uploaded .ics file and shows what would be imported
+func (app *application) previewImport(w http.ResponseWriter, r *http.Request) {
+	// Get the user ID from the session
+	id := app.session.GetInt(r, "user_id")
+	if id == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userID := int64(id)
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize+4096)
+	err := r.ParseMultipartForm(maxImportSize)
+	if err != nil {
+		app.logger.Error("failed to parse upload", "error", err)
+		http.Error(w, "The file is too large or the upload was invalid", http.StatusBadRequest)
+		return
+	}
+
+	file, _, err := r.FormFile("calendar")
+	if err != nil {
+		app.renderImportError(w, r, "Choose an .ics file to upload")
+		return
+	}
+	defer file.Close()
+
+	raw, err := io.ReadAll(io.LimitReader(file, maxImportSize))
+	if err != nil {
+		app.logger.Error("failed to read upload", "error", err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	items, err := app.importItems(userID, string(raw))
+	if err != nil {
+		if errors.Is(err, ical.ErrInvalidCalendar) {
+			app.renderImportError(w, r, "The file is not a valid iCalendar (.ics) file")
+			return
+		}
+		app.logger.Error("failed to prepare import", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// The file travels with the confirm form so nothing is stored before the user agrees
+	data := NewTemplateData()
+	data.Title = "Import Calendar"
+	data.HeaderText = "Review Import"
+	data.IsAuthenticated = app.isAuthenticated(r)
+	data.CSRFToken = nosurf.Token(r)
+	data.ImportItems = items
+	data.FormData = map[string]string{
+		"ics": string(raw),
+	}
+
+	err = app.render(w, http.StatusOK, "import.tmpl", data)
+	if err != nil {
+		app.logger.Error("failed to render import preview", "template", "import.tmpl", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// the confirmImport inserts the items the user selected on the preview page
+func (app *application) confirmImport(w http.ResponseWriter, r *http.Request) {
+	// Get the user ID from the session
+	id := app.session.GetInt(r, "user_id")
+	if id == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userID := int64(id)
+
+	r.Body = http.MaxBytesReader(w, r.Body, 4*maxImportSize)
+	err := r.ParseForm()
+	if err != nil {
+		app.logger.Error("failed to parse form", "error", err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	// Items are validated and checked for duplicates again, as time has passed since the preview
+	items, err := app.importItems(userID, r.PostForm.Get("ics"))
+	if err != nil {
+		if errors.Is(err, ical.ErrInvalidCalendar) {
+			app.renderImportError(w, r, "The file is not a valid iCalendar (.ics) file")
+			return
+		}
+		app.logger.Error("failed to prepare import", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	selected := map[string]bool{}
+	for _, uid := range r.PostForm["uid"] {
+		selected[uid] = true
+	}
+
+	var sessions []*data.CalendarSession
+	var goals []*data.Goals
+	for _, item := range items {
+		if !item.Importable() || !selected[item.UID] {
+			continue
+		}
+
+		switch item.Kind {
+		case "session":
+			sessions = append(sessions, &data.CalendarSession{Session: item.Session, Exdates: item.Exdates})
+		case "goal":
+			goals = append(goals, item.Goal)
+		}
+	}
+
+	// Everything is inserted in one transaction, so a failure leaves no partial import
+	result, err := app.archives.ImportCalendar(sessions, goals)
+	if err != nil {
+		app.logger.Error("failed to import calendar", "user_id", userID, "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	app.logger.Info("calendar imported", "user_id", userID, "sessions", result.Sessions, "goals", result.Goals, "skipped", len(result.Skipped))
+	flash := pluralize(result.Sessions, "session") + " and " + pluralize(result.Goals, "goal") + " imported"
+	if len(result.Skipped) > 0 {
+		flash += ", " + pluralize(len(result.Skipped), "duplicate") + " skipped"
+	}
+	app.session.Put(r, "flash", flash)
+
+	http.Redirect(w, r, "/sessions", http.StatusSeeOther)
+}
+
+// renderImportError shows the upload form again with an error message
+func (app *application) renderImportError(w http.ResponseWriter, r *http.Request, message string) {
+	data := NewTemplateData()
+	data.Title = "Import Calendar"
+	data.HeaderText = "Import Calendar"
+	data.IsAuthenticated = app.isAuthenticated(r)
+	data.CSRFToken = nosurf.Token(r)
+	data.FormErrors = map[string]string{
+		"calendar": message,
+	}
+
+	err := app.render(w, http.StatusUnprocessableEntity, "import.tmpl", data)
+	if err != nil {
+		app.logger.Error("failed to render import page", "template", "import.tmpl", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// importItems parses the calendar and maps, validates and de-duplicates each VEVENT and VTODO
+func (app *application) importItems(userID int64, raw string) ([]*ImportItem, error) {
+	cal, err := ical.Parse(strings.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+
+	sessionUIDs, err := app.sessions.ImportedUIDs(userID)
+	if err != nil {
+		return nil, err
+	}
+	goalUIDs, err := app.goals.ImportedUIDs(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	var items []*ImportItem
+
+	for _, c := range cal.Components {
+		var item *ImportItem
+		switch c.Name {
+		case "VEVENT":
+			item = sessionFromEvent(c, userID)
+			item.Duplicate = sessionUIDs[item.UID]
+		case "VTODO":
+			item = goalFromTodo(c, userID)
+			item.Duplicate = goalUIDs[item.UID]
+		default:
+			continue
+		}
+
+		// A file may list the same UID twice, only the first one counts
+		if seen[item.Kind+item.UID] && item.Skipped == "" {
+			item.Skipped = "Appears more than once in the file"
+		}
+		seen[item.Kind+item.UID] = true
+
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// sessionFromEvent maps a VEVENT onto a study session
+func sessionFromEvent(c *ical.Component, userID int64) *ImportItem {
+	item := &ImportItem{
+		UID:     componentUID(c),
+		Kind:    "session",
+		Summary: c.Text("SUMMARY"),
+		Errors:  map[string]string{},
+	}
+
+	// Changes to single occurrences need the series they belong to
+	if c.Get("RECURRENCE-ID") != nil {
+		item.Skipped = "Changes to a single occurrence are not imported"
+		return item
+	}
+
+	// Fall back on other fields so simple timetables still import
+	description := firstNonBlank(c.Text("DESCRIPTION"), c.Text("LOCATION"), item.Summary)
+	subject := item.Summary
+	if categories := c.Text("CATEGORIES"); categories != "" {
+		subject = strings.TrimSpace(strings.Split(categories, ",")[0])
+	}
+
+	session := &data.Sessions{
+		Title:       item.Summary,
+		Description: description,
+		Subject:     subject,
+		User_id:     userID,
+		Ical_uid:    item.UID,
+	}
+
+	if p := c.Get("DTSTART"); p != nil {
+		start, err := p.Date()
+		if err == nil {
+			session.Start_date = start
+			session.End_date = start
+		}
+	}
+
+	// DTEND is exclusive for all-day events
+	if p := c.Get("DTEND"); p != nil {
+		end, err := p.Date()
+		if err == nil {
+			if p.IsDate() && end.After(session.Start_date) {
+				end = end.AddDate(0, 0, -1)
+			}
+			session.End_date = end
+		}
+	}
+
+	if p := c.Get("RRULE"); p != nil {
+		session.Rrule = p.Value
+	}
+
+	for _, p := range c.GetAll("EXDATE") {
+		for _, value := range strings.Split(p.Value, ",") {
+			exdate, err := (&ical.Property{Params: p.Params, Value: value}).Date()
+			if err == nil {
+				item.Exdates = append(item.Exdates, exdate)
+			}
+		}
+	}
+
+	v := validator.NewValidator()
+	data.ValidateSessions(v, session)
+	item.Errors = v.Errors
+	item.Session = session
+
+	return item
+}
+
+// goalFromTodo maps a VTODO onto a daily goal
+func goalFromTodo(c *ical.Component, userID int64) *ImportItem {
+	item := &ImportItem{
+		UID:     componentUID(c),
+		Kind:    "goal",
+		Summary: c.Text("SUMMARY"),
+		Errors:  map[string]string{},
+	}
+
+	goal := &data.Goals{
+		Goal_text:    item.Summary,
+		User_id:      userID,
+		Ical_uid:     item.UID,
+		Is_completed: strings.EqualFold(c.Text("STATUS"), "COMPLETED") || c.Get("COMPLETED") != nil,
+	}
+
+	// A todo without a due date is planned for its start date
+	for _, name := range []string{"DUE", "DTSTART"} {
+		if p := c.Get(name); p != nil {
+			due, err := p.Date()
+			if err == nil {
+				goal.Target_date = due
+				break
+			}
+		}
+	}
+
+	v := validator.NewValidator()
+	data.ValidateGoals(v, goal)
+	item.Errors = v.Errors
+	item.Goal = goal
+
+	return item
+}
+
+// componentUID returns the UID of a component, or a hash of its content when it has none,
+// so importing the same file twice is still detected
+func componentUID(c *ical.Component) string {
+	if uid := strings.TrimSpace(c.Text("UID")); uid != "" {
+		return uid
+	}
+
+	h := sha256.New()
+	io.WriteString(h, c.Name)
+	for _, p := range c.Properties {
+		if p.Name == "DTSTAMP" {
+			continue
+		}
+		io.WriteString(h, p.String()+"\n")
+	}
+	return "sha256-" + hex.EncodeToString(h.Sum(nil))[:32]
+}
+
+// pluralize formats a count with its noun, e.g. "1 goal" or "3 goals"
+func pluralize(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+func firstNonBlank(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abankelsey/study_helper/internal/data"
+	"github.com/abankelsey/study_helper/internal/validator"
+)
+
+// readListFilters reads the sort, group, filter and page query parameters of a goals,
+// sessions or quotes list. The group is only read for lists given a groupSafelist.
+// Parameters that are missing keep their defaults and the ones that are invalid are
+// reported in v.
+func readListFilters(r *http.Request, sortSafelist []string, groupSafelist []string, v *validator.Validator) data.ListFilters {
+	q := r.URL.Query()
+
+	filters := data.ListFilters{
+		Sort:          q.Get("sort"),
+		SortSafelist:  sortSafelist,
+		Cursor:        q.Get("cursor"),
+		PageSize:      data.DefaultPageSize,
+		Subject:       strings.TrimSpace(q.Get("subject")),
+		GroupSafelist: groupSafelist,
+	}
+	if groupSafelist != nil {
+		filters.GroupBy = q.Get("group")
+	}
+	if filters.Sort == "" {
+		filters.Sort = data.DefaultSort
+	}
+
+	if s := q.Get("page_size"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			v.AddError("page_size", "must be an integer value")
+		}
+		filters.PageSize = n
+	}
+
+	switch q.Get("completed") {
+	case "":
+	case "true", "false":
+		completed := q.Get("completed") == "true"
+		filters.Completed = &completed
+	default:
+		v.AddError("completed", "must be true or false")
+	}
+
+	for _, param := range []struct {
+		name string
+		dst  *time.Time
+	}{{"from", &filters.From}, {"to", &filters.To}} {
+		if s := q.Get(param.name); s != "" {
+			t, err := time.Parse("2006-01-02", s)
+			if err != nil {
+				v.AddError(param.name, "must be a date in the format YYYY-MM-DD")
+			}
+			*param.dst = t
+		}
+	}
+
+	data.ValidateListFilters(v, filters)
+
+	return filters
+}
+
+// setListPage fills in the filter form from the query string and links to the pages
+// around the one being shown, keeping the sort and filters
+func setListPage(td *TemplateData, r *http.Request, metadata data.Metadata) {
+	q := r.URL.Query()
+
+	for _, name := range []string{"sort", "completed", "from", "to", "subject", "group", "page_size"} {
+		td.FormData[name] = q.Get(name)
+	}
+	if td.FormData["sort"] == "" {
+		td.FormData["sort"] = data.DefaultSort
+	}
+
+	td.Page = metadata
+
+	if metadata.NextCursor != "" {
+		q.Set("cursor", metadata.NextCursor)
+		td.NextPageURL = r.URL.Path + "?" + q.Encode()
+	}
+
+	if r.URL.Query().Get("cursor") != "" {
+		q.Del("cursor")
+		td.FirstPageURL = r.URL.Path
+		if len(q) > 0 {
+			td.FirstPageURL += "?" + q.Encode()
+		}
+	}
+}
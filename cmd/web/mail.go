@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/abankelsey/study_helper/internal/data"
+	"github.com/abankelsey/study_helper/internal/mailer"
+)
+
+// activationTokenTTL is how long an emailed activation link stays valid
+const activationTokenTTL = 3 * 24 * time.Hour
+
+// passwordResetTokenTTL is how long an emailed password reset link stays valid
+const passwordResetTokenTTL = time.Hour
+
+// emailChangeTokenTTL is how long an emailed link to confirm a new address stays valid
+const emailChangeTokenTTL = 24 * time.Hour
+
+// unlockTokenTTL is how long an emailed unlock link stays valid
+const unlockTokenTTL = time.Hour
+
+// background runs fn in its own goroutine, logging a panic instead of crashing the server.
+// The server waits for it to return before shutting down.
+func (app *application) background(fn func()) {
+	app.wg.Add(1)
+
+	go func() {
+		defer app.wg.Done()
+		defer func() {
+			if err := recover(); err != nil {
+				app.logger.Error("background task panicked", "error", fmt.Sprint(err))
+			}
+		}()
+
+		fn()
+	}()
+}
+
+// sendActivationEmail creates a new activation token for the user and emails the link to them.
+// Earlier activation links stop working.
+func (app *application) sendActivationEmail(user *data.Users, host string) error {
+	err := app.userTokens.DeleteAllForUser(data.ScopeActivation, user.User_id)
+	if err != nil {
+		return err
+	}
+
+	token, err := app.userTokens.New(user.User_id, activationTokenTTL, data.ScopeActivation)
+	if err != nil {
+		return err
+	}
+
+	msg := mailer.Message{
+		To:      user.Email,
+		Subject: "Activate your Study Helper account",
+		Body: fmt.Sprintf(`Hi %s,
+
+Thanks for signing up for Study Helper! Open the link below to activate your account:
+
+https://%s/user/activate?token=%s
+
+The link expires in 3 days. If you did not sign up, you can ignore this email.
+`, user.Name, host, token),
+	}
+
+	// Sending can be slow, so it happens after the response is written
+	app.background(func() {
+		err := app.mailer.Send(msg)
+		if err != nil {
+			app.logger.Error("failed to send activation email", "user_id", user.User_id, "error", err)
+		}
+	})
+
+	return nil
+}
+
+// sendPasswordResetEmail creates a password reset token for the user and emails the link to them
+func (app *application) sendPasswordResetEmail(user *data.Users, host string) error {
+	token, err := app.userTokens.New(user.User_id, passwordResetTokenTTL, data.ScopePasswordReset)
+	if err != nil {
+		return err
+	}
+
+	msg := mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your Study Helper password",
+		Body: fmt.Sprintf(`Hi %s,
+
+Someone asked to reset the password of your Study Helper account. Open the link below to choose a new one:
+
+https://%s/user/password/reset?token=%s
+
+The link expires in 1 hour. If you did not ask for this, you can ignore this email and your password stays the same.
+`, user.Name, host, token),
+	}
+
+	return app.mailer.Send(msg)
+}
+
+// sendUnlockEmail tells the user their account was locked after too many failed logins
+// and emails a link that unlocks it. Earlier unlock links stop working.
+func (app *application) sendUnlockEmail(user *data.Users, host string) error {
+	err := app.userTokens.DeleteAllForUser(data.ScopeUnlock, user.User_id)
+	if err != nil {
+		return err
+	}
+
+	token, err := app.userTokens.New(user.User_id, unlockTokenTTL, data.ScopeUnlock)
+	if err != nil {
+		return err
+	}
+
+	msg := mailer.Message{
+		To:      user.Email,
+		Subject: "Your Study Helper account was locked",
+		Body: fmt.Sprintf(`Hi %s,
+
+There were too many failed attempts to log in to your Study Helper account, so logging in is paused for a while.
+
+If it was you, open the link below to unlock your account right away:
+
+https://%s/user/unlock?token=%s
+
+The link expires in 1 hour. If it was not you, someone may be guessing your password. Consider choosing a stronger one after you log in.
+`, user.Name, host, token),
+	}
+
+	return app.mailer.Send(msg)
+}
+
+// sendEmailChangeEmail emails a link to the user's new address that confirms it.
+// Earlier confirmation links stop working.
+func (app *application) sendEmailChangeEmail(user *data.Users, newEmail string, host string) error {
+	err := app.userTokens.DeleteAllForUser(data.ScopeEmailChange, user.User_id)
+	if err != nil {
+		return err
+	}
+
+	token, err := app.userTokens.New(user.User_id, emailChangeTokenTTL, data.ScopeEmailChange)
+	if err != nil {
+		return err
+	}
+
+	msg := mailer.Message{
+		To:      newEmail,
+		Subject: "Confirm your new Study Helper email",
+		Body: fmt.Sprintf(`Hi %s,
+
+You asked to change the email of your Study Helper account to this address. Open the link below to confirm it:
+
+https://%s/user/email/confirm?token=%s
+
+The link expires in 24 hours. Until then you keep logging in with %s. If you did not ask for this, you can ignore this email.
+`, user.Name, host, token, user.Email),
+	}
+
+	return app.mailer.Send(msg)
+}
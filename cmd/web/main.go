@@ -8,10 +8,17 @@ import (
 	"html/template"
 	"log/slog"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 	"time"
+	// time zone names work even on servers without a zoneinfo database
+	_ "time/tzdata"
 
 	// the '_' means that we will not direct use the pq package
 	"github.com/abankelsey/study_helper/internal/data"
+	"github.com/abankelsey/study_helper/internal/mailer"
+	"github.com/abankelsey/study_helper/internal/throttle"
 
 	"github.com/golangcollege/sessions"
 	_ "github.com/lib/pq"
@@ -19,15 +26,34 @@ import (
 
 // Dependency injection
 type application struct {
-	addr          *string
-	goals         *data.GoalsModel
-	logger        *slog.Logger // Logger for logging application events
-	quotes        *data.QuotesModel
-	sessions      *data.SessionsModel
-	session       *sessions.Session
-	templateCache map[string]*template.Template // Cache for HTML templates
-	tlsConfig     *tls.Config
-	users         *data.UsersModel
+	addr              *string
+	archives          *data.ArchiveModel
+	calendarTokens    *data.CalendarTokensModel
+	emailThrottle     *throttle.Limiter
+	goalItems         *data.GoalItemsModel
+	goalRollOvers     *data.GoalRollOversModel
+	goals             *data.GoalsModel
+	intervals         *data.SessionIntervalsModel
+	ipThrottle        *throttle.Limiter
+	logger            *slog.Logger // Logger for logging application events
+	mailer            mailer.Mailer
+	pomodoros         *data.PomodorosModel
+	quotes            *data.QuotesModel
+	search            *data.SearchModel
+	sessions          *data.SessionsModel
+	session           *sessions.Session
+	stats             *data.StatsModel
+	streaks           *data.StreaksModel
+	subjects          *data.SubjectsModel
+	templateCache     map[string]*template.Template // Cache for HTML templates
+	tlsConfig         *tls.Config
+	tokens            *data.TokensModel
+	twoFactorThrottle *throttle.Limiter
+	twoFactor         *data.TwoFactorModel
+	userSessions      *data.UserSessionsModel
+	userTokens        *data.UserTokensModel
+	users             *data.UsersModel
+	wg                sync.WaitGroup // background tasks the server waits for when shutting down
 }
 
 func main() {
@@ -35,6 +61,14 @@ func main() {
 	addr := flag.String("addr", "", "HTTP network address")
 	dsn := flag.String("dsn", "", "PostgreSQL DSN")
 	secret := flag.String("secret", "KidajE20eufaLsfdS*20+jEhrwrw_uYh", "Secret key")
+	smtpHost := flag.String("smtp-host", "", "SMTP host, emails are written to -mail-dir when empty")
+	smtpPort := flag.Int("smtp-port", 25, "SMTP port")
+	smtpUsername := flag.String("smtp-username", "", "SMTP username")
+	smtpPassword := flag.String("smtp-password", "", "SMTP password")
+	smtpSender := flag.String("smtp-sender", "Study Helper <no-reply@studyhelper.local>", "Sender of outgoing emails")
+	mailDir := flag.String("mail-dir", "./tmp/mail", "Directory emails are written to when no SMTP host is set")
+	autoMigrate := flag.Bool("migrate", false, "Apply pending database migrations at startup")
+	throttleStore := flag.String("throttle-store", "memory", "Where failed logins are counted: memory, or postgres to share them between servers")
 
 	flag.Parse()
 
@@ -49,6 +83,32 @@ func main() {
 
 	logger.Info("database connection pool established")
 
+	// "web [flags] migrate ..." manages the schema instead of starting the server
+	if flag.Arg(0) == "migrate" {
+		err = migrateCommand(db, logger, flag.Args()[1:])
+		db.Close()
+		if err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *autoMigrate {
+		migrator, err := newMigrator(db, logger)
+		if err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+
+		applied, err := migrator.Up(context.Background())
+		if err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+		logger.Info("database migrations up to date", "applied", applied)
+	}
+
 	// Create a new template cache
 	templateCache, err := newTemplateCache()
 	if err != nil {
@@ -62,25 +122,74 @@ func main() {
 	session.Lifetime = 1 * time.Hour
 	session.Secure = true
 
+	// Without an SMTP server, emails are saved as files to read during development
+	var m mailer.Mailer = &mailer.FileMailer{Dir: *mailDir, Sender: *smtpSender}
+	if *smtpHost != "" {
+		m = &mailer.SMTPMailer{
+			Host:     *smtpHost,
+			Port:     *smtpPort,
+			Username: *smtpUsername,
+			Password: *smtpPassword,
+			Sender:   *smtpSender,
+		}
+	}
+
+	// Failed logins are counted in memory unless several servers need to share the counts
+	var store throttle.Store
+	switch *throttleStore {
+	case "memory":
+		store = throttle.NewMemoryStore()
+	case "postgres":
+		store = &throttle.PostgresStore{DB: db}
+	default:
+		logger.Error("invalid -throttle-store, must be memory or postgres", "throttle_store", *throttleStore)
+		os.Exit(1)
+	}
+
 	tlsConfig := &tls.Config{
 		CurvePreferences: []tls.CurveID{tls.X25519, tls.CurveP256},
 	}
 
 	// Initialize the application with the dependencies
 	app := &application{
-		addr:          addr,
-		goals:         &data.GoalsModel{DB: db},
-		logger:        logger,
-		quotes:        &data.QuotesModel{DB: db},
-		sessions:      &data.SessionsModel{DB: db},
-		templateCache: templateCache,
-		session:       session,
-		tlsConfig:     tlsConfig,
-		users:         &data.UsersModel{DB: db},
+		addr:              addr,
+		archives:          &data.ArchiveModel{DB: db},
+		calendarTokens:    &data.CalendarTokensModel{DB: db},
+		emailThrottle:     &throttle.Limiter{Store: store, Policy: emailThrottlePolicy},
+		goalItems:         &data.GoalItemsModel{DB: db},
+		goalRollOvers:     &data.GoalRollOversModel{DB: db},
+		goals:             &data.GoalsModel{DB: db},
+		intervals:         &data.SessionIntervalsModel{DB: db},
+		ipThrottle:        &throttle.Limiter{Store: store, Policy: ipThrottlePolicy},
+		logger:            logger,
+		mailer:            m,
+		pomodoros:         &data.PomodorosModel{DB: db},
+		quotes:            &data.QuotesModel{DB: db},
+		search:            &data.SearchModel{DB: db},
+		sessions:          &data.SessionsModel{DB: db},
+		templateCache:     templateCache,
+		session:           session,
+		stats:             &data.StatsModel{DB: db},
+		streaks:           &data.StreaksModel{DB: db},
+		subjects:          &data.SubjectsModel{DB: db},
+		tlsConfig:         tlsConfig,
+		tokens:            &data.TokensModel{DB: db},
+		twoFactorThrottle: &throttle.Limiter{Store: store, Policy: twoFactorThrottlePolicy},
+		twoFactor:         &data.TwoFactorModel{DB: db},
+		userSessions:      &data.UserSessionsModel{DB: db},
+		userTokens:        &data.UserTokensModel{DB: db},
+		users:             &data.UsersModel{DB: db},
 	}
 
+	// Ctrl+C or SIGTERM cancels ctx, which shuts down the server and stops the background loops
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	app.background(func() { app.pruneLoginAttempts(ctx) })
+	app.background(func() { app.rollOverGoals(ctx) })
+
 	// Start the application server
-	err = app.serve()
+	err = app.serve(ctx)
 	if err != nil {
 		logger.Error(err.Error())
 		os.Exit(1)
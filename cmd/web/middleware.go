@@ -1,10 +1,36 @@
 package main
 
 import (
-	"github.com/justinas/nosurf"
+	"context"
+	"database/sql"
+	"errors"
 	"net/http"
+	"strings"
+
+	"github.com/abankelsey/study_helper/internal/data"
+	"github.com/justinas/nosurf"
 )
 
+type contextKey string
+
+// apiTokenContextKey holds the personal API token a request was authenticated with
+const apiTokenContextKey = contextKey("apiToken")
+
+// userSessionContextKey holds the server-side record of the logged in cookie session
+const userSessionContextKey = contextKey("userSession")
+
+// userSessionFromContext returns the session record set by requireAuthentication, or nil
+func userSessionFromContext(r *http.Request) *data.UserSession {
+	session, _ := r.Context().Value(userSessionContextKey).(*data.UserSession)
+	return session
+}
+
+// apiTokenFromContext returns the token of a bearer authenticated request, or nil
+func apiTokenFromContext(r *http.Request) *data.Tokens {
+	token, _ := r.Context().Value(apiTokenContextKey).(*data.Tokens)
+	return token
+}
+
 // logs incoming HTTP requests and response details
 func (app *application) loggingMiddleware(next http.Handler) http.Handler {
 	fn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -37,8 +63,23 @@ func (app *application) requireAuthentication(next http.Handler) http.Handler {
 			return
 		}
 
+		// Sessions signed out from another device are rejected right away
+		userSession, err := app.currentUserSession(r)
+		if err != nil {
+			app.logger.Error("failed to check session", "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if userSession == nil {
+			app.session.Destroy(r)
+			http.Redirect(w, r, "/user/login", http.StatusFound)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), userSessionContextKey, userSession)
+
 		w.Header().Add("Cache-Control", "no-store")
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(w, r.WithContext(ctx))
 	}
 	return http.HandlerFunc(fn)
 }
@@ -56,5 +97,127 @@ func noSurf(next http.Handler) http.Handler {
 		SameSite: http.SameSiteLaxMode, // Standard SameSite setting
 	})
 
+	// Bearer tokens are never sent by the browser on their own, so they need no CSRF check
+	csrfHandler.ExemptFunc(func(r *http.Request) bool {
+		return apiTokenFromContext(r) != nil
+	})
+
 	return csrfHandler
 }
+
+// requireAPIAuthentication answers unauthenticated API requests with a JSON 401 instead of a redirect
+func (app *application) requireAPIAuthentication(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		if app.apiUserID(r) == 0 {
+			app.logger.Warn("API authentication required", "uri", r.URL.RequestURI())
+			app.authenticationRequiredResponse(w, r)
+			return
+		}
+
+		// Cookie sessions can be logged out remotely, bearer tokens are revoked separately
+		if apiTokenFromContext(r) == nil {
+			userSession, err := app.currentUserSession(r)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+			if userSession == nil {
+				app.session.Destroy(r)
+				app.authenticationRequiredResponse(w, r)
+				return
+			}
+		}
+
+		w.Header().Add("Cache-Control", "no-store")
+		next.ServeHTTP(w, r)
+	}
+	return http.HandlerFunc(fn)
+}
+
+// authenticateToken accepts an "Authorization: Bearer" personal API token. Requests
+// without the header fall back on the cookie session.
+func (app *application) authenticateToken(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Authorization")
+
+		header := r.Header.Get("Authorization")
+		if header == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		scheme, plaintext, ok := strings.Cut(header, " ")
+		if !ok || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(plaintext) == "" {
+			app.invalidAuthenticationTokenResponse(w, r)
+			return
+		}
+
+		token, err := app.tokens.Authenticate(strings.TrimSpace(plaintext))
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				app.logger.Warn("invalid API token", "uri", r.URL.RequestURI())
+				app.invalidAuthenticationTokenResponse(w, r)
+				return
+			}
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), apiTokenContextKey, token)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	}
+	return http.HandlerFunc(fn)
+}
+
+// requireScope checks that a bearer token may read, or for unsafe methods write, the resource.
+// Cookie sessions have full access.
+func (app *application) requireScope(resource string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			token := apiTokenFromContext(r)
+			if token != nil {
+				write := r.Method != http.MethodGet && r.Method != http.MethodHead
+				if !token.Allows(resource, write) {
+					scope := resource + ":read"
+					if write {
+						scope = resource + ":write"
+					}
+					app.forbiddenResponse(w, r, "this token does not have the "+scope+" scope")
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// currentUserSession returns the server-side record of the cookie session, or nil when it
+// was signed out, has expired or the user's sessions were invalidated, e.g. by a password reset
+func (app *application) currentUserSession(r *http.Request) (*data.UserSession, error) {
+	token := app.session.GetString(r, "session_token")
+	if token == "" {
+		return nil, nil
+	}
+
+	userSession, err := app.userSessions.GetByToken(token)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if userSession.User_id != int64(app.session.GetInt(r, "user_id")) ||
+		userSession.Session_version != app.session.GetInt(r, "session_version") {
+		return nil, nil
+	}
+
+	err = app.userSessions.Touch(userSession.Session_id, clientIP(r), app.session.Lifetime)
+	if err != nil {
+		return nil, err
+	}
+
+	return userSession, nil
+}
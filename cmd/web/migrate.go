@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+
+	"github.com/abankelsey/study_helper/internal/migrate"
+	"github.com/abankelsey/study_helper/migrations"
+)
+
+// migrateUsage describes the migrate subcommand
+const migrateUsage = `usage: web -dsn=DSN migrate COMMAND
+commands:
+  up         apply every pending migration
+  down [N]   roll back the last N migrations (default 1)
+  status     show the current version and pending migrations
+  force V    record V as the current version without running any SQL (0 for none)`
+
+// newMigrator loads the migrations embedded in the binary
+func newMigrator(db *sql.DB, logger *slog.Logger) (*migrate.Migrator, error) {
+	return migrate.New(db, migrations.FS, logger)
+}
+
+// migrateCommand runs the migrate subcommand with its arguments
+func migrateCommand(db *sql.DB, logger *slog.Logger, args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	migrator, err := newMigrator(db, logger)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	switch {
+	case args[0] == "up" && len(args) == 1:
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("applied %d migrations\n", applied)
+
+	case args[0] == "down" && len(args) <= 2:
+		n := 1
+		if len(args) == 2 {
+			n, err = strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return errors.New("down: N must be a positive number")
+			}
+		}
+		rolledBack, err := migrator.Down(ctx, n)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("rolled back %d migrations\n", rolledBack)
+
+	case args[0] == "status" && len(args) == 1:
+		status, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("version: %d", status.Version)
+		if status.Dirty {
+			fmt.Print(" (dirty)")
+		}
+		fmt.Println()
+		for _, m := range status.Applied {
+			fmt.Printf("  applied  %06d_%s\n", m.Version, m.Name)
+		}
+		for _, m := range status.Pending {
+			fmt.Printf("  pending  %06d_%s\n", m.Version, m.Name)
+		}
+
+	case args[0] == "force" && len(args) == 2:
+		v, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil || v < 0 {
+			return errors.New("force: V must be a version number")
+		}
+		err = migrator.Force(ctx, v)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("forced version %d\n", v)
+
+	default:
+		return errors.New(migrateUsage)
+	}
+
+	return nil
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/abankelsey/study_helper/internal/data"
+	"github.com/abankelsey/study_helper/internal/validator"
+	"github.com/justinas/nosurf"
+)
+
+// the showForgotPasswordForm handles requests to display the forgot password form
+func (app *application) showForgotPasswordForm(w http.ResponseWriter, r *http.Request) {
+	data := NewTemplateData()
+	data.Title = "Forgot Password"
+	data.HeaderText = "Forgot Password"
+	data.IsAuthenticated = app.isAuthenticated(r)
+	data.CSRFToken = nosurf.Token(r)
+	data.Flash = app.session.PopString(r, "flash")
+
+	err := app.render(w, http.StatusOK, "forgot_password.tmpl", data)
+	if err != nil {
+		app.logger.Error("failed to render forgot password page", "template", "forgot_password.tmpl", "error", err, "url", r.URL.Path, "method", r.Method)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// the forgotPassword emails a password reset link. The reply is the same whether
+// or not the email belongs to an account, so it cannot be used to find accounts.
+func (app *application) forgotPassword(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.logger.Error("failed to parse form", "error", err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	email := r.PostForm.Get("email")
+
+	v := validator.NewValidator()
+	v.Check(validator.NotBlank(email), "email", "This field cannot be left blank")
+	v.Check(validator.IsValidEmail(email), "email", "Must be a valid email address")
+	if !v.ValidData() {
+		data := NewTemplateData()
+		data.Title = "Forgot Password"
+		data.HeaderText = "Forgot Password"
+		data.IsAuthenticated = app.isAuthenticated(r)
+		data.CSRFToken = nosurf.Token(r)
+		data.FormErrors = v.Errors
+		data.FormData = map[string]string{
+			"email": email,
+		}
+
+		err := app.render(w, http.StatusUnprocessableEntity, "forgot_password.tmpl", data)
+		if err != nil {
+			app.logger.Error("failed to render forgot password page", "template", "forgot_password.tmpl", "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// The lookup happens after the response so its timing does not reveal whether the account exists
+	host := r.Host
+	app.background(func() {
+		user, err := app.users.GetByEmail(email)
+		if err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				app.logger.Error("failed to fetch user", "error", err)
+			}
+			return
+		}
+
+		err = app.sendPasswordResetEmail(user, host)
+		if err != nil {
+			app.logger.Error("failed to send password reset email", "user_id", user.User_id, "error", err)
+		}
+	})
+
+	app.session.Put(r, "flash", "If "+email+" belongs to an account, a link to reset the password is on its way")
+
+	http.Redirect(w, r, "/user/password/forgot", http.StatusSeeOther)
+}
+
+// the showResetPasswordForm handles requests to display the form for choosing a new password
+func (app *application) showResetPasswordForm(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+
+	// Check the link up front so the user is not asked for a password that cannot be saved
+	formErrors := map[string]string{}
+	status := http.StatusOK
+	_, err := app.users.GetForToken(data.ScopePasswordReset, token)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			app.logger.Error("failed to check password reset token", "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		status = http.StatusBadRequest
+		formErrors["token"] = "This reset link is invalid, has expired or was already used."
+	}
+
+	data := NewTemplateData()
+	data.Title = "Reset Password"
+	data.HeaderText = "Reset Password"
+	data.IsAuthenticated = app.isAuthenticated(r)
+	data.CSRFToken = nosurf.Token(r)
+	data.FormErrors = formErrors
+	data.FormData = map[string]string{
+		"token": token,
+	}
+
+	err = app.render(w, status, "reset_password.tmpl", data)
+	if err != nil {
+		app.logger.Error("failed to render reset password page", "template", "reset_password.tmpl", "error", err, "url", r.URL.Path, "method", r.Method)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// the resetPassword sets the new password and logs out every session of the user
+func (app *application) resetPassword(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.logger.Error("failed to parse form", "error", err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	token := r.PostForm.Get("token")
+	password := r.PostForm.Get("password")
+	confirmPassword := r.PostForm.Get("confirm_password")
+
+	v := validator.NewValidator()
+	data.ValidatePassword(v, password)
+	v.Check(password == confirmPassword, "confirm_password", "Passwords do not match")
+
+	var user *data.Users
+	if v.ValidData() {
+		user, err = app.users.ResetPassword(token, password)
+		if err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				app.logger.Error("failed to reset password", "error", err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			v.AddError("token", "This reset link is invalid, has expired or was already used.")
+		}
+	}
+
+	if !v.ValidData() {
+		data := NewTemplateData()
+		data.Title = "Reset Password"
+		data.HeaderText = "Reset Password"
+		data.IsAuthenticated = app.isAuthenticated(r)
+		data.CSRFToken = nosurf.Token(r)
+		data.FormErrors = v.Errors
+		data.FormData = map[string]string{
+			"token": token,
+		}
+
+		err := app.render(w, http.StatusUnprocessableEntity, "reset_password.tmpl", data)
+		if err != nil {
+			app.logger.Error("failed to render reset password page", "template", "reset_password.tmpl", "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	app.logger.Info("password reset", "user_id", user.User_id)
+
+	// This browser may have been logged in too, it is now as stale as every other session
+	app.session.Remove(r, "user_id")
+	app.session.Remove(r, "authenticatedUserID")
+	app.session.Remove(r, "session_version")
+	app.session.Remove(r, "session_token")
+	app.session.Put(r, "flash", "Your password has been changed, you can log in with it now")
+
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/abankelsey/study_helper/internal/data"
+	"github.com/abankelsey/study_helper/internal/validator"
+)
+
+// the startPomodoro saves the pomodoro settings of a session and begins the first work phase
+func (app *application) startPomodoro(w http.ResponseWriter, r *http.Request) {
+	// Get the user ID from the session
+	id := app.session.GetInt(r, "user_id")
+	if id == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userID := int64(id)
+
+	sessionIDStr := r.PathValue("id")
+	sessionID, err := strconv.ParseInt(sessionIDStr, 10, 64)
+	if err != nil {
+		app.logger.Error("invalid session_id", "value", sessionIDStr)
+		http.Error(w, "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+
+	// Parse the submitted form data
+	err = r.ParseForm()
+	if err != nil {
+		app.logger.Error("failed to parse form", "error", err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	// The pomodoro of a recurring session runs the timer of one occurrence
+	date, err := occurrenceDate(r)
+	if err != nil {
+		http.Error(w, "Invalid occurrence date", http.StatusBadRequest)
+		return
+	}
+
+	// Extract form values, a non-numeric value is left at zero and caught by validation
+	work_minutes_str := r.PostForm.Get("work_minutes")
+	short_break_minutes_str := r.PostForm.Get("short_break_minutes")
+	long_break_minutes_str := r.PostForm.Get("long_break_minutes")
+	cycles_str := r.PostForm.Get("cycles_before_long_break")
+
+	work_minutes, _ := strconv.Atoi(work_minutes_str)
+	short_break_minutes, _ := strconv.Atoi(short_break_minutes_str)
+	long_break_minutes, _ := strconv.Atoi(long_break_minutes_str)
+	cycles, _ := strconv.Atoi(cycles_str)
+
+	pomodoro := &data.Pomodoros{
+		Session_id:               sessionID,
+		Work_minutes:             work_minutes,
+		Short_break_minutes:      short_break_minutes,
+		Long_break_minutes:       long_break_minutes,
+		Cycles_before_long_break: cycles,
+	}
+
+	// Validate the submitted pomodoro settings
+	v := validator.NewValidator()
+	data.ValidatePomodoros(v, pomodoro)
+
+	// If validation fails, re-render the session page with error messages
+	if !v.ValidData() {
+		data, err := app.newSessionStartData(r, sessionID, date)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.NotFound(w, r)
+				return
+			}
+			app.logger.Error("failed to fetch session", "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		data.FormErrors = v.Errors
+		data.FormData["work_minutes"] = work_minutes_str
+		data.FormData["short_break_minutes"] = short_break_minutes_str
+		data.FormData["long_break_minutes"] = long_break_minutes_str
+		data.FormData["cycles_before_long_break"] = cycles_str
+
+		err = app.render(w, http.StatusUnprocessableEntity, "session_start.tmpl", data)
+		if err != nil {
+			app.logger.Error("failed to render session page", "template", "session_start.tmpl", "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// A stopped session cannot be studied any further
+	timer, err := app.intervals.State(sessionID, userID, date)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) || errors.Is(err, data.ErrNotAnOccurrence) {
+			http.NotFound(w, r)
+			return
+		}
+		app.logger.Error("failed to fetch timer state", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if timer.Status == data.TimerStopped {
+		app.session.Put(r, "flash", "This session has already been stopped")
+		http.Redirect(w, r, sessionStartURL(sessionID, date), http.StatusSeeOther)
+		return
+	}
+
+	err = app.pomodoros.Start(pomodoro, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.NotFound(w, r)
+			return
+		}
+		app.logger.Error("failed to start pomodoro", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	err = app.syncTimerWithPomodoro(sessionID, userID, date, pomodoro.Phase)
+	if err != nil {
+		app.logger.Error("failed to sync session timer", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	app.session.Put(r, "flash", "Pomodoro started, time to focus!")
+	http.Redirect(w, r, sessionStartURL(sessionID, date), http.StatusSeeOther)
+}
+
+// the advancePomodoro finishes or skips the current pomodoro phase and moves to the next one
+func (app *application) advancePomodoro(w http.ResponseWriter, r *http.Request) {
+	// Get the user ID from the session
+	id := app.session.GetInt(r, "user_id")
+	if id == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userID := int64(id)
+
+	sessionIDStr := r.PathValue("id")
+	sessionID, err := strconv.ParseInt(sessionIDStr, 10, 64)
+	if err != nil {
+		app.logger.Error("invalid session_id", "value", sessionIDStr)
+		http.Error(w, "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		http.Error(w, "Unable to parse form", http.StatusBadRequest)
+		return
+	}
+	skip := r.PostForm.Get("skip") == "true"
+
+	date, err := occurrenceDate(r)
+	if err != nil {
+		http.Error(w, "Invalid occurrence date", http.StatusBadRequest)
+		return
+	}
+
+	pomodoro, err := app.pomodoros.Advance(sessionID, userID, skip)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			http.NotFound(w, r)
+		case errors.Is(err, data.ErrPhaseNotFinished):
+			app.session.Put(r, "flash", "This phase is not over yet, keep going!")
+			http.Redirect(w, r, sessionStartURL(sessionID, date), http.StatusSeeOther)
+		default:
+			app.logger.Error("failed to advance pomodoro", "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	err = app.syncTimerWithPomodoro(sessionID, userID, date, pomodoro.Phase)
+	if err != nil {
+		app.logger.Error("failed to sync session timer", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	app.logger.Info("pomodoro advanced", "session_id", sessionID, "phase", pomodoro.Phase, "cycle", pomodoro.Cycle)
+
+	http.Redirect(w, r, sessionStartURL(sessionID, date), http.StatusSeeOther)
+}
+
+// the endPomodoro switches a session out of pomodoro mode
+func (app *application) endPomodoro(w http.ResponseWriter, r *http.Request) {
+	// Get the user ID from the session
+	id := app.session.GetInt(r, "user_id")
+	if id == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userID := int64(id)
+
+	sessionIDStr := r.PathValue("id")
+	sessionID, err := strconv.ParseInt(sessionIDStr, 10, 64)
+	if err != nil {
+		app.logger.Error("invalid session_id", "value", sessionIDStr)
+		http.Error(w, "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+
+	date, err := occurrenceDate(r)
+	if err != nil {
+		http.Error(w, "Invalid occurrence date", http.StatusBadRequest)
+		return
+	}
+
+	err = app.pomodoros.End(sessionID, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.NotFound(w, r)
+			return
+		}
+		app.logger.Error("failed to end pomodoro", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, sessionStartURL(sessionID, date), http.StatusSeeOther)
+}
+
+// syncTimerWithPomodoro runs the session timer during work phases and pauses it during breaks,
+// so pomodoro work is counted in the actual time studied
+func (app *application) syncTimerWithPomodoro(sessionID int64, userID int64, date time.Time, phase string) error {
+	timer, err := app.intervals.State(sessionID, userID, date)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case phase == data.PhaseWork && timer.Status == data.TimerIdle:
+		err = app.intervals.Start(sessionID, userID, date)
+	case phase == data.PhaseWork && timer.Status == data.TimerPaused:
+		err = app.intervals.Resume(sessionID, userID, date)
+	case phase != data.PhaseWork && timer.Status == data.TimerRunning:
+		err = app.intervals.Pause(sessionID, userID, date)
+	}
+
+	// Another request may have moved the timer in the meantime
+	if errors.Is(err, data.ErrTimerInvalidAction) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/abankelsey/study_helper/internal/data"
+	"github.com/abankelsey/study_helper/internal/validator"
+	"github.com/justinas/nosurf"
+)
+
+// newProfileData loads the profile page of the user, with the forms filled in from their account
+func (app *application) newProfileData(r *http.Request, userID int64) (*TemplateData, error) {
+	user, err := app.users.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	data := NewTemplateData()
+	data.Title = "Profile"
+	data.HeaderText = "Profile"
+	data.IsAuthenticated = app.isAuthenticated(r)
+	data.CSRFToken = nosurf.Token(r)
+	data.User = user
+	data.FormData = map[string]string{
+		"name":           user.Name,
+		"email":          user.Email,
+		"timezone":       user.Timezone,
+		"streak_freezes": strconv.FormatBool(user.Streak_freezes),
+		"goal_rollover":  user.Goal_rollover,
+	}
+
+	return data, nil
+}
+
+// renderProfileErrors shows the profile page again with the errors of a submitted form
+func (app *application) renderProfileErrors(w http.ResponseWriter, r *http.Request, formErrors map[string]string, formData map[string]string) {
+	data, err := app.newProfileData(r, int64(app.session.GetInt(r, "user_id")))
+	if err != nil {
+		app.logger.Error("failed to load profile page", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	data.FormErrors = formErrors
+	for key, value := range formData {
+		data.FormData[key] = value
+	}
+
+	err = app.render(w, http.StatusUnprocessableEntity, "profile.tmpl", data)
+	if err != nil {
+		app.logger.Error("failed to render profile page", "template", "profile.tmpl", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// the showProfile handles requests to display the profile page
+func (app *application) showProfile(w http.ResponseWriter, r *http.Request) {
+	// Get the user ID from the session
+	id := app.session.GetInt(r, "user_id")
+	if id == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	data, err := app.newProfileData(r, int64(id))
+	if err != nil {
+		app.logger.Error("failed to load profile page", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	data.Flash = app.session.PopString(r, "flash")
+
+	err = app.render(w, http.StatusOK, "profile.tmpl", data)
+	if err != nil {
+		app.logger.Error("failed to render profile page", "template", "profile.tmpl", "error", err, "url", r.URL.Path, "method", r.Method)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// the updateProfile changes the user's name right away. A new email only replaces the
+// old one once the link emailed to it is opened.
+func (app *application) updateProfile(w http.ResponseWriter, r *http.Request) {
+	// Get the user ID from the session
+	id := app.session.GetInt(r, "user_id")
+	if id == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userID := int64(id)
+
+	err := r.ParseForm()
+	if err != nil {
+		app.logger.Error("failed to parse form", "error", err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	profile := &data.Users{
+		Name:  strings.TrimSpace(r.PostForm.Get("name")),
+		Email: strings.TrimSpace(r.PostForm.Get("email")),
+	}
+	formData := map[string]string{
+		"name":  profile.Name,
+		"email": profile.Email,
+	}
+
+	v := validator.NewValidator()
+	data.ValidateProfile(v, profile)
+	if !v.ValidData() {
+		app.renderProfileErrors(w, r, v.Errors, formData)
+		return
+	}
+
+	user, err := app.users.GetUser(userID)
+	if err != nil {
+		app.logger.Error("failed to fetch user", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	emailChanged := !strings.EqualFold(profile.Email, user.Email)
+	if emailChanged {
+		err = app.users.RequestEmailChange(userID, profile.Email)
+		if err != nil {
+			if errors.Is(err, data.ErrDuplicateEmail) {
+				app.renderProfileErrors(w, r, map[string]string{"email": "An account with this email already exists"}, formData)
+				return
+			}
+			app.logger.Error("failed to request email change", "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	err = app.users.UpdateName(userID, profile.Name)
+	if err != nil {
+		app.logger.Error("failed to update name", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	user.Name = profile.Name
+
+	if emailChanged {
+		err = app.sendEmailChangeEmail(user, profile.Email, r.Host)
+		if err != nil {
+			app.logger.Error("failed to send email change confirmation", "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		app.session.Put(r, "flash", "Profile saved. Check "+profile.Email+" for a link to confirm your new email")
+	} else {
+		app.session.Put(r, "flash", "Profile saved")
+	}
+
+	http.Redirect(w, r, "/account/profile", http.StatusSeeOther)
+}
+
+// the updatePreferences changes the time zone days are counted in, whether missed days
+// can be covered by streak freezes and what happens to goals left unfinished
+func (app *application) updatePreferences(w http.ResponseWriter, r *http.Request) {
+	// Get the user ID from the session
+	id := app.session.GetInt(r, "user_id")
+	if id == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		app.logger.Error("failed to parse form", "error", err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	preferences := &data.Users{
+		Timezone:       strings.TrimSpace(r.PostForm.Get("timezone")),
+		Streak_freezes: r.PostForm.Get("streak_freezes") == "true",
+		Goal_rollover:  r.PostForm.Get("goal_rollover"),
+	}
+	formData := map[string]string{
+		"timezone":       preferences.Timezone,
+		"streak_freezes": strconv.FormatBool(preferences.Streak_freezes),
+		"goal_rollover":  preferences.Goal_rollover,
+	}
+
+	v := validator.NewValidator()
+	data.ValidatePreferences(v, preferences)
+	if !v.ValidData() {
+		app.renderProfileErrors(w, r, v.Errors, formData)
+		return
+	}
+
+	err = app.users.UpdatePreferences(int64(id), preferences)
+	if err != nil {
+		app.logger.Error("failed to update preferences", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	app.session.Put(r, "flash", "Preferences saved")
+
+	http.Redirect(w, r, "/account/profile", http.StatusSeeOther)
+}
+
+// the confirmEmailChange makes the address of the emailed link's token the user's email
+func (app *application) confirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+
+	redirect := "/user/login"
+	if app.isAuthenticated(r) {
+		redirect = "/account/profile"
+	}
+
+	user, err := app.users.ConfirmEmailChange(token)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			app.session.Put(r, "flash", "This confirmation link is invalid, has expired or was already used")
+		case errors.Is(err, data.ErrDuplicateEmail):
+			app.session.Put(r, "flash", "This email now belongs to another account, so it could not be confirmed")
+		default:
+			app.logger.Error("failed to confirm email change", "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, redirect, http.StatusSeeOther)
+		return
+	}
+
+	app.logger.Info("email changed", "user_id", user.User_id)
+	app.session.Put(r, "flash", "Your email is now "+user.Email)
+
+	http.Redirect(w, r, redirect, http.StatusSeeOther)
+}
+
+// the changePassword sets a new password after checking the current one. Every other
+// device is signed out.
+func (app *application) changePassword(w http.ResponseWriter, r *http.Request) {
+	// Get the user ID from the session
+	id := app.session.GetInt(r, "user_id")
+	if id == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userID := int64(id)
+
+	err := r.ParseForm()
+	if err != nil {
+		app.logger.Error("failed to parse form", "error", err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	currentPassword := r.PostForm.Get("current_password")
+	password := r.PostForm.Get("password")
+	confirmPassword := r.PostForm.Get("confirm_password")
+
+	v := validator.NewValidator()
+	v.Check(validator.NotBlank(currentPassword), "current_password", "This field cannot be left blank")
+	data.ValidatePassword(v, password)
+	v.Check(password == confirmPassword, "confirm_password", "Passwords do not match")
+
+	if v.ValidData() {
+		ok, wait, err := app.checkPassword(r, userID, currentPassword)
+		if err != nil {
+			app.logger.Error("failed to check password", "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if wait > 0 {
+			v.AddError("current_password", "Too many wrong passwords. Try again in "+formatWait(wait)+".")
+		}
+		v.Check(ok, "current_password", "Current password is incorrect")
+	}
+
+	if !v.ValidData() {
+		app.renderProfileErrors(w, r, v.Errors, nil)
+		return
+	}
+
+	err = app.users.ChangePassword(userID, password)
+	if err != nil {
+		app.logger.Error("failed to change password", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// Whoever else knew the old password is signed out, this device stays logged in
+	if current := userSessionFromContext(r); current != nil {
+		err = app.userSessions.RevokeOthers(userID, current.Session_id)
+		if err != nil {
+			app.logger.Error("failed to revoke sessions", "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	app.logger.Info("password changed", "user_id", userID)
+	app.session.Put(r, "flash", "Password changed. Your other devices have been signed out")
+
+	http.Redirect(w, r, "/account/profile", http.StatusSeeOther)
+}
+
+// the deleteAccount deletes the user and everything they saved, after checking their password
+func (app *application) deleteAccount(w http.ResponseWriter, r *http.Request) {
+	// Get the user ID from the session
+	id := app.session.GetInt(r, "user_id")
+	if id == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userID := int64(id)
+
+	err := r.ParseForm()
+	if err != nil {
+		app.logger.Error("failed to parse form", "error", err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	password := r.PostForm.Get("delete_password")
+
+	v := validator.NewValidator()
+	v.Check(validator.NotBlank(password), "delete_password", "Enter your password to delete your account")
+
+	if v.ValidData() {
+		ok, wait, err := app.checkPassword(r, userID, password)
+		if err != nil {
+			app.logger.Error("failed to check password", "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if wait > 0 {
+			v.AddError("delete_password", "Too many wrong passwords. Try again in "+formatWait(wait)+".")
+		}
+		v.Check(ok, "delete_password", "Password is incorrect")
+	}
+
+	if !v.ValidData() {
+		app.renderProfileErrors(w, r, v.Errors, nil)
+		return
+	}
+
+	err = app.users.Delete(userID)
+	if err != nil {
+		app.logger.Error("failed to delete user", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	app.logger.Info("account deleted", "user_id", userID)
+
+	app.session.Remove(r, "user_id")
+	app.session.Remove(r, "authenticatedUserID")
+	app.session.Remove(r, "session_version")
+	app.session.Remove(r, "session_token")
+	app.session.Put(r, "flash", "Your account and everything in it has been deleted")
+
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"database/sql"
+	"errors"
 	"github.com/abankelsey/study_helper/internal/data"
 	"github.com/abankelsey/study_helper/internal/validator"
 	"github.com/justinas/nosurf"
@@ -94,7 +96,7 @@ func (app *application) addQuote(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/quotes", http.StatusSeeOther)
 }
 
-// the listQuotes handles requests to display a list of the submitted quote entries
+// the listQuotes handles requests to display a page of the submitted quote entries, sorted and filtered by the query string
 func (app *application) listQuotes(w http.ResponseWriter, r *http.Request) {
 	// Get userID from the session
 	id := app.session.GetInt(r, "user_id")
@@ -104,12 +106,24 @@ func (app *application) listQuotes(w http.ResponseWriter, r *http.Request) {
 	}
 	userID := int64(id)
 
-	// Fetch quotes for the current user
-	quotes, err := app.quotes.QuoteList(userID)
-	if err != nil {
-		app.logger.Error("failed to fetch quotes", "error", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-		return
+	// Read the sort, filters and page asked for in the query string
+	v := validator.NewValidator()
+	filters := readListFilters(r, data.QuoteSortSafelist, nil, v)
+
+	// Fetch one page of quotes for the current user
+	quotes := []*data.Quotes{}
+	var metadata data.Metadata
+	status := http.StatusOK
+	if v.ValidData() {
+		var err error
+		quotes, metadata, err = app.quotes.QuotePage(userID, filters)
+		if err != nil {
+			app.logger.Error("failed to fetch quotes", "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	} else {
+		status = http.StatusUnprocessableEntity
 	}
 
 	//Get/Check for the flash message
@@ -123,9 +137,11 @@ func (app *application) listQuotes(w http.ResponseWriter, r *http.Request) {
 	data.CSRFToken = nosurf.Token(r)
 	data.QuoteList = quotes // Pass quote data to the template
 	data.Flash = flash
+	data.FormErrors = v.Errors
+	setListPage(data, r, metadata)
 
 	// Render the quote list template
-	err = app.render(w, http.StatusOK, "quotes_list.tmpl", data)
+	err := app.render(w, status, "quotes_list.tmpl", data)
 	if err != nil {
 		app.logger.Error("failed to render quote list", "template", "quotes_list.tmpl", "error", err, "url", r.URL.Path, "method", r.Method)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -159,6 +175,10 @@ func (app *application) deleteQuote(w http.ResponseWriter, r *http.Request) {
 	// Call DeleteQuote with both quoteID and userID
 	err = app.quotes.DeleteQuote(quoteID, userID)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.NotFound(w, r)
+			return
+		}
 		http.Error(w, "Could not delete quote", http.StatusInternalServerError)
 		return
 	}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// goalRollOverInterval is how often unfinished goals are checked for. Every time zone is
+// a whole number of quarter hours away from UTC, so checking at the start of each quarter
+// hour reaches every user right after their midnight.
+const goalRollOverInterval = 15 * time.Minute
+
+// goalRollOverDelay keeps the check from starting before midnight when the clocks of the
+// server and the database are slightly apart
+const goalRollOverDelay = 5 * time.Second
+
+// rollOverGoals carries over or marks missed the goals left unfinished when each user's
+// day ends, as the user picked. The first check runs at startup to catch up on any
+// midnight that passed while the server was down. It returns once ctx is cancelled,
+// which also cancels a check that is still running.
+func (app *application) rollOverGoals(ctx context.Context) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		rolled, missed, err := app.goalRollOvers.RollOver(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				app.logger.Error("failed to roll over unfinished goals", "error", err)
+			}
+		} else if rolled > 0 || missed > 0 {
+			app.logger.Info("rolled over unfinished goals", "rolled", rolled, "missed", missed)
+		}
+
+		next := time.Now().Truncate(goalRollOverInterval).Add(goalRollOverInterval + goalRollOverDelay)
+		timer.Reset(time.Until(next))
+	}
+}
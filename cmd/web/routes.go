@@ -19,7 +19,22 @@ func (app *application) routes() http.Handler {
 
 	mux.Handle("GET /user/login", dynamicMiddleware.ThenFunc(app.showLoginForm))
 	mux.Handle("POST /user/login", dynamicMiddleware.ThenFunc(app.loginUser))
+	mux.Handle("GET /user/login/2fa", dynamicMiddleware.ThenFunc(app.showLoginTwoFactorForm))
+	mux.Handle("POST /user/login/2fa", dynamicMiddleware.ThenFunc(app.loginTwoFactor))
 	mux.Handle("POST /user/logout", dynamicMiddleware.ThenFunc(app.logoutUser))
+	mux.Handle("GET /user/email/confirm", dynamicMiddleware.ThenFunc(app.confirmEmailChange))
+	mux.Handle("GET /user/unlock", dynamicMiddleware.ThenFunc(app.unlockUser))
+
+	//account activation
+	mux.Handle("GET /user/activate", dynamicMiddleware.ThenFunc(app.activateUser))
+	mux.Handle("GET /user/activate/resend", dynamicMiddleware.ThenFunc(app.showResendActivationForm))
+	mux.Handle("POST /user/activate/resend", dynamicMiddleware.ThenFunc(app.resendActivation))
+
+	//password reset
+	mux.Handle("GET /user/password/forgot", dynamicMiddleware.ThenFunc(app.showForgotPasswordForm))
+	mux.Handle("POST /user/password/forgot", dynamicMiddleware.ThenFunc(app.forgotPassword))
+	mux.Handle("GET /user/password/reset", dynamicMiddleware.ThenFunc(app.showResetPasswordForm))
+	mux.Handle("POST /user/password/reset", dynamicMiddleware.ThenFunc(app.resetPassword))
 
 	//the home page
 	mux.Handle("GET /", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.home))
@@ -36,6 +51,16 @@ func (app *application) routes() http.Handler {
 	mux.Handle("GET /goals/edit", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.showeditGoalForm))
 	//Hnalde the edit goal
 	mux.Handle("POST /goals/edit", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.editGoal))
+	//Show a goal with its checklist
+	mux.Handle("GET /goals/{id}", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.showGoal))
+	//Show the goals as cards in a column for each status
+	mux.Handle("GET /goals/board", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.showGoalBoard))
+	//Handle moving a card of the board to another status
+	mux.Handle("POST /goals/{id}/status", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.moveGoal))
+	//Handle adding a checklist item
+	mux.Handle("POST /goals/{id}/items", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.addGoalItem))
+	//Handle ticking, unticking, moving and deleting a checklist item
+	mux.Handle("POST /goals/{id}/items/{item_id}/{action}", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.goalItemAction))
 
 	//Handle study sessions form
 	mux.Handle("GET /session", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.showSessionsForm))
@@ -51,6 +76,29 @@ func (app *application) routes() http.Handler {
 	mux.Handle("POST /sessions/edit", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.editSession))
 	//Handle show session form
 	mux.Handle("GET /sessions/start", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.showstartSessionInfo))
+	//Get the session timer state
+	mux.Handle("GET /sessions/{id}/timer", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.sessionTimerStatus))
+	//Handle start, pause, resume and stop of the session timer
+	mux.Handle("POST /sessions/{id}/timer/{action}", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.sessionTimerAction))
+	//Handle starting pomodoro mode for a session
+	mux.Handle("POST /sessions/{id}/pomodoro", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.startPomodoro))
+	//Handle moving to the next pomodoro phase
+	mux.Handle("POST /sessions/{id}/pomodoro/advance", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.advancePomodoro))
+	//Handle leaving pomodoro mode
+	mux.Handle("POST /sessions/{id}/pomodoro/end", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.endPomodoro))
+
+	//Handle subject form
+	mux.Handle("GET /subject", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.showSubjectForm))
+	//Handle subject submissions
+	mux.Handle("POST /subject", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.addSubject))
+	//Get all subjects with their planned and studied hours
+	mux.Handle("GET /subjects", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.listSubjects))
+	//Handle delete a subject
+	mux.Handle("POST /subjects/delete", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.deleteSubject))
+	//Handle edit subject form
+	mux.Handle("GET /subjects/edit", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.showeditSubjectForm))
+	//Handle the edit subject
+	mux.Handle("POST /subjects/edit", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.editSubject))
 
 	//Handle quote form
 	mux.Handle("GET /quote", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.showQuoteForm))
@@ -61,5 +109,92 @@ func (app *application) routes() http.Handler {
 	//Handle delete a quote
 	mux.Handle("POST /quotes/delete", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.deleteQuote))
 
+	//Search goals, sessions and quotes
+	mux.Handle("GET /search", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.showSearch))
+
+	//Charts of the time studied and the goals and sessions completed
+	mux.Handle("GET /stats", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.showStats))
+
+	//Account page
+	mux.Handle("GET /account", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.showAccount))
+
+	//Profile settings
+	mux.Handle("GET /account/profile", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.showProfile))
+	//Handle changing the name and email
+	mux.Handle("POST /account/profile", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.updateProfile))
+	//Handle changing the time zone and streak freezes
+	mux.Handle("POST /account/preferences", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.updatePreferences))
+	//Handle changing the password
+	mux.Handle("POST /account/password", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.changePassword))
+	//Handle deleting the account
+	mux.Handle("POST /account/delete", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.deleteAccount))
+
+	//Two-factor authentication settings and enrollment
+	mux.Handle("GET /account/2fa", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.showTwoFactor))
+	//Handle turning on two-factor authentication
+	mux.Handle("POST /account/2fa/enable", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.enableTwoFactor))
+	//Handle turning off two-factor authentication
+	mux.Handle("POST /account/2fa/disable", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.disableTwoFactor))
+	//Handle replacing the recovery codes
+	mux.Handle("POST /account/2fa/recovery-codes", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.regenerateRecoveryCodes))
+
+	//Download everything the user saved as a JSON archive
+	mux.Handle("GET /account/export", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.exportArchive))
+	//Archive upload form
+	mux.Handle("GET /account/import", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.showArchiveImportForm))
+	//Handle restoring an uploaded archive
+	mux.Handle("POST /account/import", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.importArchive))
+
+	//Browsers the user is logged in on
+	mux.Handle("GET /account/devices", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.showDevices))
+	//Handle signing out one device
+	mux.Handle("POST /account/devices/{id}/revoke", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.revokeDevice))
+	//Handle signing out everywhere
+	mux.Handle("POST /account/devices/revoke-all", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.revokeAllDevices))
+
+	//Handle creating a personal API token
+	mux.Handle("POST /account/tokens", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.createAPIToken))
+	//Handle revoking a personal API token
+	mux.Handle("POST /account/tokens/{id}/revoke", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.revokeAPIToken))
+
+	//Download sessions and goals as an iCalendar file
+	mux.Handle("GET /calendar.ics", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.exportCalendar))
+	//Handle creating a new private calendar feed URL
+	mux.Handle("POST /account/calendar-token", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.regenerateCalendarToken))
+	//Handle turning off the private calendar feed
+	mux.Handle("POST /account/calendar-token/revoke", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.revokeCalendarToken))
+	//Handle calendar import form
+	mux.Handle("GET /import", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.showImportForm))
+	//Handle calendar upload and show what would be imported
+	mux.Handle("POST /import", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.previewImport))
+	//Handle inserting the confirmed calendar items
+	mux.Handle("POST /import/confirm", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.confirmImport))
+	//Private calendar feed, authenticated by the secret token in the URL
+	mux.HandleFunc("GET /feeds/{token}/calendar.ics", app.calendarFeed)
+
+	//JSON API, version 1
+	apiMiddleware := alice.New(app.session.Enable, app.authenticateToken, noSurf, app.requireAPIAuthentication)
+	goalsAPI := apiMiddleware.Append(app.requireScope("goals"))
+	sessionsAPI := apiMiddleware.Append(app.requireScope("sessions"))
+	quotesAPI := apiMiddleware.Append(app.requireScope("quotes"))
+
+	mux.Handle("GET /api/v1/goals", goalsAPI.ThenFunc(app.apiListGoals))
+	mux.Handle("POST /api/v1/goals", goalsAPI.ThenFunc(app.apiCreateGoal))
+	mux.Handle("GET /api/v1/goals/{id}", goalsAPI.ThenFunc(app.apiShowGoal))
+	mux.Handle("PATCH /api/v1/goals/{id}", goalsAPI.ThenFunc(app.apiUpdateGoal))
+	mux.Handle("DELETE /api/v1/goals/{id}", goalsAPI.ThenFunc(app.apiDeleteGoal))
+
+	mux.Handle("GET /api/v1/sessions", sessionsAPI.ThenFunc(app.apiListSessions))
+	mux.Handle("POST /api/v1/sessions", sessionsAPI.ThenFunc(app.apiCreateSession))
+	mux.Handle("GET /api/v1/sessions/{id}", sessionsAPI.ThenFunc(app.apiShowSession))
+	mux.Handle("PATCH /api/v1/sessions/{id}", sessionsAPI.ThenFunc(app.apiUpdateSession))
+	mux.Handle("DELETE /api/v1/sessions/{id}", sessionsAPI.ThenFunc(app.apiDeleteSession))
+
+	mux.Handle("GET /api/v1/quotes", quotesAPI.ThenFunc(app.apiListQuotes))
+	mux.Handle("POST /api/v1/quotes", quotesAPI.ThenFunc(app.apiCreateQuote))
+	mux.Handle("GET /api/v1/quotes/{id}", quotesAPI.ThenFunc(app.apiShowQuote))
+	mux.Handle("PATCH /api/v1/quotes/{id}", quotesAPI.ThenFunc(app.apiUpdateQuote))
+	mux.Handle("DELETE /api/v1/quotes/{id}", quotesAPI.ThenFunc(app.apiDeleteQuote))
+
 	return app.loggingMiddleware(mux)
 }
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/abankelsey/study_helper/internal/data"
+	"github.com/abankelsey/study_helper/internal/validator"
+	"github.com/justinas/nosurf"
+)
+
+// the showSearch searches the user's goals, sessions and quotes for the words in ?q=,
+// showing only one kind of result when ?type= is set
+func (app *application) showSearch(w http.ResponseWriter, r *http.Request) {
+	// Get the user ID from the session
+	id := app.session.GetInt(r, "user_id")
+	if id == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+	search := &data.Search{
+		Query: strings.TrimSpace(query.Get("q")),
+		Type:  query.Get("type"),
+	}
+
+	// An empty search box only shows the form
+	v := validator.NewValidator()
+	status := http.StatusOK
+	if search.Query != "" {
+		data.ValidateSearch(v, search)
+		if v.ValidData() {
+			err := app.search.Search(int64(id), search)
+			if err != nil {
+				app.logger.Error("failed to search", "error", err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+		} else {
+			status = http.StatusUnprocessableEntity
+		}
+	}
+
+	data := NewTemplateData()
+	data.Title = "Search"
+	data.HeaderText = "Search"
+	data.IsAuthenticated = app.isAuthenticated(r)
+	data.CSRFToken = nosurf.Token(r)
+	data.FormErrors = v.Errors
+	data.FormData = map[string]string{
+		"q":    search.Query,
+		"type": search.Type,
+	}
+	if search.Results != nil {
+		data.Search = search
+	}
+
+	err := app.render(w, status, "search.tmpl", data)
+	if err != nil {
+		app.logger.Error("failed to render search page", "template", "search.tmpl", "error", err, "url", r.URL.Path, "method", r.Method)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
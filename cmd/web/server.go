@@ -1,12 +1,19 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log/slog"
 	"net/http"
 	"time"
 )
 
-func (app *application) serve() error {
+// shutdownTimeout is how long requests and background tasks get to finish when the server stops
+const shutdownTimeout = 30 * time.Second
+
+// serve runs the server until ctx is cancelled, then stops taking requests and waits for
+// the ones in flight and the background tasks to finish
+func (app *application) serve(ctx context.Context) error {
 	srv := &http.Server{
 		Addr:         *app.addr,
 		Handler:      app.routes(),
@@ -16,6 +23,46 @@ func (app *application) serve() error {
 		ErrorLog:     slog.NewLogLogger(app.logger.Handler(), slog.LevelError),
 		TLSConfig:    app.tlsConfig,
 	}
+
+	shutdownError := make(chan error, 1)
+	go func() {
+		<-ctx.Done()
+		app.logger.Info("shutting down server", "addr", srv.Addr)
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+
+		err := srv.Shutdown(shutdownCtx)
+		if err != nil {
+			shutdownError <- err
+			return
+		}
+
+		// The background loops stop on ctx too, emails still being sent get the rest of the timeout
+		done := make(chan struct{})
+		go func() {
+			app.wg.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+			shutdownError <- nil
+		case <-shutdownCtx.Done():
+			shutdownError <- shutdownCtx.Err()
+		}
+	}()
+
 	app.logger.Info("starting server", "addr", srv.Addr)
-	return srv.ListenAndServeTLS("./tls/cert.pem", "./tls/key.pem")
+	err := srv.ListenAndServeTLS("./tls/cert.pem", "./tls/key.pem")
+	if !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	err = <-shutdownError
+	if err != nil {
+		return err
+	}
+
+	app.logger.Info("stopped server", "addr", srv.Addr)
+	return nil
 }
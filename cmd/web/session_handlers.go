@@ -1,12 +1,15 @@
 package main
 
 import (
+	"database/sql"
+	"errors"
 	"fmt"
 	"github.com/abankelsey/study_helper/internal/data"
 	"github.com/abankelsey/study_helper/internal/validator"
 	"github.com/justinas/nosurf"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -20,6 +23,8 @@ func (app *application) showSessionsForm(w http.ResponseWriter, r *http.Request)
 	data.CSRFToken = nosurf.Token(r)
 
 	// Render the sessions form template
+	data.SubjectNames = app.subjectNames(r)
+
 	err := app.render(w, http.StatusOK, "sessions.tmpl", data)
 	if err != nil {
 		// Log the error and return Error response
@@ -44,7 +49,7 @@ func (app *application) addSessions(w http.ResponseWriter, r *http.Request) {
 	subject := r.Form.Get("subject")
 	start_date_str := r.Form.Get("start_date")
 	end_date_str := r.Form.Get("end_date")
-	isCompletedStr := r.Form.Get("is_completed")
+	rrule := strings.TrimSpace(r.Form.Get("rrule"))
 
 	// Convert start_date string to time.Time
 	start_date, err := time.Parse("2006-01-02", start_date_str)
@@ -62,13 +67,6 @@ func (app *application) addSessions(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Convert is_completed from string to bool
-	isCompleted, err := strconv.ParseBool(isCompletedStr)
-	if err != nil {
-		app.logger.Error("invalid value for is_completed", "value", isCompletedStr)
-		http.Error(w, "Invalid value for completion status", http.StatusBadRequest)
-		return
-	}
 	// Get the user ID from the session
 	id := app.session.GetInt(r, "user_id")
 	if id == 0 {
@@ -79,13 +77,13 @@ func (app *application) addSessions(w http.ResponseWriter, r *http.Request) {
 
 	// Construct sessions object
 	sessions := &data.Sessions{
-		Title:        title,
-		Description:  description,
-		Subject:      subject,
-		Start_date:   start_date,
-		End_date:     end_date,
-		Is_completed: isCompleted,
-		User_id:      userID,
+		Title:       title,
+		Description: description,
+		Subject:     subject,
+		Start_date:  start_date,
+		End_date:    end_date,
+		User_id:     userID,
+		Rrule:       rrule,
 	}
 
 	// Validate
@@ -100,14 +98,16 @@ func (app *application) addSessions(w http.ResponseWriter, r *http.Request) {
 		data.CSRFToken = nosurf.Token(r)
 		data.FormErrors = v.Errors
 		data.FormData = map[string]string{
-			"title":        title,
-			"description":  description,
-			"subject":      subject,
-			"start_date":   start_date_str,
-			"end_date":     end_date_str,
-			"is_completed": isCompletedStr,
+			"title":       title,
+			"description": description,
+			"subject":     subject,
+			"start_date":  start_date_str,
+			"end_date":    end_date_str,
+			"rrule":       rrule,
 		}
 
+		data.SubjectNames = app.subjectNames(r)
+
 		err := app.render(w, http.StatusUnprocessableEntity, "sessions.tmpl", data)
 		if err != nil {
 			app.logger.Error("failed to render form", "error", err)
@@ -131,7 +131,7 @@ func (app *application) addSessions(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/sessions", http.StatusSeeOther)
 }
 
-// the listSessions retrieves and displays all session entries
+// the listSessions retrieves and displays a page of session entries, sorted and filtered by the query string
 func (app *application) listSessions(w http.ResponseWriter, r *http.Request) {
 
 	// Get userID from the session
@@ -142,12 +142,24 @@ func (app *application) listSessions(w http.ResponseWriter, r *http.Request) {
 	}
 	userID := int64(id)
 
-	// Fetch all gaol entries from the database
-	sessions, err := app.sessions.SessionList(userID) // fetches all stored session sntries and return them as a list
-	if err != nil {
-		app.logger.Error("failed to fetch session", "error", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-		return
+	// Read the sort, filters and page asked for in the query string
+	v := validator.NewValidator()
+	filters := readListFilters(r, data.SessionSortSafelist, nil, v)
+
+	// Fetch one page of session entries from the database
+	sessions := []*data.Sessions{}
+	var metadata data.Metadata
+	status := http.StatusOK
+	if v.ValidData() {
+		var err error
+		sessions, metadata, err = app.sessions.SessionPage(userID, filters, true)
+		if err != nil {
+			app.logger.Error("failed to fetch session", "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	} else {
+		status = http.StatusUnprocessableEntity
 	}
 
 	//Get/Check for the flash message
@@ -161,9 +173,11 @@ func (app *application) listSessions(w http.ResponseWriter, r *http.Request) {
 	data.CSRFToken = nosurf.Token(r)
 	data.SessionList = sessions // Assign fetched session entries to the template data
 	data.Flash = flash
+	data.FormErrors = v.Errors
+	setListPage(data, r, metadata)
 
 	// Render the session list template
-	err = app.render(w, http.StatusOK, "sessions_list.tmpl", data)
+	err := app.render(w, status, "sessions_list.tmpl", data)
 	if err != nil {
 		app.logger.Error("failed to render session list", "template", "sessions_list.tmpl", "error", err, "url", r.URL.Path, "method", r.Method)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -195,8 +209,35 @@ func (app *application) deleteSession(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// A single occurrence of a recurring session is cancelled, not deleted
+	occurrenceDateStr := r.FormValue("occurrence_date")
+	if occurrenceDateStr != "" && r.FormValue("scope") == "occurrence" {
+		occurrenceDate, err := time.Parse("2006-01-02", occurrenceDateStr)
+		if err != nil {
+			http.Error(w, "Invalid occurrence date", http.StatusBadRequest)
+			return
+		}
+
+		err = app.sessions.DeleteOccurrence(sessionID, userID, occurrenceDate)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) || errors.Is(err, data.ErrNotAnOccurrence) {
+				http.NotFound(w, r)
+				return
+			}
+			http.Error(w, "Could not delete session", http.StatusInternalServerError)
+			return
+		}
+
+		http.Redirect(w, r, "/sessions", http.StatusSeeOther)
+		return
+	}
+
 	err = app.sessions.DeleteSession(sessionID, userID)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.NotFound(w, r)
+			return
+		}
 		http.Error(w, "Could not delete session", http.StatusInternalServerError)
 		return
 	}
@@ -215,14 +256,41 @@ func (app *application) showeditSessionForm(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	// Fetch the session from DB using session_id
-	session, err := app.sessions.GetSessionByID(sessionID)
+	userID := int64(app.session.GetInt(r, "user_id"))
+
+	// Fetch the session from DB using session_id, only if it belongs to the user
+	session, err := app.sessions.GetSessionByID(sessionID, userID)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.NotFound(w, r)
+			return
+		}
 		app.logger.Error("failed to fetch session for editing", "error", err)
-		http.Error(w, "Could not find session", http.StatusInternalServerError)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
+	// When editing from an occurrence, show that occurrence's values
+	occurrenceDateStr := r.URL.Query().Get("occurrence_date")
+	if occurrenceDateStr != "" {
+		occurrenceDate, err := time.Parse("2006-01-02", occurrenceDateStr)
+		if err != nil {
+			http.Error(w, "Invalid occurrence date", http.StatusBadRequest)
+			return
+		}
+
+		session, err = app.sessions.GetOccurrence(sessionID, userID, occurrenceDate)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) || errors.Is(err, data.ErrNotAnOccurrence) {
+				http.NotFound(w, r)
+				return
+			}
+			app.logger.Error("failed to fetch occurrence for editing", "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	}
+
 	// Preload the form with current session values
 	data := NewTemplateData()
 	data.Title = "Edit Session"
@@ -230,15 +298,19 @@ func (app *application) showeditSessionForm(w http.ResponseWriter, r *http.Reque
 	data.IsAuthenticated = app.isAuthenticated(r)
 	data.CSRFToken = nosurf.Token(r)
 	data.FormData = map[string]string{
-		"session_id":   fmt.Sprintf("%d", session.Session_id),
-		"title":        session.Title,
-		"description":  session.Description,
-		"subject":      session.Subject,
-		"start_date":   session.Start_date.Format("2006-01-02"),
-		"end_date":     session.End_date.Format("2006-01-02"),
-		"is_completed": fmt.Sprintf("%t", session.Is_completed),
+		"session_id":      fmt.Sprintf("%d", session.Session_id),
+		"title":           session.Title,
+		"description":     session.Description,
+		"subject":         session.Subject,
+		"start_date":      session.Start_date.Format("2006-01-02"),
+		"end_date":        session.End_date.Format("2006-01-02"),
+		"rrule":           session.Rrule,
+		"occurrence_date": occurrenceDateStr,
+		"scope":           "occurrence",
 	}
 
+	data.SubjectNames = app.subjectNames(r)
+
 	err = app.render(w, http.StatusOK, "edit_session.tmpl", data)
 	if err != nil {
 		app.logger.Error("failed to render edit session form", "error", err)
@@ -270,7 +342,9 @@ func (app *application) editSession(w http.ResponseWriter, r *http.Request) {
 	subject := r.PostForm.Get("subject")
 	start_date_str := r.PostForm.Get("start_date")
 	end_date_str := r.PostForm.Get("end_date")
-	is_completed_str := r.PostForm.Get("is_completed")
+	rrule := strings.TrimSpace(r.PostForm.Get("rrule"))
+	occurrence_date_str := r.PostForm.Get("occurrence_date")
+	scope := r.PostForm.Get("scope")
 
 	// Convert start_date string to time.Time
 	start_date, err := time.Parse("2006-01-02", start_date_str)
@@ -288,29 +362,32 @@ func (app *application) editSession(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Convert is_completed from string to bool
-	isCompleted, err := strconv.ParseBool(is_completed_str)
-	if err != nil {
-		app.logger.Error("invalid value for is_completed", "value", is_completed_str)
-		http.Error(w, "Invalid value for completion status", http.StatusBadRequest)
-		return
-	}
-
 	// Construct sessions object
 	sessions := &data.Sessions{
-		Session_id:   sessionID,
-		Title:        title,
-		Description:  description,
-		Subject:      subject,
-		Start_date:   start_date,
-		End_date:     end_date,
-		Is_completed: isCompleted,
+		Session_id:  sessionID,
+		Title:       title,
+		Description: description,
+		Subject:     subject,
+		Start_date:  start_date,
+		End_date:    end_date,
+		Rrule:       rrule,
 	}
 
 	// Validate
 	v := validator.NewValidator()
 	data.ValidateSessions(v, sessions)
 
+	var occurrence_date time.Time
+	if occurrence_date_str != "" {
+		occurrence_date, err = time.Parse("2006-01-02", occurrence_date_str)
+		if err != nil {
+			app.logger.Error("invalid occurrence_date format", "value", occurrence_date_str)
+			http.Error(w, "Invalid occurrence date format", http.StatusBadRequest)
+			return
+		}
+		v.Check(scope == "occurrence" || scope == "series", "scope", "Choose this occurrence or the whole series")
+	}
+
 	if !v.ValidData() {
 		data := NewTemplateData()
 		data.Title = "Edit Session"
@@ -319,15 +396,19 @@ func (app *application) editSession(w http.ResponseWriter, r *http.Request) {
 		data.CSRFToken = nosurf.Token(r)
 		data.FormErrors = v.Errors
 		data.FormData = map[string]string{
-			"session_id":   sessionIDStr,
-			"title":        title,
-			"description":  description,
-			"subject":      subject,
-			"start_date":   start_date_str,
-			"end_date":     end_date_str,
-			"is_completed": is_completed_str,
+			"session_id":      sessionIDStr,
+			"title":           title,
+			"description":     description,
+			"subject":         subject,
+			"start_date":      start_date_str,
+			"end_date":        end_date_str,
+			"rrule":           rrule,
+			"occurrence_date": occurrence_date_str,
+			"scope":           scope,
 		}
 
+		data.SubjectNames = app.subjectNames(r)
+
 		err := app.render(w, http.StatusUnprocessableEntity, "edit_session.tmpl", data)
 		if err != nil {
 			app.logger.Error("failed to render form", "error", err)
@@ -337,9 +418,50 @@ func (app *application) editSession(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	userID := int64(app.session.GetInt(r, "user_id"))
+
+	// Only this occurrence of a recurring session changes
+	if occurrence_date_str != "" && scope == "occurrence" {
+		err = app.sessions.EditOccurrence(sessions, userID, occurrence_date)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) || errors.Is(err, data.ErrNotAnOccurrence) {
+				http.NotFound(w, r)
+				return
+			}
+			app.logger.Error("failed to update session occurrence", "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		http.Redirect(w, r, "/sessions", http.StatusSeeOther)
+		return
+	}
+
+	// Moving an occurrence while editing the whole series moves the series by the same amount
+	if occurrence_date_str != "" {
+		series, err := app.sessions.GetSessionByID(sessionID, userID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.NotFound(w, r)
+				return
+			}
+			app.logger.Error("failed to fetch session series", "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		length := sessions.End_date.Sub(sessions.Start_date)
+		sessions.Start_date = series.Start_date.Add(sessions.Start_date.Sub(occurrence_date))
+		sessions.End_date = sessions.Start_date.Add(length)
+	}
+
 	// Update  session
-	err = app.sessions.EditSession(sessions)
+	err = app.sessions.EditSession(sessions, userID)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.NotFound(w, r)
+			return
+		}
 		app.logger.Error("failed to insert session", "error", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
@@ -359,13 +481,68 @@ func (app *application) showstartSessionInfo(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	// Fetch the session from DB using session_id
-	session, err := app.sessions.GetSessionByID(sessionID)
+	// An occurrence of a recurring session is studied on its own
+	date, err := occurrenceDate(r)
 	if err != nil {
+		http.Error(w, "Invalid occurrence date", http.StatusBadRequest)
+		return
+	}
+
+	data, err := app.newSessionStartData(r, sessionID, date)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.NotFound(w, r)
+			return
+		}
 		app.logger.Error("failed to fetch session for editing", "error", err)
-		http.Error(w, "Could not find session", http.StatusInternalServerError)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
+	data.Flash = app.session.PopString(r, "flash")
+
+	err = app.render(w, http.StatusOK, "session_start.tmpl", data)
+	if err != nil {
+		app.logger.Error("failed to render edit session form", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// newSessionStartData loads the session, timer and pomodoro shown on the session start page.
+// A recurring session is timed one occurrence at a time, so without a date its page has no
+// timer. A date that is not an occurrence of the session is not found.
+func (app *application) newSessionStartData(r *http.Request, sessionID int64, date time.Time) (*TemplateData, error) {
+	// Get the user ID from the session
+	userID := int64(app.session.GetInt(r, "user_id"))
+
+	// Fetch the session from DB using session_id, only if it belongs to the user
+	var session *data.Sessions
+	var err error
+	if date.IsZero() {
+		session, err = app.sessions.GetSessionByID(sessionID, userID)
+	} else {
+		session, err = app.sessions.GetOccurrence(sessionID, userID, date)
+	}
+	if errors.Is(err, data.ErrNotAnOccurrence) {
+		return nil, sql.ErrNoRows
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Fetch the timer state so the page can show the live timer
+	var timer *data.TimerState
+	if session.Rrule == "" || !date.IsZero() {
+		timer, err = app.intervals.State(sessionID, userID, date)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// A session without pomodoro settings is simply not in pomodoro mode
+	pomodoro, err := app.pomodoros.Get(sessionID, userID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
 
 	// Preload the form with current session values
 	data := NewTemplateData()
@@ -374,18 +551,20 @@ func (app *application) showstartSessionInfo(w http.ResponseWriter, r *http.Requ
 	data.IsAuthenticated = app.isAuthenticated(r)
 	data.CSRFToken = nosurf.Token(r)
 	data.FormData = map[string]string{
-		"session_id":   fmt.Sprintf("%d", session.Session_id),
-		"title":        session.Title,
-		"description":  session.Description,
-		"subject":      session.Subject,
-		"start_date":   session.Start_date.Format("2006-01-02"),
-		"end_date":     session.End_date.Format("2006-01-02"),
-		"is_completed": fmt.Sprintf("%t", session.Is_completed),
-	}
-
-	err = app.render(w, http.StatusOK, "session_start.tmpl", data)
-	if err != nil {
-		app.logger.Error("failed to render edit session form", "error", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-	}
+		"session_id":          fmt.Sprintf("%d", session.Session_id),
+		"title":               session.Title,
+		"description":         session.Description,
+		"subject":             session.Subject,
+		"start_date":          session.Start_date.Format("2006-01-02"),
+		"end_date":            session.End_date.Format("2006-01-02"),
+		"is_completed":        fmt.Sprintf("%t", session.Is_completed),
+		"completed_pomodoros": fmt.Sprintf("%d", session.Completed_pomodoros),
+	}
+	if !date.IsZero() {
+		data.FormData["occurrence_date"] = date.Format("2006-01-02")
+	}
+	data.Timer = timer
+	data.Pomodoro = pomodoro
+
+	return data, nil
 }
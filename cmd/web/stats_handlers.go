@@ -0,0 +1,101 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/abankelsey/study_helper/internal/data"
+	"github.com/abankelsey/study_helper/internal/validator"
+	"github.com/justinas/nosurf"
+)
+
+// defaultStatsDays is how many days the statistics page shows when no range is picked
+const defaultStatsDays = 30
+
+// StatsRange is a quick pick of the date range on the statistics page
+type StatsRange struct {
+	Label    string
+	From, To string
+}
+
+// statsRanges lists the quick picks for the ranges people usually want, ending today
+func statsRanges(today time.Time) []StatsRange {
+	to := today.Format(time.DateOnly)
+	return []StatsRange{
+		{"Last 7 days", today.AddDate(0, 0, -6).Format(time.DateOnly), to},
+		{"Last 30 days", today.AddDate(0, 0, -defaultStatsDays+1).Format(time.DateOnly), to},
+		{"Last 90 days", today.AddDate(0, 0, -89).Format(time.DateOnly), to},
+		{"This year", time.Date(today.Year(), 1, 1, 0, 0, 0, 0, time.UTC).Format(time.DateOnly), to},
+	}
+}
+
+// the showStats displays charts of the time studied and the goals and sessions completed
+// between ?from= and ?to=, the last 30 days by default
+func (app *application) showStats(w http.ResponseWriter, r *http.Request) {
+	// Get the user ID from the session
+	id := app.session.GetInt(r, "user_id")
+	if id == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	query := r.URL.Query()
+	formData := map[string]string{
+		"from": query.Get("from"),
+		"to":   query.Get("to"),
+	}
+	if formData["from"] == "" {
+		formData["from"] = today.AddDate(0, 0, -defaultStatsDays+1).Format(time.DateOnly)
+	}
+	if formData["to"] == "" {
+		formData["to"] = today.Format(time.DateOnly)
+	}
+
+	v := validator.NewValidator()
+	from, err := time.Parse(time.DateOnly, formData["from"])
+	if err != nil {
+		v.AddError("from", "must be a date in the format YYYY-MM-DD")
+	}
+	to, err := time.Parse(time.DateOnly, formData["to"])
+	if err != nil {
+		v.AddError("to", "must be a date in the format YYYY-MM-DD")
+	}
+	if v.ValidData() {
+		data.ValidateStatsRange(v, from, to)
+	}
+
+	var stats *data.Stats
+	status := http.StatusOK
+	if v.ValidData() {
+		stats, err = app.stats.Stats(int64(id), from, to)
+		if err != nil {
+			app.logger.Error("failed to work out statistics", "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	} else {
+		status = http.StatusUnprocessableEntity
+	}
+
+	data := NewTemplateData()
+	data.Title = "Statistics"
+	data.HeaderText = "Statistics"
+	data.IsAuthenticated = app.isAuthenticated(r)
+	data.CSRFToken = nosurf.Token(r)
+	data.FormErrors = v.Errors
+	data.FormData = formData
+	data.StatsRanges = statsRanges(today)
+	if stats != nil {
+		data.Stats = stats
+		data.Charts = newStatsCharts(stats)
+	}
+
+	err = app.render(w, status, "stats.tmpl", data)
+	if err != nil {
+		app.logger.Error("failed to render statistics page", "template", "stats.tmpl", "error", err, "url", r.URL.Path, "method", r.Method)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abankelsey/study_helper/internal/data"
+	"github.com/abankelsey/study_helper/internal/validator"
+	"github.com/justinas/nosurf"
+)
+
+// subjectNames returns the names of the logged in user's subjects for the session forms.
+// The suggestions are optional, so a failure only leaves them out.
+func (app *application) subjectNames(r *http.Request) []string {
+	names, err := app.subjects.SubjectNames(int64(app.session.GetInt(r, "user_id")))
+	if err != nil {
+		app.logger.Error("failed to fetch subject names", "error", err)
+		return nil
+	}
+	return names
+}
+
+// readSubjectForm reads a submitted subject form. Problems with the values are reported in v.
+func readSubjectForm(r *http.Request, v *validator.Validator) (*data.Subjects, map[string]string) {
+	formData := map[string]string{
+		"name":                strings.TrimSpace(r.PostForm.Get("name")),
+		"colour":              r.PostForm.Get("colour"),
+		"weekly_target_hours": strings.TrimSpace(r.PostForm.Get("weekly_target_hours")),
+	}
+
+	subject := &data.Subjects{
+		Name:   formData["name"],
+		Colour: formData["colour"],
+	}
+
+	// An empty target means the subject has no weekly target
+	if formData["weekly_target_hours"] != "" {
+		hours, err := strconv.ParseFloat(formData["weekly_target_hours"], 64)
+		if err != nil {
+			v.AddError("weekly_target_hours", "Must be a number of hours")
+		}
+		subject.Weekly_target_hours = hours
+	}
+
+	data.ValidateSubjects(v, subject)
+
+	return subject, formData
+}
+
+// the showSubjectForm handles requests to display the subject form
+func (app *application) showSubjectForm(w http.ResponseWriter, r *http.Request) {
+	// New subjects start with the default colour and no weekly target
+	formData := map[string]string{
+		"colour":              data.DefaultSubjectColour,
+		"weekly_target_hours": "0",
+	}
+
+	// Initialize template data for the subject form
+	data := NewTemplateData()
+	data.Title = "Subject"
+	data.HeaderText = "Add a Subject"
+	data.IsAuthenticated = app.isAuthenticated(r)
+	data.CSRFToken = nosurf.Token(r)
+	data.FormData = formData
+
+	err := app.render(w, http.StatusOK, "subjects.tmpl", data)
+	if err != nil {
+		app.logger.Error("failed to render subject form", "template", "subjects.tmpl", "error", err, "url", r.URL.Path, "method", r.Method)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (app *application) addSubject(w http.ResponseWriter, r *http.Request) {
+	// Parse the submitted form data
+	err := r.ParseForm()
+	if err != nil {
+		app.logger.Error("failed to parse form", "error", err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	// Get the user ID from the session
+	id := app.session.GetInt(r, "user_id")
+	if id == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	v := validator.NewValidator()
+	subject, formData := readSubjectForm(r, v)
+	subject.User_id = int64(id)
+
+	if v.ValidData() {
+		err = app.subjects.Insert(subject)
+		if errors.Is(err, data.ErrDuplicateSubject) {
+			v.AddError("name", "You already have a subject with this name")
+		} else if err != nil {
+			app.logger.Error("failed to insert subject", "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// If validation fails, re-render the form with error messages
+	if !v.ValidData() {
+		data := NewTemplateData()
+		data.Title = "Subject"
+		data.HeaderText = "Add a Subject"
+		data.IsAuthenticated = app.isAuthenticated(r)
+		data.CSRFToken = nosurf.Token(r)
+		data.FormErrors = v.Errors
+		data.FormData = formData
+
+		err := app.render(w, http.StatusUnprocessableEntity, "subjects.tmpl", data)
+		if err != nil {
+			app.logger.Error("failed to render subject form", "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		return
+	}
+
+	app.session.Put(r, "flash", "Subject Successfully Added")
+
+	http.Redirect(w, r, "/subjects", http.StatusSeeOther)
+}
+
+// the listSubjects displays the user's subjects with the hours planned and studied this week
+func (app *application) listSubjects(w http.ResponseWriter, r *http.Request) {
+	// Get the user ID from the session
+	id := app.session.GetInt(r, "user_id")
+	if id == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	weekStart := data.StartOfWeek(time.Now())
+
+	subjects, err := app.subjects.SubjectList(int64(id), weekStart)
+	if err != nil {
+		app.logger.Error("failed to fetch subjects", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	//Get/Check for the flash message
+	flash := app.session.PopString(r, "flash")
+
+	data := NewTemplateData()
+	data.Title = "Subjects"
+	data.HeaderText = "Subjects"
+	data.IsAuthenticated = app.isAuthenticated(r)
+	data.CSRFToken = nosurf.Token(r)
+	data.SubjectList = subjects
+	data.CurrentTime = weekStart
+	data.Flash = flash
+
+	err = app.render(w, http.StatusOK, "subjects_list.tmpl", data)
+	if err != nil {
+		app.logger.Error("failed to render subject list", "template", "subjects_list.tmpl", "error", err, "url", r.URL.Path, "method", r.Method)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// the deleteSubject will delete a subject that no session uses
+func (app *application) deleteSubject(w http.ResponseWriter, r *http.Request) {
+	// Check and parse user ID from session
+	id := app.session.GetInt(r, "user_id")
+	if id == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "Unable to parse form", http.StatusBadRequest)
+		return
+	}
+
+	subjectID, err := strconv.ParseInt(r.FormValue("subject_id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid subject ID", http.StatusBadRequest)
+		return
+	}
+
+	err = app.subjects.DeleteSubject(subjectID, int64(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			http.NotFound(w, r)
+		case errors.Is(err, data.ErrSubjectInUse):
+			app.session.Put(r, "flash", "This subject still has sessions. Move or delete them first.")
+			http.Redirect(w, r, "/subjects", http.StatusSeeOther)
+		default:
+			app.logger.Error("failed to delete subject", "error", err)
+			http.Error(w, "Could not delete subject", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	http.Redirect(w, r, "/subjects", http.StatusSeeOther)
+}
+
+// the showeditSubjectForm handles requests to display the subject form to edit
+func (app *application) showeditSubjectForm(w http.ResponseWriter, r *http.Request) {
+	subjectIDStr := r.URL.Query().Get("subject_id")
+	subjectID, err := strconv.ParseInt(subjectIDStr, 10, 64)
+	if err != nil {
+		app.logger.Error("invalid subject_id", "value", subjectIDStr)
+		http.Error(w, "Invalid subject ID", http.StatusBadRequest)
+		return
+	}
+
+	// Fetch the subject, only if it belongs to the user
+	subject, err := app.subjects.GetSubjectByID(subjectID, int64(app.session.GetInt(r, "user_id")))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.NotFound(w, r)
+			return
+		}
+		app.logger.Error("failed to fetch subject for editing", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// Preload the form with current subject values
+	data := NewTemplateData()
+	data.Title = "Edit Subject"
+	data.HeaderText = "Edit Subject"
+	data.IsAuthenticated = app.isAuthenticated(r)
+	data.CSRFToken = nosurf.Token(r)
+	data.FormData = map[string]string{
+		"subject_id":          fmt.Sprintf("%d", subject.Subject_id),
+		"name":                subject.Name,
+		"colour":              subject.Colour,
+		"weekly_target_hours": strconv.FormatFloat(subject.Weekly_target_hours, 'f', -1, 64),
+	}
+
+	err = app.render(w, http.StatusOK, "edit_subject.tmpl", data)
+	if err != nil {
+		app.logger.Error("failed to render edit subject form", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// editSubject will update a subject. Its sessions keep pointing at it under the new name.
+func (app *application) editSubject(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.logger.Error("failed to parse form", "error", err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	subjectIDStr := r.PostForm.Get("subject_id")
+	subjectID, err := strconv.ParseInt(subjectIDStr, 10, 64)
+	if err != nil {
+		app.logger.Error("invalid subject_id", "value", subjectIDStr)
+		http.Error(w, "Invalid subject ID", http.StatusBadRequest)
+		return
+	}
+
+	v := validator.NewValidator()
+	subject, formData := readSubjectForm(r, v)
+	subject.Subject_id = subjectID
+	formData["subject_id"] = subjectIDStr
+
+	if v.ValidData() {
+		err = app.subjects.EditSubject(subject, int64(app.session.GetInt(r, "user_id")))
+		switch {
+		case err == nil:
+		case errors.Is(err, data.ErrDuplicateSubject):
+			v.AddError("name", "You already have a subject with this name")
+		case errors.Is(err, sql.ErrNoRows):
+			http.NotFound(w, r)
+			return
+		default:
+			app.logger.Error("failed to update subject", "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// If validation fails, re-render the form with error messages
+	if !v.ValidData() {
+		data := NewTemplateData()
+		data.Title = "Edit Subject"
+		data.HeaderText = "Edit Subject"
+		data.IsAuthenticated = app.isAuthenticated(r)
+		data.CSRFToken = nosurf.Token(r)
+		data.FormErrors = v.Errors
+		data.FormData = formData
+
+		err := app.render(w, http.StatusUnprocessableEntity, "edit_subject.tmpl", data)
+		if err != nil {
+			app.logger.Error("failed to render edit subject form", "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		return
+	}
+
+	http.Redirect(w, r, "/subjects", http.StatusSeeOther)
+}
@@ -2,22 +2,54 @@ package main
 
 import (
 	"github.com/abankelsey/study_helper/internal/data"
+	"html/template"
 	"time"
 )
 
 type TemplateData struct {
-	Title           string
-	CSRFToken       string
-	HeaderText      string
-	FormErrors      map[string]string
-	FormData        map[string]string
-	GoalList        []*data.Goals    //stores the list of goal entries
-	SessionList     []*data.Sessions //stores the list of session entries
-	QuoteList       []*data.Quotes   //stores the list of quote entries
-	RandomQuote     *data.Quotes
-	CurrentTime     time.Time
-	Flash           string
-	IsAuthenticated bool
+	Title            string
+	CSRFToken        string
+	HeaderText       string
+	FormErrors       map[string]string
+	FormData         map[string]string
+	GoalList         []*data.Goals         //stores the list of goal entries
+	Goal             *data.Goals           //the goal whose page is shown
+	GoalItems        []*data.GoalItems     //the checklist of the goal
+	GoalRollOvers    []*data.GoalRollOvers //the times the goal was carried over or marked missed
+	GoalGroups       []*GoalGroup          //the groups of the goal list, or the columns of the board
+	GoalCategories   []string              //the user's goal categories, suggested on the goal forms
+	SessionList      []*data.Sessions      //stores the list of session entries
+	QuoteList        []*data.Quotes        //stores the list of quote entries
+	SubjectList      []*data.Subjects      //stores the list of subjects
+	SubjectNames     []string              //the user's subjects, suggested on the session forms
+	Page             data.Metadata         //the page of the list being shown
+	NextPageURL      string                //empty on the last page
+	FirstPageURL     string                //only set when the list is not on its first page
+	Search           *data.Search          //the results of a search, nil until something is searched for
+	Stats            *data.Stats           //the statistics of the picked date range
+	Charts           *StatsCharts          //the statistics laid out as charts
+	StatsRanges      []StatsRange          //the quick picks of the statistics date range
+	RandomQuote      *data.Quotes
+	Streaks          *data.Streaks    //the user's streaks of days with something completed
+	Heatmap          *Heatmap         //the past year of completed goals and sessions
+	Timer            *data.TimerState //the timer state of the session being studied
+	Pomodoro         *data.Pomodoros  //the pomodoro progress of the session being studied
+	CalendarToken    *data.CalendarTokens
+	CalendarFeedURL  string        //only set right after a new feed token is created
+	ImportItems      []*ImportItem //the items found in an uploaded calendar file
+	APITokens        []*data.Tokens
+	NewAPIToken      string //only set right after a personal API token is created
+	TwoFactor        *data.TwoFactor
+	TOTPSecret       string              //the secret being enrolled, for typing into an authenticator app
+	TOTPURI          string              //the otpauth:// provisioning URI of the secret being enrolled
+	TOTPQRCode       template.URL        //the provisioning URI as a PNG data URL
+	RecoveryCodes    []string            //only set right after recovery codes are issued
+	UserSessions     []*data.UserSession //the browsers the user is logged in on
+	CurrentSessionID int64               //the session of the browser viewing the page
+	User             *data.Users
+	CurrentTime      time.Time
+	Flash            string
+	IsAuthenticated  bool
 }
 
 func NewTemplateData() *TemplateData {
@@ -29,6 +61,7 @@ func NewTemplateData() *TemplateData {
 		GoalList:    []*data.Goals{},    // Initialize the list as an empty slice
 		QuoteList:   []*data.Quotes{},   // Initialize the list as an empty slice
 		SessionList: []*data.Sessions{}, // Initialize the list as an empty slice
+		SubjectList: []*data.Subjects{}, // Initialize the list as an empty slice
 		CSRFToken:   "",
 	}
 }
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abankelsey/study_helper/internal/data"
+	"github.com/abankelsey/study_helper/internal/throttle"
+	"github.com/justinas/nosurf"
+)
+
+// emailThrottlePolicy slows down password guessing against one account. After the
+// lockout the owner is emailed a link to unlock it.
+var emailThrottlePolicy = throttle.Policy{
+	FreeAttempts:    3,
+	BaseDelay:       2 * time.Second,
+	MaxDelay:        5 * time.Minute,
+	LockoutAfter:    10,
+	LockoutDuration: 30 * time.Minute,
+	Window:          time.Hour,
+}
+
+// ipThrottlePolicy slows down one client trying passwords across many accounts.
+// It allows more failures, since several people can share an address.
+var ipThrottlePolicy = throttle.Policy{
+	FreeAttempts:    20,
+	BaseDelay:       time.Second,
+	MaxDelay:        5 * time.Minute,
+	LockoutAfter:    100,
+	LockoutDuration: time.Hour,
+	Window:          2 * time.Hour,
+}
+
+// loginAttemptsPruneInterval is how often old failure counts are deleted
+const loginAttemptsPruneInterval = 10 * time.Minute
+
+// emailThrottleKey returns the throttle key of an email address
+func emailThrottleKey(email string) string {
+	return "email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+// ipThrottleKey returns the throttle key of the client that sent the request
+func ipThrottleKey(r *http.Request) string {
+	return "ip:" + clientIP(r)
+}
+
+// clientIP returns the address of the client without the port
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// formatWait describes a wait in words, rounded up
+func formatWait(d time.Duration) string {
+	if d < time.Minute {
+		seconds := int(math.Ceil(d.Seconds()))
+		if seconds == 1 {
+			return "1 second"
+		}
+		return fmt.Sprintf("%d seconds", seconds)
+	}
+
+	minutes := int(math.Ceil(d.Minutes()))
+	if minutes == 1 {
+		return "1 minute"
+	}
+	return fmt.Sprintf("%d minutes", minutes)
+}
+
+// tooManyLoginAttempts re-renders the login form with a 429 and a Retry-After header
+func (app *application) tooManyLoginAttempts(w http.ResponseWriter, r *http.Request, email string, wait time.Duration, locked bool) {
+	message := "Too many failed login attempts. Try again in " + formatWait(wait) + "."
+	if locked {
+		message = "Logging in to this account is paused after too many failed attempts. Use the unlock link emailed to the owner, or try again in " + formatWait(wait) + "."
+	}
+
+	data := NewTemplateData()
+	data.Title = "Login"
+	data.HeaderText = "Login"
+	data.IsAuthenticated = app.isAuthenticated(r)
+	data.CSRFToken = nosurf.Token(r)
+	data.FormErrors = map[string]string{
+		"generic": message,
+	}
+	data.FormData = map[string]string{
+		"email": email,
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+
+	err := app.render(w, http.StatusTooManyRequests, "login.tmpl", data)
+	if err != nil {
+		app.logger.Error("failed to render login form", "template", "login.tmpl", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// loginAttempt is a login attempt counted against the client and the email before the
+// password is checked
+type loginAttempt struct {
+	email      string
+	ipEntry    throttle.Entry
+	emailEntry throttle.Entry
+	// how long the client must wait when the attempt was refused, and whether that is
+	// because the account is locked
+	wait   time.Duration
+	locked bool
+}
+
+// reserveLogin counts a login attempt before the password is checked, so that parallel
+// guesses can not all get past the backoff before any of them is recorded. A refused
+// attempt has a wait and is not counted.
+func (app *application) reserveLogin(r *http.Request, email string) (*loginAttempt, error) {
+	a := &loginAttempt{email: email}
+
+	wait, entry, err := app.ipThrottle.Reserve(r.Context(), ipThrottleKey(r))
+	if err != nil {
+		return nil, err
+	}
+	if wait > 0 {
+		a.wait = wait
+		return a, nil
+	}
+	a.ipEntry = entry
+
+	wait, entry, err = app.emailThrottle.Reserve(r.Context(), emailThrottleKey(email))
+	if err != nil {
+		return nil, err
+	}
+	if wait > 0 {
+		a.wait, a.locked = wait, app.emailThrottle.Policy.Locked(entry)
+
+		// The password is not checked, so the attempt does not count against the client
+		err = app.ipThrottle.Release(r.Context(), ipThrottleKey(r))
+		return a, err
+	}
+	a.emailEntry = entry
+
+	return a, nil
+}
+
+// loginSucceeded takes back the attempt once the password was right, and forgets the
+// earlier typos against the account
+func (app *application) loginSucceeded(r *http.Request, a *loginAttempt) error {
+	err := app.ipThrottle.Release(r.Context(), ipThrottleKey(r))
+	if err != nil {
+		return err
+	}
+	return app.emailThrottle.Reset(r.Context(), emailThrottleKey(a.email))
+}
+
+// loginFailed logs a wrong password, which reserveLogin already counted. When the
+// account became locked, its owner is emailed an unlock link.
+func (app *application) loginFailed(r *http.Request, a *loginAttempt) {
+	email, ip := a.email, clientIP(r)
+
+	app.logger.Warn("failed login attempt", "email", email, "ip", ip, "email_failures", a.emailEntry.Failures, "ip_failures", a.ipEntry.Failures)
+
+	if app.ipThrottle.Policy.Locked(a.ipEntry) {
+		app.logger.Warn("client locked out of logging in", "ip", ip, "failures", a.ipEntry.Failures)
+	}
+
+	if !app.emailThrottle.Policy.Locked(a.emailEntry) {
+		return
+	}
+
+	app.logger.Warn("account locked after failed logins", "email", email, "ip", ip, "failures", a.emailEntry.Failures)
+	app.sendUnlockEmailInBackground(r, email)
+}
+
+// sendUnlockEmailInBackground emails the owner of a locked account an unlock link. Looking
+// up the account and emailing happen after the response, so the reply does not show
+// whether the email belongs to an account.
+func (app *application) sendUnlockEmailInBackground(r *http.Request, email string) {
+	host := r.Host
+	app.background(func() {
+		user, err := app.users.GetByEmail(email)
+		if err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				app.logger.Error("failed to fetch user", "error", err)
+			}
+			return
+		}
+
+		err = app.sendUnlockEmail(user, host)
+		if err != nil {
+			app.logger.Error("failed to send unlock email", "user_id", user.User_id, "error", err)
+		}
+	})
+}
+
+// checkPassword checks the password of a signed in user on a form that asks for it again.
+// Wrong passwords count against the account the same as failed logins, so a stolen session
+// can not be used to guess it. It returns how long to wait when too many were wrong.
+func (app *application) checkPassword(r *http.Request, userID int64, password string) (bool, time.Duration, error) {
+	user, err := app.users.GetUser(userID)
+	if err != nil {
+		return false, 0, err
+	}
+	key := emailThrottleKey(user.Email)
+
+	wait, entry, err := app.emailThrottle.Reserve(r.Context(), key)
+	if err != nil || wait > 0 {
+		return false, wait, err
+	}
+
+	ok, err := app.users.MatchesPassword(userID, password)
+	if err != nil {
+		return false, 0, err
+	}
+	if ok {
+		return true, 0, app.emailThrottle.Reset(r.Context(), key)
+	}
+
+	app.logger.Warn("wrong password of a signed in user", "user_id", userID, "ip", clientIP(r), "failures", entry.Failures)
+	if app.emailThrottle.Policy.Locked(entry) {
+		app.logger.Warn("account locked after wrong passwords", "user_id", userID, "failures", entry.Failures)
+		app.sendUnlockEmailInBackground(r, user.Email)
+	}
+
+	return false, 0, nil
+}
+
+// pruneLoginAttempts deletes failure counts that no longer slow anyone down, every interval
+// until ctx is cancelled
+func (app *application) pruneLoginAttempts(ctx context.Context) {
+	window := max(app.emailThrottle.Policy.Window, app.ipThrottle.Policy.Window, app.twoFactorThrottle.Policy.Window)
+
+	ticker := time.NewTicker(loginAttemptsPruneInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		pruneCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+		err := app.emailThrottle.Store.Prune(pruneCtx, time.Now().Add(-window))
+		cancel()
+		if err != nil && ctx.Err() == nil {
+			app.logger.Error("failed to prune login attempts", "error", err)
+		}
+	}
+}
+
+// the unlockUser unlocks the account of the emailed link's token
+func (app *application) unlockUser(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+
+	user, err := app.users.GetForToken(data.ScopeUnlock, token)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			app.session.Put(r, "flash", "This unlock link is invalid or has expired")
+			http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+			return
+		}
+		app.logger.Error("failed to fetch user for unlock token", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	err = app.emailThrottle.Reset(r.Context(), emailThrottleKey(user.Email))
+	if err != nil {
+		app.logger.Error("failed to reset login throttle", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	err = app.userTokens.DeleteAllForUser(data.ScopeUnlock, user.User_id)
+	if err != nil {
+		app.logger.Error("failed to delete unlock tokens", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	app.logger.Info("account unlocked", "user_id", user.User_id, "ip", clientIP(r))
+	app.session.Put(r, "flash", "Your account is unlocked, you can log in now")
+
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
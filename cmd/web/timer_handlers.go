@@ -0,0 +1,137 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/abankelsey/study_helper/internal/data"
+)
+
+// occurrenceDate reads the occurrence of a recurring session a request is about. It is the
+// zero time when the request names none, as for a one-off session.
+func occurrenceDate(r *http.Request) (time.Time, error) {
+	value := r.FormValue("occurrence_date")
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+// sessionStartURL is the start page of a session, or of its occurrence on date
+func sessionStartURL(sessionID int64, date time.Time) string {
+	if date.IsZero() {
+		return fmt.Sprintf("/sessions/start?session_id=%d", sessionID)
+	}
+	return fmt.Sprintf("/sessions/start?session_id=%d&occurrence_date=%s", sessionID, date.Format("2006-01-02"))
+}
+
+// the sessionTimerStatus returns the current timer state of a session, or of one occurrence
+// of a recurring session, as JSON
+func (app *application) sessionTimerStatus(w http.ResponseWriter, r *http.Request) {
+	// Get the user ID from the session
+	id := app.session.GetInt(r, "user_id")
+	if id == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userID := int64(id)
+
+	sessionIDStr := r.PathValue("id")
+	sessionID, err := strconv.ParseInt(sessionIDStr, 10, 64)
+	if err != nil {
+		app.logger.Error("invalid session_id", "value", sessionIDStr)
+		http.Error(w, "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+
+	date, err := occurrenceDate(r)
+	if err != nil {
+		http.Error(w, "Invalid occurrence date", http.StatusBadRequest)
+		return
+	}
+
+	state, err := app.intervals.State(sessionID, userID, date)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) || errors.Is(err, data.ErrNotAnOccurrence) {
+			http.NotFound(w, r)
+			return
+		}
+		app.logger.Error("failed to fetch timer state", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(state)
+	if err != nil {
+		app.logger.Error("failed to write timer state", "error", err)
+	}
+}
+
+// the sessionTimerAction handles start, pause, resume and stop requests for a session timer
+func (app *application) sessionTimerAction(w http.ResponseWriter, r *http.Request) {
+	// Get the user ID from the session
+	id := app.session.GetInt(r, "user_id")
+	if id == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userID := int64(id)
+
+	sessionIDStr := r.PathValue("id")
+	sessionID, err := strconv.ParseInt(sessionIDStr, 10, 64)
+	if err != nil {
+		app.logger.Error("invalid session_id", "value", sessionIDStr)
+		http.Error(w, "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+
+	// Each occurrence of a recurring session has its own timer
+	date, err := occurrenceDate(r)
+	if err != nil {
+		http.Error(w, "Invalid occurrence date", http.StatusBadRequest)
+		return
+	}
+
+	action := r.PathValue("action")
+	switch action {
+	case "start":
+		err = app.intervals.Start(sessionID, userID, date)
+	case "pause":
+		err = app.intervals.Pause(sessionID, userID, date)
+	case "resume":
+		err = app.intervals.Resume(sessionID, userID, date)
+	case "stop":
+		err = app.intervals.Stop(sessionID, userID, date)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows), errors.Is(err, data.ErrNotAnOccurrence):
+			http.NotFound(w, r)
+		case errors.Is(err, data.ErrTimerInvalidAction):
+			app.session.Put(r, "flash", fmt.Sprintf("The timer cannot %s right now", action))
+			http.Redirect(w, r, sessionStartURL(sessionID, date), http.StatusSeeOther)
+		default:
+			app.logger.Error("failed to update session timer", "action", action, "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	app.logger.Info("session timer updated", "session_id", sessionID, "occurrence_date", r.FormValue("occurrence_date"), "action", action)
+
+	if action == "stop" {
+		app.session.Put(r, "flash", "Session stopped and marked as completed")
+	}
+
+	http.Redirect(w, r, sessionStartURL(sessionID, date), http.StatusSeeOther)
+}
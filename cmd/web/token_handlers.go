@@ -0,0 +1,113 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/abankelsey/study_helper/internal/data"
+	"github.com/abankelsey/study_helper/internal/validator"
+)
+
+// the createAPIToken mints a named personal API token with the chosen access per resource
+func (app *application) createAPIToken(w http.ResponseWriter, r *http.Request) {
+	// Get the user ID from the session
+	id := app.session.GetInt(r, "user_id")
+	if id == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userID := int64(id)
+
+	err := r.ParseForm()
+	if err != nil {
+		app.logger.Error("failed to parse form", "error", err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	token := &data.Tokens{
+		User_id: userID,
+		Name:    r.PostForm.Get("name"),
+	}
+
+	// Each resource is given "none", "read" or "write" access, write includes read
+	formData := map[string]string{
+		"name": token.Name,
+	}
+	for _, resource := range data.TokenResources {
+		access := r.PostForm.Get("scope_" + resource)
+		formData["scope_"+resource] = access
+		switch access {
+		case "read":
+			token.Scopes = append(token.Scopes, resource+":read")
+		case "write":
+			token.Scopes = append(token.Scopes, resource+":read", resource+":write")
+		}
+	}
+
+	v := validator.NewValidator()
+	data.ValidateTokens(v, token)
+	if !v.ValidData() {
+		data, err := app.newAccountData(r, userID)
+		if err != nil {
+			app.logger.Error("failed to load account page", "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		data.FormErrors = v.Errors
+		data.FormData = formData
+
+		err = app.render(w, http.StatusUnprocessableEntity, "account.tmpl", data)
+		if err != nil {
+			app.logger.Error("failed to render account page", "template", "account.tmpl", "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	err = app.tokens.Insert(token)
+	if err != nil {
+		app.logger.Error("failed to create API token", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// The token is only stored hashed, so it can only be shown this once
+	app.session.Put(r, "api_token", token.Plaintext)
+	app.session.Put(r, "flash", "API token created, copy it now as it will not be shown again")
+
+	http.Redirect(w, r, "/account", http.StatusSeeOther)
+}
+
+// the revokeAPIToken deletes a personal API token so clients using it are locked out
+func (app *application) revokeAPIToken(w http.ResponseWriter, r *http.Request) {
+	// Get the user ID from the session
+	id := app.session.GetInt(r, "user_id")
+	if id == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	tokenID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || tokenID < 1 {
+		http.NotFound(w, r)
+		return
+	}
+
+	err = app.tokens.Revoke(tokenID, int64(id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.NotFound(w, r)
+			return
+		}
+		app.logger.Error("failed to revoke API token", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	app.session.Put(r, "flash", "API token revoked")
+
+	http.Redirect(w, r, "/account", http.StatusSeeOther)
+}
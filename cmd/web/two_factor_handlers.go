@@ -0,0 +1,392 @@
+package main
+
+import (
+	"encoding/base64"
+	"html/template"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abankelsey/study_helper/internal/data"
+	"github.com/abankelsey/study_helper/internal/throttle"
+	"github.com/abankelsey/study_helper/internal/totp"
+	"github.com/justinas/nosurf"
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// twoFactorLoginWindow is how long the user has to enter their code after the password
+const twoFactorLoginWindow = 5 * time.Minute
+
+// twoFactorThrottlePolicy slows down guessing the code of the second login step. The
+// count is kept on the server against the user, so starting the login again does not
+// start it again.
+var twoFactorThrottlePolicy = throttle.Policy{
+	FreeAttempts:    3,
+	BaseDelay:       2 * time.Second,
+	MaxDelay:        5 * time.Minute,
+	LockoutAfter:    10,
+	LockoutDuration: 30 * time.Minute,
+	Window:          time.Hour,
+}
+
+// twoFactorThrottleKey returns the throttle key of the codes entered for a user
+func twoFactorThrottleKey(userID int64) string {
+	return "2fa:" + strconv.FormatInt(userID, 10)
+}
+
+// verifySecondFactor checks a code from the authenticator app, or else a recovery code.
+// Each code only works once.
+func (app *application) verifySecondFactor(twoFactor *data.TwoFactor, code string) (bool, error) {
+	if step, ok := totp.Validate(twoFactor.Secret, code, time.Now()); ok {
+		return app.twoFactor.UseStep(twoFactor.User_id, step)
+	}
+	return app.twoFactor.UseRecoveryCode(twoFactor.User_id, code)
+}
+
+// newTwoFactorData loads the two-factor page. While two-factor authentication is off,
+// a secret to enroll is kept in the session until the first code is verified.
+func (app *application) newTwoFactorData(r *http.Request, userID int64) (*TemplateData, error) {
+	twoFactor, err := app.twoFactor.Get(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	data := NewTemplateData()
+	data.Title = "Two-Factor Authentication"
+	data.HeaderText = "Two-Factor Authentication"
+	data.IsAuthenticated = app.isAuthenticated(r)
+	data.CSRFToken = nosurf.Token(r)
+	data.TwoFactor = twoFactor
+
+	if !twoFactor.Enabled {
+		secret := app.session.GetString(r, "totp_pending_secret")
+		if secret == "" {
+			secret, err = totp.GenerateSecret()
+			if err != nil {
+				return nil, err
+			}
+			app.session.Put(r, "totp_pending_secret", secret)
+		}
+
+		uri := totp.URI(secret, "Study Helper", twoFactor.Email)
+		png, err := qrcode.Encode(uri, qrcode.Medium, 256)
+		if err != nil {
+			return nil, err
+		}
+
+		data.TOTPSecret = secret
+		data.TOTPURI = uri
+		data.TOTPQRCode = template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(png))
+	}
+
+	return data, nil
+}
+
+// renderTwoFactor shows the two-factor page, with an error on the code field when message is set
+func (app *application) renderTwoFactor(w http.ResponseWriter, r *http.Request, status int, message string) {
+	data, err := app.newTwoFactorData(r, int64(app.session.GetInt(r, "user_id")))
+	if err != nil {
+		app.logger.Error("failed to load two-factor page", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	data.Flash = app.session.PopString(r, "flash")
+	if message != "" {
+		data.FormErrors["code"] = message
+	}
+
+	// Recovery codes are only stored hashed, so they can only be shown this once
+	if codes := app.session.PopString(r, "recovery_codes"); codes != "" {
+		data.RecoveryCodes = strings.Fields(codes)
+	}
+
+	err = app.render(w, status, "two_factor.tmpl", data)
+	if err != nil {
+		app.logger.Error("failed to render two-factor page", "template", "two_factor.tmpl", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// the showTwoFactor handles requests to display the two-factor settings and enrollment page
+func (app *application) showTwoFactor(w http.ResponseWriter, r *http.Request) {
+	app.renderTwoFactor(w, r, http.StatusOK, "")
+}
+
+// the enableTwoFactor turns on two-factor authentication once the first code from the app checks out
+func (app *application) enableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	// Get the user ID from the session
+	id := app.session.GetInt(r, "user_id")
+	if id == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		app.logger.Error("failed to parse form", "error", err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	secret := app.session.GetString(r, "totp_pending_secret")
+	if secret == "" {
+		http.Redirect(w, r, "/account/2fa", http.StatusSeeOther)
+		return
+	}
+
+	step, ok := totp.Validate(secret, r.PostForm.Get("code"), time.Now())
+	if !ok {
+		app.renderTwoFactor(w, r, http.StatusUnprocessableEntity, "That code is not right, check the time on your device and try again")
+		return
+	}
+
+	codes, err := app.twoFactor.Enable(int64(id), secret, step)
+	if err != nil {
+		app.logger.Error("failed to enable two-factor authentication", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	app.logger.Info("two-factor authentication enabled", "user_id", id)
+	app.session.Remove(r, "totp_pending_secret")
+	app.session.Put(r, "recovery_codes", strings.Join(codes, " "))
+	app.session.Put(r, "flash", "Two-factor authentication is on. Save your recovery codes now, they will not be shown again")
+
+	http.Redirect(w, r, "/account/2fa", http.StatusSeeOther)
+}
+
+// the disableTwoFactor turns off two-factor authentication after checking a current code
+func (app *application) disableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	twoFactor, ok := app.confirmSecondFactor(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.twoFactor.Disable(twoFactor.User_id)
+	if err != nil {
+		app.logger.Error("failed to disable two-factor authentication", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	app.logger.Info("two-factor authentication disabled", "user_id", twoFactor.User_id)
+	app.session.Put(r, "flash", "Two-factor authentication is off")
+
+	http.Redirect(w, r, "/account/2fa", http.StatusSeeOther)
+}
+
+// the regenerateRecoveryCodes replaces the recovery codes after checking a current code
+func (app *application) regenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	twoFactor, ok := app.confirmSecondFactor(w, r)
+	if !ok {
+		return
+	}
+
+	codes, err := app.twoFactor.RegenerateRecoveryCodes(twoFactor.User_id)
+	if err != nil {
+		app.logger.Error("failed to regenerate recovery codes", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	app.session.Put(r, "recovery_codes", strings.Join(codes, " "))
+	app.session.Put(r, "flash", "New recovery codes created, the old ones no longer work. Save them now, they will not be shown again")
+
+	http.Redirect(w, r, "/account/2fa", http.StatusSeeOther)
+}
+
+// confirmSecondFactor checks the code posted to change the settings of an account
+// with two-factor authentication on, answering the request itself when it does not pass
+func (app *application) confirmSecondFactor(w http.ResponseWriter, r *http.Request) (*data.TwoFactor, bool) {
+	// Get the user ID from the session
+	id := app.session.GetInt(r, "user_id")
+	if id == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		app.logger.Error("failed to parse form", "error", err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return nil, false
+	}
+
+	twoFactor, err := app.twoFactor.Get(int64(id))
+	if err != nil {
+		app.logger.Error("failed to fetch two-factor settings", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return nil, false
+	}
+	if !twoFactor.Enabled {
+		http.Redirect(w, r, "/account/2fa", http.StatusSeeOther)
+		return nil, false
+	}
+
+	ok, err := app.verifySecondFactor(twoFactor, r.PostForm.Get("code"))
+	if err != nil {
+		app.logger.Error("failed to verify two-factor code", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return nil, false
+	}
+	if !ok {
+		app.renderTwoFactor(w, r, http.StatusUnprocessableEntity, "That code is not right")
+		return nil, false
+	}
+
+	return twoFactor, true
+}
+
+// pendingTwoFactorUser returns the user who entered their password and still has to
+// enter a code, or 0 when there is none or they took too long
+func (app *application) pendingTwoFactorUser(r *http.Request) int64 {
+	id := app.session.GetInt(r, "2fa_user_id")
+	started := time.Unix(int64(app.session.GetInt(r, "2fa_started_at")), 0)
+
+	if id == 0 || time.Since(started) > twoFactorLoginWindow {
+		app.clearTwoFactorLogin(r)
+		return 0
+	}
+	return int64(id)
+}
+
+// clearTwoFactorLogin forgets a half finished two-step login
+func (app *application) clearTwoFactorLogin(r *http.Request) {
+	app.session.Remove(r, "2fa_user_id")
+	app.session.Remove(r, "2fa_started_at")
+}
+
+// renderTwoFactorLoginError shows the code page again with an error
+func (app *application) renderTwoFactorLoginError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	data := NewTemplateData()
+	data.Title = "Login"
+	data.HeaderText = "Two-Factor Authentication"
+	data.IsAuthenticated = app.isAuthenticated(r)
+	data.CSRFToken = nosurf.Token(r)
+	data.FormErrors = map[string]string{
+		"code": message,
+	}
+
+	err := app.render(w, status, "login_2fa.tmpl", data)
+	if err != nil {
+		app.logger.Error("failed to render two-factor login page", "template", "login_2fa.tmpl", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// the showLoginTwoFactorForm handles requests to display the second step of the login
+func (app *application) showLoginTwoFactorForm(w http.ResponseWriter, r *http.Request) {
+	if app.pendingTwoFactorUser(r) == 0 {
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	data := NewTemplateData()
+	data.Title = "Login"
+	data.HeaderText = "Two-Factor Authentication"
+	data.IsAuthenticated = app.isAuthenticated(r)
+	data.CSRFToken = nosurf.Token(r)
+
+	err := app.render(w, http.StatusOK, "login_2fa.tmpl", data)
+	if err != nil {
+		app.logger.Error("failed to render two-factor login page", "template", "login_2fa.tmpl", "error", err, "url", r.URL.Path, "method", r.Method)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// the loginTwoFactor checks the code of the second login step and logs the user in
+func (app *application) loginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID := app.pendingTwoFactorUser(r)
+	if userID == 0 {
+		app.session.Put(r, "flash", "Your login timed out, please enter your password again")
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		app.logger.Error("failed to parse form", "error", err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	twoFactor, err := app.twoFactor.Get(userID)
+	if err != nil {
+		app.logger.Error("failed to fetch two-factor settings", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// The code is counted before it is checked, so parallel guesses can not all get past
+	// the backoff, and taken back if it was right
+	key := twoFactorThrottleKey(userID)
+	wait, entry, err := app.twoFactorThrottle.Reserve(r.Context(), key)
+	if err != nil {
+		app.logger.Error("failed to check two-factor throttle", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if wait > 0 {
+		app.logger.Warn("two-factor login throttled", "user_id", userID, "ip", clientIP(r), "retry_after", wait.Round(time.Second).String())
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		app.renderTwoFactorLoginError(w, r, http.StatusTooManyRequests, "Too many wrong codes. Try again in "+formatWait(wait)+".")
+		return
+	}
+
+	ok, err := app.verifySecondFactor(twoFactor, r.PostForm.Get("code"))
+	if err != nil {
+		app.logger.Error("failed to verify two-factor code", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if !ok {
+		// Wrong codes count against the client the same as wrong passwords
+		ipEntry, err := app.ipThrottle.Fail(r.Context(), ipThrottleKey(r))
+		if err != nil {
+			app.logger.Error("failed to record two-factor failure", "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		app.logger.Warn("wrong two-factor code", "user_id", userID, "ip", clientIP(r), "failures", entry.Failures, "ip_failures", ipEntry.Failures)
+
+		if app.twoFactorThrottle.Policy.Locked(entry) {
+			app.logger.Warn("two-factor login locked after wrong codes", "user_id", userID, "failures", entry.Failures)
+			app.clearTwoFactorLogin(r)
+			app.session.Put(r, "flash", "Too many wrong codes. Logging in to this account is paused for "+formatWait(twoFactorThrottlePolicy.LockoutDuration))
+			http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+			return
+		}
+
+		app.renderTwoFactorLoginError(w, r, http.StatusUnauthorized, "That code is not right")
+		return
+	}
+
+	err = app.twoFactorThrottle.Reset(r.Context(), key)
+	if err != nil {
+		app.logger.Error("failed to reset two-factor throttle", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	sessionVersion, err := app.users.SessionVersion(userID)
+	if err != nil {
+		app.logger.Error("failed to fetch session version", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	app.clearTwoFactorLogin(r)
+	err = app.logIn(r, userID, sessionVersion)
+	if err != nil {
+		app.logger.Error("failed to create session", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// Redirect to the homepage
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
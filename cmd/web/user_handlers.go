@@ -56,6 +56,15 @@ func (app *application) home(w http.ResponseWriter, r *http.Request) {
 		data.RandomQuote = quotes[randomIndex] // assuming Quote is a struct
 	}
 
+	streaks, heatmap, err := app.userStreaks(userID)
+	if err != nil {
+		app.logger.Error("failed to work out streaks", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	data.Streaks = streaks
+	data.Heatmap = heatmap
+
 	data.CurrentTime = time.Now()
 
 	// Render the home page template
@@ -106,7 +115,7 @@ func (app *application) signupUser(w http.ResponseWriter, r *http.Request) {
 	users := &data.Users{
 		Name:      name,
 		Email:     email,
-		Activated: true,
+		Activated: false,
 	}
 
 	// Validate form data
@@ -137,11 +146,42 @@ func (app *application) signupUser(w http.ResponseWriter, r *http.Request) {
 	// Insert user into the database
 	err = app.users.Insert(users, password)
 	if err != nil {
+		if errors.Is(err, data.ErrDuplicateEmail) {
+			data := NewTemplateData()
+			data.Title = "Signup"
+			data.HeaderText = "Study Helper"
+			data.IsAuthenticated = app.isAuthenticated(r)
+			data.CSRFToken = nosurf.Token(r)
+			data.FormErrors = map[string]string{
+				"email": "An account with this email already exists",
+			}
+			data.FormData = map[string]string{
+				"name":  name,
+				"email": email,
+			}
+
+			err := app.render(w, http.StatusUnprocessableEntity, "signup.tmpl", data)
+			if err != nil {
+				app.logger.Error("failed to render signup form", "template", "signup.tmpl", "error", err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			}
+			return
+		}
 		app.logger.Error("failed to insert user", "error", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
+	// The account stays locked until the emailed link is opened
+	err = app.sendActivationEmail(users, r.Host)
+	if err != nil {
+		app.logger.Error("failed to create activation token", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	app.session.Put(r, "flash", "Account created! Check "+users.Email+" for a link to activate it")
+
 	// Redirect to login page or home page
 	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
 }
@@ -153,6 +193,7 @@ func (app *application) showLoginForm(w http.ResponseWriter, r *http.Request) {
 	data.HeaderText = "Login"
 	data.IsAuthenticated = app.isAuthenticated(r)
 	data.CSRFToken = nosurf.Token(r)
+	data.Flash = app.session.PopString(r, "flash")
 
 	// Render the daily goals form template
 	err := app.render(w, http.StatusOK, "login.tmpl", data)
@@ -206,10 +247,55 @@ func (app *application) loginUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Clients that keep guessing wait longer after each wrong password. The attempt is
+	// counted before the password is checked and taken back if it was right.
+	attempt, err := app.reserveLogin(r, email)
+	if err != nil {
+		app.logger.Error("failed to check login throttle", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if attempt.wait > 0 {
+		app.logger.Warn("login throttled", "email", email, "ip", clientIP(r), "retry_after", attempt.wait.Round(time.Second).String(), "locked", attempt.locked)
+		app.tooManyLoginAttempts(w, r, email, attempt.wait, attempt.locked)
+		return
+	}
+
 	// Authenticate the user
 	user, err := app.users.Authenticate(email, password)
 	if err != nil {
+		if errors.Is(err, data.ErrNotActivated) {
+			// The password was right, only the account is not ready
+			err = app.loginSucceeded(r, attempt)
+			if err != nil {
+				app.logger.Error("failed to reset login throttle", "error", err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+
+			data := NewTemplateData()
+			data.Title = "Login"
+			data.HeaderText = "Login"
+			data.IsAuthenticated = app.isAuthenticated(r)
+			data.CSRFToken = nosurf.Token(r)
+			data.FormErrors = map[string]string{
+				"generic": "Your account is not activated yet. Use the link we emailed you, or request a new one below.",
+			}
+			data.FormData = map[string]string{
+				"email": email,
+			}
+
+			err = app.render(w, http.StatusForbidden, "login.tmpl", data)
+			if err != nil {
+				app.logger.Error("failed to render login form", "template", "login.tmpl", "error", err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			}
+			return
+		}
+
 		if errors.Is(err, data.ErrInvalidCredentials) {
+			app.loginFailed(r, attempt)
+
 			data := NewTemplateData()
 			data.Title = "Login"
 			data.HeaderText = "Login"
@@ -236,16 +322,67 @@ func (app *application) loginUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Store the user ID in the session
-	app.session.Put(r, "user_id", int(user.User_id))
-	app.session.Put(r, "authenticatedUserID", true)
+	// The password was right, so earlier typos no longer count against the account
+	err = app.loginSucceeded(r, attempt)
+	if err != nil {
+		app.logger.Error("failed to reset login throttle", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	twoFactor, err := app.twoFactor.Get(user.User_id)
+	if err != nil {
+		app.logger.Error("failed to fetch two-factor settings", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// With two-factor authentication on, the password only gets the user to the code page
+	if twoFactor.Enabled {
+		app.session.Put(r, "2fa_user_id", int(user.User_id))
+		app.session.Put(r, "2fa_started_at", int(time.Now().Unix()))
+		http.Redirect(w, r, "/user/login/2fa", http.StatusSeeOther)
+		return
+	}
+
+	err = app.logIn(r, user.User_id, user.Session_version)
+	if err != nil {
+		app.logger.Error("failed to create session", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
 	// app.logger.Info("user logged in", "user_id", user.User_id)
 
 	// Redirect to the homepage
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
+// logIn records a new session of the user, with the browser and address it came from,
+// and stores the authenticated user in the cookie
+func (app *application) logIn(r *http.Request, userID int64, sessionVersion int) error {
+	token, err := app.userSessions.Insert(userID, r.UserAgent(), clientIP(r), app.session.Lifetime)
+	if err != nil {
+		return err
+	}
+
+	// Store the user ID in the session
+	app.session.Put(r, "user_id", int(userID))
+	app.session.Put(r, "authenticatedUserID", true)
+	app.session.Put(r, "session_version", sessionVersion)
+	app.session.Put(r, "session_token", token)
+
+	return nil
+}
+
 func (app *application) logoutUser(w http.ResponseWriter, r *http.Request) {
+	// Sign out the server-side session too, so a copy of the cookie stops working
+	err := app.userSessions.RevokeToken(app.session.GetString(r, "session_token"))
+	if err != nil {
+		app.logger.Error("failed to revoke session", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
 	app.session.Destroy(r)
 
 	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
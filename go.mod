@@ -2,13 +2,16 @@ module github.com/abankelsey/study_helper
 
 go 1.23.5
 
-require github.com/lib/pq v1.10.9
+require (
+	github.com/golangcollege/sessions v1.2.0
+	github.com/justinas/alice v1.2.0
+	github.com/justinas/nosurf v1.1.1
+	github.com/lib/pq v1.10.9
+	github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
+	golang.org/x/crypto v0.0.0-20200317142112-1b76d66859c6
+)
 
 require (
 	github.com/alexedwards/scs/v2 v2.8.0 // indirect
-	github.com/golangcollege/sessions v1.2.0 // indirect
-	github.com/justinas/alice v1.2.0 // indirect
-	github.com/justinas/nosurf v1.1.1 // indirect
-	golang.org/x/crypto v0.0.0-20200317142112-1b76d66859c6 // indirect
 	golang.org/x/sys v0.0.0-20190412213103-97732733099d // indirect
 )
@@ -0,0 +1,776 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/abankelsey/study_helper/internal/validator"
+)
+
+// ArchiveFormat identifies a personal data archive of this app
+const ArchiveFormat = "study-helper-archive"
+
+// ArchiveVersion is the version of the archive format written by Export. Bump it when
+// the format changes, Import accepts every version up to it.
+// Version 2 added subjects, version 1 archives only name them on sessions. Version 3
+// added when goals and sessions were completed, version 4 the checklists of goals and
+// version 5 the roll-overs of unfinished goals and version 6 the priorities, categories
+// and statuses of goals.
+const ArchiveVersion = 6
+
+// ErrAccountNotEmpty is returned when restoring an archive into an account that already has data
+var ErrAccountNotEmpty = errors.New("account not empty")
+
+// represents everything a user saved, for moving to another account or server.
+// IDs are only kept to tell items apart, they are replaced on import.
+type Archive struct {
+	Format      string            `json:"format"`
+	Version     int               `json:"version"`
+	Exported_at time.Time         `json:"exported_at"`
+	Profile     ArchiveProfile    `json:"profile"`
+	Subjects    []*ArchiveSubject `json:"subjects"`
+	Goals       []*ArchiveGoal    `json:"goals"`
+	Sessions    []*ArchiveSession `json:"sessions"`
+	Quotes      []*ArchiveQuote   `json:"quotes"`
+}
+
+// represents the profile of the user who exported an archive
+type ArchiveProfile struct {
+	Name       string    `json:"name"`
+	Email      string    `json:"email"`
+	Created_at time.Time `json:"created_at"`
+}
+
+// represents a subject in an archive. Sessions refer to it by name.
+type ArchiveSubject struct {
+	Name                string    `json:"name"`
+	Colour              string    `json:"colour"`
+	Weekly_target_hours float64   `json:"weekly_target_hours"`
+	Created_at          time.Time `json:"created_at"`
+}
+
+// represents a daily goal in an archive
+type ArchiveGoal struct {
+	ID           int64              `json:"id"`
+	Goal_text    string             `json:"goal_text"`
+	Target_date  time.Time          `json:"target_date"`
+	Is_completed bool               `json:"is_completed"`
+	Completed_at *time.Time         `json:"completed_at,omitempty"`
+	Created_at   time.Time          `json:"created_at"`
+	Ical_uid     string             `json:"ical_uid,omitempty"`
+	Items        []*ArchiveGoalItem `json:"items,omitempty"`
+	Missed_at    *time.Time         `json:"missed_at,omitempty"`
+	Roll_overs   []*ArchiveRollOver `json:"roll_overs,omitempty"`
+	Priority     string             `json:"priority,omitempty"`
+	Category     string             `json:"category,omitempty"`
+	Status       string             `json:"status,omitempty"`
+}
+
+// represents a checklist item of a goal, in the order of the checklist
+type ArchiveGoalItem struct {
+	Item_text  string    `json:"item_text"`
+	Is_done    bool      `json:"is_done"`
+	Created_at time.Time `json:"created_at"`
+}
+
+// represents one time an unfinished goal was rolled forward or marked missed
+type ArchiveRollOver struct {
+	Action     string     `json:"action"`
+	From_date  time.Time  `json:"from_date"`
+	To_date    *time.Time `json:"to_date,omitempty"`
+	Created_at time.Time  `json:"created_at"`
+}
+
+// represents a study session in an archive, along with its timer, pomodoros and
+// changes to single occurrences of a repeating session
+type ArchiveSession struct {
+	ID           int64                    `json:"id"`
+	Title        string                   `json:"title"`
+	Description  string                   `json:"description"`
+	Subject      string                   `json:"subject"`
+	Start_date   time.Time                `json:"start_date"`
+	End_date     time.Time                `json:"end_date"`
+	Is_completed bool                     `json:"is_completed"`
+	Completed_at *time.Time               `json:"completed_at,omitempty"`
+	Created_at   time.Time                `json:"created_at"`
+	Stopped_at   *time.Time               `json:"stopped_at,omitempty"`
+	Rrule        string                   `json:"rrule,omitempty"`
+	Ical_uid     string                   `json:"ical_uid,omitempty"`
+	Exceptions   []*SessionException      `json:"exceptions,omitempty"`
+	Intervals    []*ArchiveInterval       `json:"intervals,omitempty"`
+	Pomodoro     *ArchivePomodoroSettings `json:"pomodoro,omitempty"`
+	Pomodoros    []*ArchivePomodoro       `json:"pomodoros,omitempty"`
+}
+
+// represents a stretch of time the session timer ran, on one occurrence of a repeating session
+type ArchiveInterval struct {
+	Occurrence_date *time.Time `json:"occurrence_date,omitempty"`
+	Start_action    string     `json:"start_action"`
+	Started_at      time.Time  `json:"started_at"`
+	End_action      string     `json:"end_action,omitempty"`
+	Ended_at        *time.Time `json:"ended_at,omitempty"`
+}
+
+// represents the pomodoro settings and progress of a session
+type ArchivePomodoroSettings struct {
+	Work_minutes             int       `json:"work_minutes"`
+	Short_break_minutes      int       `json:"short_break_minutes"`
+	Long_break_minutes       int       `json:"long_break_minutes"`
+	Cycles_before_long_break int       `json:"cycles_before_long_break"`
+	Phase                    string    `json:"phase"`
+	Cycle                    int       `json:"cycle"`
+	Phase_started_at         time.Time `json:"phase_started_at"`
+	Created_at               time.Time `json:"created_at"`
+}
+
+// represents a finished pomodoro
+type ArchivePomodoro struct {
+	Cycle        int       `json:"cycle"`
+	Work_minutes int       `json:"work_minutes"`
+	Started_at   time.Time `json:"started_at"`
+	Completed_at time.Time `json:"completed_at"`
+}
+
+// represents a quote in an archive
+type ArchiveQuote struct {
+	ID         int64     `json:"id"`
+	Content    string    `json:"content"`
+	Created_at time.Time `json:"created_at"`
+}
+
+// validates an uploaded archive. Each item is checked like it would be when created,
+// the first problem is reported under "archive".
+func ValidateArchive(v *validator.Validator, a *Archive) {
+	v.Check(a.Format == ArchiveFormat, "archive", "This is not a Study Helper archive")
+	v.Check(a.Version >= 1 && a.Version <= ArchiveVersion, "archive", fmt.Sprintf("This archive is version %d, which this server can't read", a.Version))
+	if !v.ValidData() {
+		return
+	}
+
+	for i, s := range a.Subjects {
+		item := validator.NewValidator()
+		ValidateSubjects(item, &Subjects{Name: s.Name, Colour: s.Colour, Weekly_target_hours: s.Weekly_target_hours})
+		addArchiveItemErrors(v, fmt.Sprintf("Subject %d", i+1), item)
+	}
+
+	for i, g := range a.Goals {
+		item := validator.NewValidator()
+		ValidateGoals(item, &Goals{
+			Goal_text:   g.Goal_text,
+			Target_date: g.Target_date,
+			Priority:    g.Priority,
+			Category:    g.Category,
+			Status:      g.Status,
+		})
+		for _, i := range g.Items {
+			ValidateGoalItems(item, &GoalItems{Item_text: i.Item_text})
+		}
+		for _, r := range g.Roll_overs {
+			item.Check(slices.Contains([]string{"rolled", "missed"}, r.Action), "roll_overs", "has an unknown action")
+		}
+		addArchiveItemErrors(v, fmt.Sprintf("Goal %d", i+1), item)
+	}
+
+	for i, s := range a.Sessions {
+		item := validator.NewValidator()
+		ValidateSessions(item, &Sessions{
+			Title:       s.Title,
+			Description: s.Description,
+			Subject:     s.Subject,
+			Start_date:  s.Start_date,
+			End_date:    s.End_date,
+			Rrule:       s.Rrule,
+		})
+		for _, interval := range s.Intervals {
+			item.Check(slices.Contains([]string{"start", "resume"}, interval.Start_action), "intervals", "has an unknown timer action")
+			item.Check(slices.Contains([]string{"", "pause", "stop"}, interval.End_action), "intervals", "has an unknown timer action")
+		}
+		if p := s.Pomodoro; p != nil {
+			ValidatePomodoros(item, &Pomodoros{
+				Work_minutes:             p.Work_minutes,
+				Short_break_minutes:      p.Short_break_minutes,
+				Long_break_minutes:       p.Long_break_minutes,
+				Cycles_before_long_break: p.Cycles_before_long_break,
+			})
+			item.Check(slices.Contains([]string{"work", "short_break", "long_break"}, p.Phase), "phase", "Must be work, short_break or long_break")
+		}
+		addArchiveItemErrors(v, fmt.Sprintf("Session %d", i+1), item)
+	}
+
+	for i, q := range a.Quotes {
+		item := validator.NewValidator()
+		ValidateQuotes(item, &Quotes{Content: q.Content})
+		addArchiveItemErrors(v, fmt.Sprintf("Quote %d", i+1), item)
+	}
+}
+
+// addArchiveItemErrors reports one of the item's errors, if it has any
+func addArchiveItemErrors(v *validator.Validator, label string, item *validator.Validator) {
+	for _, field := range slices.Sorted(maps.Keys(item.Errors)) {
+		v.AddError("archive", fmt.Sprintf("%s: %s %s", label, field, item.Errors[field]))
+		return
+	}
+}
+
+// ArchiveModel struct handles reading and restoring whole personal data archives
+type ArchiveModel struct {
+	DB *sql.DB
+}
+
+// Export reads everything the user saved as one consistent snapshot
+func (m *ArchiveModel) Export(userID int64) (*Archive, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	a := &Archive{
+		Format:      ArchiveFormat,
+		Version:     ArchiveVersion,
+		Exported_at: time.Now().UTC(),
+		Subjects:    []*ArchiveSubject{},
+		Goals:       []*ArchiveGoal{},
+		Sessions:    []*ArchiveSession{},
+		Quotes:      []*ArchiveQuote{},
+	}
+
+	err = tx.QueryRowContext(ctx, `SELECT name, email, created_at FROM users WHERE user_id = $1`, userID).Scan(
+		&a.Profile.Name,
+		&a.Profile.Email,
+		&a.Profile.Created_at,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	err = exportSubjects(ctx, tx, userID, a)
+	if err != nil {
+		return nil, err
+	}
+
+	err = exportGoals(ctx, tx, userID, a)
+	if err != nil {
+		return nil, err
+	}
+
+	err = exportSessions(ctx, tx, userID, a)
+	if err != nil {
+		return nil, err
+	}
+
+	err = exportQuotes(ctx, tx, userID, a)
+	if err != nil {
+		return nil, err
+	}
+
+	return a, tx.Commit()
+}
+
+func exportSubjects(ctx context.Context, tx *sql.Tx, userID int64, a *Archive) error {
+	query := `
+        SELECT name, colour, weekly_target_hours, created_at
+        FROM subjects
+        WHERE user_id = $1
+        ORDER BY subject_id`
+
+	rows, err := tx.QueryContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var s ArchiveSubject
+		err := rows.Scan(&s.Name, &s.Colour, &s.Weekly_target_hours, &s.Created_at)
+		if err != nil {
+			return err
+		}
+		a.Subjects = append(a.Subjects, &s)
+	}
+
+	return rows.Err()
+}
+
+func exportGoals(ctx context.Context, tx *sql.Tx, userID int64, a *Archive) error {
+	query := `
+        SELECT goal_id, goal_text, target_date, COALESCE(is_completed, FALSE), completed_at, created_at, ical_uid, missed_at,
+               priority, category, status
+        FROM daily_goals
+        WHERE user_id = $1
+        ORDER BY goal_id`
+
+	rows, err := tx.QueryContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	byID := map[int64]*ArchiveGoal{}
+	for rows.Next() {
+		var g ArchiveGoal
+		err := rows.Scan(&g.ID, &g.Goal_text, &g.Target_date, &g.Is_completed, &g.Completed_at, &g.Created_at, &g.Ical_uid, &g.Missed_at,
+			&g.Priority, &g.Category, &g.Status)
+		if err != nil {
+			return err
+		}
+		a.Goals = append(a.Goals, &g)
+		byID[g.ID] = &g
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	// The checklists and roll-overs of every goal, in one query each
+	query = `
+        SELECT i.goal_id, i.item_text, i.is_done, i.created_at
+        FROM goal_items i
+        JOIN daily_goals g ON g.goal_id = i.goal_id
+        WHERE g.user_id = $1
+        ORDER BY i.goal_id, i.position, i.item_id`
+
+	rows, err = tx.QueryContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		var i ArchiveGoalItem
+		err := rows.Scan(&id, &i.Item_text, &i.Is_done, &i.Created_at)
+		if err != nil {
+			return err
+		}
+		byID[id].Items = append(byID[id].Items, &i)
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	query = `
+        SELECT r.goal_id, r.action, r.from_date, r.to_date, r.created_at
+        FROM goal_rollovers r
+        JOIN daily_goals g ON g.goal_id = r.goal_id
+        WHERE g.user_id = $1
+        ORDER BY r.goal_id, r.created_at, r.rollover_id`
+
+	rows, err = tx.QueryContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		var r ArchiveRollOver
+		err := rows.Scan(&id, &r.Action, &r.From_date, &r.To_date, &r.Created_at)
+		if err != nil {
+			return err
+		}
+		byID[id].Roll_overs = append(byID[id].Roll_overs, &r)
+	}
+
+	return rows.Err()
+}
+
+func exportSessions(ctx context.Context, tx *sql.Tx, userID int64, a *Archive) error {
+	query := `
+        SELECT s.session_id, s.title, COALESCE(s.description, ''), sub.name, s.start_date, s.end_date,
+               COALESCE(s.is_completed, FALSE), s.completed_at, s.created_at, s.stopped_at, s.rrule, s.ical_uid
+        FROM study_sessions s
+        JOIN subjects sub ON sub.subject_id = s.subject_id
+        WHERE s.user_id = $1
+        ORDER BY s.session_id`
+
+	rows, err := tx.QueryContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	byID := map[int64]*ArchiveSession{}
+	for rows.Next() {
+		var s ArchiveSession
+		err := rows.Scan(&s.ID, &s.Title, &s.Description, &s.Subject, &s.Start_date, &s.End_date,
+			&s.Is_completed, &s.Completed_at, &s.Created_at, &s.Stopped_at, &s.Rrule, &s.Ical_uid)
+		if err != nil {
+			return err
+		}
+		a.Sessions = append(a.Sessions, &s)
+		byID[s.ID] = &s
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	// The timer, pomodoros and exceptions of every session, in one query each
+	query = `
+        SELECT i.session_id, i.occurrence_date, i.start_action, i.started_at, COALESCE(i.end_action, ''), i.ended_at
+        FROM session_intervals i
+        JOIN study_sessions s ON s.session_id = i.session_id
+        WHERE s.user_id = $1
+        ORDER BY i.interval_id`
+
+	rows, err = tx.QueryContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		var i ArchiveInterval
+		err := rows.Scan(&id, &i.Occurrence_date, &i.Start_action, &i.Started_at, &i.End_action, &i.Ended_at)
+		if err != nil {
+			return err
+		}
+		byID[id].Intervals = append(byID[id].Intervals, &i)
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	query = `
+        SELECT p.session_id, p.work_minutes, p.short_break_minutes, p.long_break_minutes, p.cycles_before_long_break,
+               p.phase, p.cycle, p.phase_started_at, p.created_at
+        FROM session_pomodoros p
+        JOIN study_sessions s ON s.session_id = p.session_id
+        WHERE s.user_id = $1`
+
+	rows, err = tx.QueryContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		var p ArchivePomodoroSettings
+		err := rows.Scan(&id, &p.Work_minutes, &p.Short_break_minutes, &p.Long_break_minutes, &p.Cycles_before_long_break,
+			&p.Phase, &p.Cycle, &p.Phase_started_at, &p.Created_at)
+		if err != nil {
+			return err
+		}
+		byID[id].Pomodoro = &p
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	query = `
+        SELECT p.session_id, p.cycle, p.work_minutes, p.started_at, p.completed_at
+        FROM pomodoros p
+        JOIN study_sessions s ON s.session_id = p.session_id
+        WHERE s.user_id = $1
+        ORDER BY p.pomodoro_id`
+
+	rows, err = tx.QueryContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		var p ArchivePomodoro
+		err := rows.Scan(&id, &p.Cycle, &p.Work_minutes, &p.Started_at, &p.Completed_at)
+		if err != nil {
+			return err
+		}
+		byID[id].Pomodoros = append(byID[id].Pomodoros, &p)
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	query = `
+        SELECT e.session_id, e.occurrence_date, e.is_cancelled, e.title, e.description, sub.name, e.start_date, e.end_date,
+               e.is_completed, e.stopped_at
+        FROM session_exceptions e
+        JOIN study_sessions s ON s.session_id = e.session_id
+        LEFT JOIN subjects sub ON sub.subject_id = e.subject_id
+        WHERE s.user_id = $1
+        ORDER BY e.session_id, e.occurrence_date`
+
+	rows, err = tx.QueryContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		e := &SessionException{}
+		err := rows.Scan(&id, &e.Occurrence_date, &e.Is_cancelled, &e.Title, &e.Description, &e.Subject, &e.Start_date, &e.End_date, &e.Is_completed, &e.Stopped_at)
+		if err != nil {
+			return err
+		}
+		byID[id].Exceptions = append(byID[id].Exceptions, e)
+	}
+
+	return rows.Err()
+}
+
+func exportQuotes(ctx context.Context, tx *sql.Tx, userID int64, a *Archive) error {
+	query := `
+        SELECT quote_id, content, created_at
+        FROM quotes
+        WHERE user_id = $1
+        ORDER BY quote_id`
+
+	rows, err := tx.QueryContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var q ArchiveQuote
+		err := rows.Scan(&q.ID, &q.Content, &q.Created_at)
+		if err != nil {
+			return err
+		}
+		a.Quotes = append(a.Quotes, &q)
+	}
+
+	return rows.Err()
+}
+
+// Import restores a validated archive into the user's account, which must not have any
+// goals, sessions or quotes yet. Every item gets a new ID. Subjects the user already has
+// take the colour and target of the archive. Either everything is restored or nothing is.
+func (m *ArchiveModel) Import(userID int64, a *Archive) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+        SELECT EXISTS (SELECT 1 FROM daily_goals WHERE user_id = $1)
+            OR EXISTS (SELECT 1 FROM study_sessions WHERE user_id = $1)
+            OR EXISTS (SELECT 1 FROM quotes WHERE user_id = $1)`
+
+	var hasData bool
+	err = tx.QueryRowContext(ctx, query, userID).Scan(&hasData)
+	if err != nil {
+		return err
+	}
+	if hasData {
+		return ErrAccountNotEmpty
+	}
+
+	for _, s := range a.Subjects {
+		query := `
+            INSERT INTO subjects (user_id, name, colour, weekly_target_hours, created_at)
+            VALUES ($1, $2, $3, $4, $5)
+            ON CONFLICT (user_id, name) DO UPDATE
+            SET colour = EXCLUDED.colour,
+                weekly_target_hours = EXCLUDED.weekly_target_hours`
+
+		_, err = tx.ExecContext(ctx, query, userID, s.Name, s.Colour, s.Weekly_target_hours, orNow(s.Created_at))
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, g := range a.Goals {
+		err = importGoal(ctx, tx, userID, g)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, s := range a.Sessions {
+		err = importSession(ctx, tx, userID, s)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, q := range a.Quotes {
+		query := `
+            INSERT INTO quotes (user_id, content, created_at)
+            VALUES ($1, $2, $3)`
+
+		_, err = tx.ExecContext(ctx, query, userID, q.Content, orNow(q.Created_at))
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// orNow returns t, or the current time for a timestamp missing from a hand-edited archive
+func orNow(t time.Time) time.Time {
+	if t.IsZero() {
+		return time.Now()
+	}
+	return t
+}
+
+// completedAt returns when a restored goal or session was completed. Archives from before
+// this was kept say only that it was, so it is put at midday of the day it was due.
+func completedAt(completed bool, at *time.Time, due time.Time) *time.Time {
+	if !completed || at != nil {
+		return at
+	}
+	midday := time.Date(due.Year(), due.Month(), due.Day(), 12, 0, 0, 0, time.UTC)
+	return &midday
+}
+
+// importGoal inserts a goal with its checklist and roll-overs under its new ID
+func importGoal(ctx context.Context, tx *sql.Tx, userID int64, g *ArchiveGoal) error {
+	// Goals from before version 6 get their status from whether they were completed or missed
+	goal := &Goals{Is_completed: g.Is_completed, Priority: g.Priority, Status: g.Status}
+	if goal.Status == "" && !g.Is_completed && g.Missed_at != nil {
+		goal.Status = GoalMissed
+	}
+	goal.syncStatus()
+
+	missedAt := g.Missed_at
+	if goal.Status != GoalMissed {
+		missedAt = nil
+	} else if missedAt == nil {
+		now := time.Now()
+		missedAt = &now
+	}
+
+	query := `
+        INSERT INTO daily_goals (user_id, goal_text, target_date, is_completed, completed_at, created_at, ical_uid, missed_at,
+                                 priority, category, status)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+        RETURNING goal_id`
+
+	var goalID int64
+	err := tx.QueryRowContext(ctx, query, userID, g.Goal_text, g.Target_date, goal.Is_completed,
+		completedAt(goal.Is_completed, g.Completed_at, g.Target_date), orNow(g.Created_at), g.Ical_uid, missedAt,
+		goal.Priority, g.Category, goal.Status).Scan(&goalID)
+	if err != nil {
+		return err
+	}
+
+	for n, i := range g.Items {
+		query := `
+            INSERT INTO goal_items (goal_id, item_text, is_done, position, created_at)
+            VALUES ($1, $2, $3, $4, $5)`
+
+		_, err = tx.ExecContext(ctx, query, goalID, i.Item_text, i.Is_done, n+1, orNow(i.Created_at))
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, r := range g.Roll_overs {
+		query := `
+            INSERT INTO goal_rollovers (goal_id, action, from_date, to_date, created_at)
+            VALUES ($1, $2, $3, $4, $5)`
+
+		_, err = tx.ExecContext(ctx, query, goalID, r.Action, r.From_date, r.To_date, orNow(r.Created_at))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// importSession inserts a session and everything that belongs to it under its new ID.
+// Subjects missing from the archive are created from the names the session uses.
+func importSession(ctx context.Context, tx *sql.Tx, userID int64, s *ArchiveSession) error {
+	subjectID, err := findOrCreateSubject(ctx, tx, userID, s.Subject)
+	if err != nil {
+		return err
+	}
+
+	query := `
+        INSERT INTO study_sessions (user_id, title, description, subject_id, start_date, end_date, is_completed,
+                                    completed_at, created_at, stopped_at, rrule, ical_uid)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+        RETURNING session_id`
+
+	var sessionID int64
+	err = tx.QueryRowContext(ctx, query, userID, s.Title, s.Description, subjectID, s.Start_date, s.End_date,
+		s.Is_completed, completedAt(s.Is_completed, s.Completed_at, s.End_date), orNow(s.Created_at), s.Stopped_at,
+		s.Rrule, s.Ical_uid).Scan(&sessionID)
+	if err != nil {
+		return err
+	}
+
+	for _, i := range s.Intervals {
+		query := `
+            INSERT INTO session_intervals (session_id, occurrence_date, start_action, started_at, end_action, ended_at)
+            VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6)`
+
+		_, err = tx.ExecContext(ctx, query, sessionID, i.Occurrence_date, i.Start_action, i.Started_at, i.End_action, i.Ended_at)
+		if err != nil {
+			return err
+		}
+	}
+
+	if p := s.Pomodoro; p != nil {
+		query := `
+            INSERT INTO session_pomodoros (session_id, work_minutes, short_break_minutes, long_break_minutes,
+                                           cycles_before_long_break, phase, cycle, phase_started_at, created_at)
+            VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+
+		_, err = tx.ExecContext(ctx, query, sessionID, p.Work_minutes, p.Short_break_minutes, p.Long_break_minutes,
+			p.Cycles_before_long_break, p.Phase, p.Cycle, orNow(p.Phase_started_at), orNow(p.Created_at))
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, p := range s.Pomodoros {
+		query := `
+            INSERT INTO pomodoros (session_id, cycle, work_minutes, started_at, completed_at)
+            VALUES ($1, $2, $3, $4, $5)`
+
+		_, err = tx.ExecContext(ctx, query, sessionID, p.Cycle, p.Work_minutes, p.Started_at, p.Completed_at)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, e := range s.Exceptions {
+		if e.Subject != nil {
+			id, err := findOrCreateSubject(ctx, tx, userID, *e.Subject)
+			if err != nil {
+				return err
+			}
+			e.Subject_id = &id
+		}
+
+		query := `
+            INSERT INTO session_exceptions (session_id, occurrence_date, is_cancelled, title, description, subject_id,
+                                            start_date, end_date, is_completed, stopped_at)
+            VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
+
+		_, err = tx.ExecContext(ctx, query, sessionID, e.Occurrence_date, e.Is_cancelled, e.Title, e.Description,
+			e.Subject_id, e.Start_date, e.End_date, e.Is_completed, e.Stopped_at)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
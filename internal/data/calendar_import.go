@@ -0,0 +1,129 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// CalendarSession is a session read from an .ics file, with the dates cancelled in its series
+type CalendarSession struct {
+	Session *Sessions
+	Exdates []time.Time
+}
+
+// CalendarImport counts what ImportCalendar inserted and lists the UIDs it skipped
+type CalendarImport struct {
+	Sessions int
+	Goals    int
+	Skipped  []string
+}
+
+// isDuplicateUID reports whether err is a violation of the unique calendar UID indexes
+func isDuplicateUID(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505" &&
+		(pqErr.Constraint == "study_sessions_user_id_ical_uid_idx" || pqErr.Constraint == "daily_goals_user_id_ical_uid_idx")
+}
+
+// ImportCalendar inserts the sessions and goals of an .ics file in one transaction, so a
+// failure leaves nothing behind. An item whose UID the user already has, because another
+// import of the same file got there first, is skipped rather than failing the import.
+func (m *ArchiveModel) ImportCalendar(sessions []*CalendarSession, goals []*Goals) (*CalendarImport, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result := &CalendarImport{}
+
+	for _, s := range sessions {
+		inserted, err := importCalendarItem(ctx, tx, func() error {
+			return importCalendarSession(ctx, tx, s)
+		})
+		if err != nil {
+			return nil, err
+		}
+		if !inserted {
+			result.Skipped = append(result.Skipped, s.Session.Ical_uid)
+			continue
+		}
+		result.Sessions++
+	}
+
+	for _, g := range goals {
+		inserted, err := importCalendarItem(ctx, tx, func() error {
+			return insertGoal(ctx, tx, g)
+		})
+		if err != nil {
+			return nil, err
+		}
+		if !inserted {
+			result.Skipped = append(result.Skipped, g.Ical_uid)
+			continue
+		}
+		result.Goals++
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// importCalendarItem runs insert inside a savepoint, so a duplicate UID only undoes that item
+// and the transaction can go on. It reports whether the item was inserted.
+func importCalendarItem(ctx context.Context, tx *sql.Tx, insert func() error) (bool, error) {
+	_, err := tx.ExecContext(ctx, "SAVEPOINT calendar_item")
+	if err != nil {
+		return false, err
+	}
+
+	err = insert()
+	if isDuplicateUID(err) {
+		_, err = tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT calendar_item")
+		return false, err
+	}
+	if err != nil {
+		return false, err
+	}
+
+	_, err = tx.ExecContext(ctx, "RELEASE SAVEPOINT calendar_item")
+	return err == nil, err
+}
+
+// importCalendarSession inserts the session and cancels its excluded dates
+func importCalendarSession(ctx context.Context, tx *sql.Tx, s *CalendarSession) error {
+	err := insertSession(ctx, tx, s.Session)
+	if err != nil {
+		return err
+	}
+
+	query := `
+    INSERT INTO session_exceptions (session_id, occurrence_date, is_cancelled)
+    VALUES ($1, $2, TRUE)
+    ON CONFLICT (session_id, occurrence_date) DO UPDATE
+    SET is_cancelled = TRUE`
+
+	for _, date := range s.Exdates {
+		// Files often list EXDATEs the rule never produces, there is nothing to cancel then
+		if !s.Session.IsOccurrence(date) {
+			continue
+		}
+		_, err = tx.ExecContext(ctx, query, s.Session.Session_id, date)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
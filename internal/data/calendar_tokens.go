@@ -0,0 +1,116 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"time"
+)
+
+// represents the secret token behind a user's private calendar feed
+type CalendarTokens struct {
+	User_id    int64     `json:"user_id"`
+	Token_hash []byte    `json:"-"`
+	Created_at time.Time `json:"created_at"`
+}
+
+// CalendarTokensModel struct handles database operations related to calendar feed tokens
+type CalendarTokensModel struct {
+	DB *sql.DB
+}
+
+// newToken generates a random URL safe token and the SHA-256 hash that is stored in its place
+func newToken() (string, []byte, error) {
+	randomBytes := make([]byte, 20)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", nil, err
+	}
+
+	plaintext := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)
+
+	return plaintext, hashToken(plaintext), nil
+}
+
+// hashToken returns the stored form of a plaintext token
+func hashToken(plaintext string) []byte {
+	hash := sha256.Sum256([]byte(plaintext))
+	return hash[:]
+}
+
+// New creates a feed token for the user, replacing (and so revoking) any previous one.
+// Only the hash is stored, the plaintext token is returned once.
+func (m *CalendarTokensModel) New(userID int64) (string, error) {
+	plaintext, hash, err := newToken()
+	if err != nil {
+		return "", err
+	}
+
+	query := `
+    INSERT INTO calendar_tokens (user_id, token_hash)
+    VALUES ($1, $2)
+    ON CONFLICT (user_id) DO UPDATE
+    SET token_hash = EXCLUDED.token_hash, created_at = NOW()`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err = m.DB.ExecContext(ctx, query, userID, hash)
+	if err != nil {
+		return "", err
+	}
+
+	return plaintext, nil
+}
+
+// Get returns the feed token details of the user
+func (m *CalendarTokensModel) Get(userID int64) (*CalendarTokens, error) {
+	query := `
+    SELECT user_id, token_hash, created_at
+    FROM calendar_tokens
+    WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var t CalendarTokens
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(&t.User_id, &t.Token_hash, &t.Created_at)
+	if err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
+
+// GetUserID returns the owner of a plaintext feed token
+func (m *CalendarTokensModel) GetUserID(plaintext string) (int64, error) {
+	query := `
+    SELECT user_id
+    FROM calendar_tokens
+    WHERE token_hash = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var userID int64
+	err := m.DB.QueryRowContext(ctx, query, hashToken(plaintext)).Scan(&userID)
+	if err != nil {
+		return 0, err
+	}
+
+	return userID, nil
+}
+
+// Revoke removes the feed token of the user so the feed URL stops working
+func (m *CalendarTokensModel) Revoke(userID int64) error {
+	query := `
+    DELETE FROM calendar_tokens WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID)
+	return err
+}
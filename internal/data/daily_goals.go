@@ -3,11 +3,36 @@ package data
 import (
 	"context"
 	"database/sql"
+	"slices"
+	"strconv"
 	"time"
 
 	"github.com/abankelsey/study_helper/internal/validator"
 )
 
+// the priorities a goal can have, from least to most pressing
+const (
+	PriorityLow    = "low"
+	PriorityMedium = "medium"
+	PriorityHigh   = "high"
+	PriorityUrgent = "urgent"
+)
+
+// the statuses of a goal, in the order of the board's columns. A done goal is completed.
+const (
+	GoalTodo       = "todo"
+	GoalInProgress = "in_progress"
+	GoalDone       = "done"
+	GoalMissed     = "missed"
+)
+
+var (
+	GoalPriorities = []string{PriorityLow, PriorityMedium, PriorityHigh, PriorityUrgent}
+	GoalStatuses   = []string{GoalTodo, GoalInProgress, GoalDone, GoalMissed}
+	// the fields the goal list can be grouped by
+	GoalGroupSafelist = []string{"priority", "category", "status"}
+)
+
 // represents a goals entry in the sytem
 type Goals struct {
 	Goal_id      int64     `json:"goal_id"`
@@ -16,6 +41,84 @@ type Goals struct {
 	Is_completed bool      `json:"is_completed"`
 	Target_date  time.Time `json:"target_date"`
 	Created_at   time.Time `json:"created_at"`
+	Ical_uid     string    `json:"ical_uid,omitempty"`
+	// how many checklist items the goal has, how many of them are done and the
+	// percentage of the goal that is done
+	Item_count int `json:"item_count"`
+	Items_done int `json:"items_done"`
+	Progress   int `json:"progress"`
+	// how many times the goal was rolled forward unfinished, and when it was marked missed
+	Carried_over int        `json:"carried_over"`
+	Missed_at    *time.Time `json:"missed_at,omitempty"`
+	Priority     string     `json:"priority"`
+	Category     string     `json:"category"` // empty when the goal has none
+	Status       string     `json:"status"`
+}
+
+// SetCompleted completes the goal or takes it back to to do. A goal that was not done
+// keeps its status when it is still not done.
+func (g *Goals) SetCompleted(completed bool) {
+	switch {
+	case completed:
+		g.Status = GoalDone
+	case g.Status == GoalDone || g.Status == "":
+		g.Status = GoalTodo
+	}
+	g.Is_completed = completed
+}
+
+// syncStatus fills in the priority and status of a goal that was given none, and keeps
+// Is_completed in step with the status
+func (g *Goals) syncStatus() {
+	if g.Priority == "" {
+		g.Priority = PriorityMedium
+	}
+	if g.Status == "" {
+		g.SetCompleted(g.Is_completed)
+	}
+	g.Is_completed = g.Status == GoalDone
+}
+
+// setProgress works out the progress of the goal from its checklist. A goal without
+// items is either not started or done.
+func (g *Goals) setProgress() {
+	switch {
+	case g.Item_count > 0:
+		g.Progress = g.Items_done * 100 / g.Item_count
+	case g.Is_completed:
+		g.Progress = 100
+	default:
+		g.Progress = 0
+	}
+}
+
+// goalCounts joins the checklist and roll-over counts of each goal, in one query with the goals
+const goalCounts = `
+        LEFT JOIN LATERAL (
+            SELECT COUNT(*) AS item_count, COUNT(*) FILTER (WHERE is_done) AS items_done
+            FROM goal_items i
+            WHERE i.goal_id = daily_goals.goal_id
+        ) items ON TRUE
+        LEFT JOIN LATERAL (
+            SELECT COUNT(*) AS carried_over
+            FROM goal_rollovers r
+            WHERE r.goal_id = daily_goals.goal_id AND r.action = 'rolled'
+        ) rollovers ON TRUE`
+
+// goalColumns are the columns of a goal that scanGoal reads, including the ones joined by goalCounts
+const goalColumns = `goal_id, user_id, goal_text, target_date, is_completed, created_at, ical_uid,
+               priority, category, status, missed_at, item_count, items_done, carried_over`
+
+// scanGoal reads a row of goalColumns and works out the goal's progress
+func scanGoal(row interface{ Scan(...any) error }) (*Goals, error) {
+	g := &Goals{}
+	err := row.Scan(&g.Goal_id, &g.User_id, &g.Goal_text, &g.Target_date, &g.Is_completed, &g.Created_at, &g.Ical_uid,
+		&g.Priority, &g.Category, &g.Status, &g.Missed_at, &g.Item_count, &g.Items_done, &g.Carried_over)
+	if err != nil {
+		return nil, err
+	}
+	g.setProgress()
+	return g, nil
 }
 
 // validates the fields of the goals struct
@@ -24,6 +127,10 @@ func ValidateGoals(v *validator.Validator, goals *Goals) {
 	v.Check(validator.MaxLength(goals.Goal_text, 50), "goal_text", "must not be more than 50 bytes long")
 
 	v.Check(validator.IsValidDate(goals.Target_date), "target_date", "You must provide a valid date")
+
+	v.Check(goals.Priority == "" || slices.Contains(GoalPriorities, goals.Priority), "priority", "Must be low, medium, high or urgent")
+	v.Check(validator.MaxLength(goals.Category, 30), "category", "must not be more than 30 bytes long")
+	v.Check(goals.Status == "" || slices.Contains(GoalStatuses, goals.Status), "status", "Must be todo, in_progress, done or missed")
 }
 
 // GoalsModel struct handles database operations related to todo
@@ -31,31 +138,49 @@ type GoalsModel struct {
 	DB *sql.DB
 }
 
-// Adds new todo entry into the database
+// Adds new todo entry into the database. A goal given no priority or status is of medium
+// priority, and done when it is completed.
 func (m *GoalsModel) Insert(goals *Goals) error {
-	query := `
-        INSERT INTO daily_goals (user_id, goal_text, is_completed, target_date)
-        VALUES ($1, $2, $3, $4)
-        RETURNING goal_id, created_at`
-
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	return m.DB.QueryRowContext(
+	return insertGoal(ctx, m.DB, goals)
+}
+
+// insertGoal runs the goal insert on either a *sql.DB or a *sql.Tx
+func insertGoal(ctx context.Context, q querier, goals *Goals) error {
+	goals.syncStatus()
+
+	query := `
+        INSERT INTO daily_goals (user_id, goal_text, is_completed, target_date, ical_uid, priority, category, status, missed_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, CASE WHEN $8 = 'missed' THEN NOW() END)
+        RETURNING goal_id, created_at, missed_at`
+
+	err := q.QueryRowContext(
 		ctx,
 		query,
 		goals.User_id,
 		goals.Goal_text,
 		goals.Is_completed,
 		goals.Target_date,
-	).Scan(&goals.Goal_id, &goals.Created_at)
+		goals.Ical_uid,
+		goals.Priority,
+		goals.Category,
+		goals.Status,
+	).Scan(&goals.Goal_id, &goals.Created_at, &goals.Missed_at)
+	if err != nil {
+		return err
+	}
+
+	goals.setProgress()
+	return nil
 }
 
-// Retrieve list of all daily goal entries from the database
+// Retrieve list of all daily goal entries from the database, with the progress of their checklists
 func (m *GoalsModel) GoalList(userID int64) ([]*Goals, error) {
 	query := `
-        SELECT goal_id, user_id, goal_text, target_date, is_completed, created_at
-        FROM daily_goals
+        SELECT ` + goalColumns + `
+        FROM daily_goals` + goalCounts + `
         WHERE user_id = $1
         ORDER BY created_at DESC`
 
@@ -71,8 +196,7 @@ func (m *GoalsModel) GoalList(userID int64) ([]*Goals, error) {
 	var goals []*Goals
 
 	for rows.Next() {
-		g := &Goals{}
-		err := rows.Scan(&g.Goal_id, &g.User_id, &g.Goal_text, &g.Target_date, &g.Is_completed, &g.Created_at)
+		g, err := scanGoal(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -86,6 +210,97 @@ func (m *GoalsModel) GoalList(userID int64) ([]*Goals, error) {
 	return goals, nil
 }
 
+// goalSortColumns are the columns the goal sort keys order by
+var goalSortColumns = map[string]sortColumn{
+	"created_at":   {"created_at", "timestamptz"},
+	"target_date":  {"target_date", "date"},
+	"title":        {"goal_text", "text"},
+	"is_completed": {"is_completed", "boolean"},
+}
+
+// goalPriorityGroups is the order of the priority groups, most pressing first
+var goalPriorityGroups = []string{PriorityUrgent, PriorityHigh, PriorityMedium, PriorityLow}
+
+// goalGroupColumns are the columns the goal list can be grouped by
+var goalGroupColumns = map[string]sortColumn{
+	"priority": {arrayPosition("priority", goalPriorityGroups), "integer"},
+	"category": {"category", "text"},
+	"status":   {arrayPosition("status", GoalStatuses), "integer"},
+}
+
+// goalCursor is the position of the goal in a list sorted by key and grouped by group
+func goalCursor(g *Goals, key string, group string) cursor {
+	c := cursor{ID: g.Goal_id}
+
+	var value string
+	switch group {
+	case "priority":
+		value = positionCursorValue(g.Priority, goalPriorityGroups)
+	case "category":
+		value = g.Category
+	case "status":
+		value = positionCursorValue(g.Status, GoalStatuses)
+	}
+	if group != "" {
+		c.Group = &value
+	}
+
+	switch key {
+	case "target_date":
+		c.Value = dateCursorValue(g.Target_date)
+	case "title":
+		c.Value = g.Goal_text
+	case "is_completed":
+		c.Value = strconv.FormatBool(g.Is_completed)
+	default:
+		c.Value = timestampCursorValue(g.Created_at)
+	}
+	return c
+}
+
+// Retrieve one page of the user's goals, sorted, grouped and filtered as asked, with the progress of their checklists
+func (m *GoalsModel) GoalPage(userID int64, filters ListFilters) ([]*Goals, Metadata, error) {
+	args := []any{userID, nullBool(filters.Completed), nullDate(filters.From), nullDate(filters.To)}
+	where, order, args := keysetPage(filters, goalSortColumns, goalGroupColumns, "goal_id", args)
+
+	query := `
+        SELECT ` + goalColumns + `
+        FROM daily_goals` + goalCounts + `
+        WHERE user_id = $1
+        AND ($2::boolean IS NULL OR is_completed = $2)
+        AND ($3::date IS NULL OR target_date >= $3)
+        AND ($4::date IS NULL OR target_date <= $4)` + where + order
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	goals := []*Goals{}
+
+	for rows.Next() {
+		g, err := scanGoal(rows)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		goals = append(goals, g)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	n, metadata := pageMetadata(filters, len(goals), func(i int) cursor {
+		return goalCursor(goals[i], filters.sortKey(), filters.GroupBy)
+	})
+
+	return goals[:n], metadata, nil
+}
+
 // DeleteGoal removes a goal entry from the database using its ID
 func (m *GoalsModel) DeleteGoal(goalID int64, userID int64) error {
 	query := `
@@ -111,43 +326,152 @@ func (m *GoalsModel) DeleteGoal(goalID int64, userID int64) error {
 	return nil
 }
 
-// Get the goal info based on the goal
-func (m *GoalsModel) GetGoalByID(id int64) (*Goals, error) {
+// Get the goal info based on the goal, if it belongs to the user
+func (m *GoalsModel) GetGoalByID(id int64, userID int64) (*Goals, error) {
 	stmt := `
-    SELECT goal_id, user_id, goal_text, is_completed, target_date, created_at 
-    FROM daily_goals 
-    WHERE goal_id = $1`
+    SELECT ` + goalColumns + `
+    FROM daily_goals` + goalCounts + `
+    WHERE goal_id = $1 AND user_id = $2`
 
-	row := m.DB.QueryRow(stmt, id)
-
-	var g Goals
-	err := row.Scan(&g.Goal_id, &g.User_id, &g.Goal_text, &g.Is_completed, &g.Target_date, &g.Created_at)
-	if err != nil {
-		return nil, err
-	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
 
-	return &g, nil
+	return scanGoal(m.DB.QueryRowContext(ctx, stmt, id, userID))
 }
 
-// Edits an entry goal into the database
-func (m *GoalsModel) EditGoal(goal *Goals) error {
+// Edits an entry goal into the database. The goal is missed while its status is missed,
+// and a goal that is no longer missed loses the time it was marked missed.
+func (m *GoalsModel) EditGoal(goal *Goals, userID int64) error {
+	goal.syncStatus()
+
 	query := `
         UPDATE daily_goals
         SET goal_text = $1,
             is_completed = $2,
-            target_date = $3
-        WHERE goal_id = $4`
+            target_date = $3,
+            priority = $4,
+            category = $5,
+            status = $6,
+            missed_at = CASE WHEN $6 = 'missed' THEN COALESCE(missed_at, NOW()) END
+        WHERE goal_id = $7 AND user_id = $8
+        RETURNING missed_at`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	_, err := m.DB.ExecContext(
+	// Nothing is returned when the record does not exist or belongs to another user
+	err := m.DB.QueryRowContext(
 		ctx,
 		query,
 		goal.Goal_text,
 		goal.Is_completed,
 		goal.Target_date,
+		goal.Priority,
+		goal.Category,
+		goal.Status,
 		goal.Goal_id,
-	)
-	return err
+		userID,
+	).Scan(&goal.Missed_at)
+	if err != nil {
+		return err
+	}
+
+	goal.setProgress()
+	return nil
+}
+
+// SetStatus moves a goal owned by the user to another column of the board. A goal moved
+// to done is completed, and one moved anywhere else is not.
+func (m *GoalsModel) SetStatus(goalID int64, userID int64, status string) error {
+	query := `
+        UPDATE daily_goals
+        SET status = $1,
+            is_completed = ($1 = 'done'),
+            missed_at = CASE WHEN $1 = 'missed' THEN COALESCE(missed_at, NOW()) END
+        WHERE goal_id = $2 AND user_id = $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, status, goalID, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// GoalBoard returns the user's goals for the board: every goal still to do or in progress,
+// and the ones done or missed in the last 30 days. Goals are ordered most pressing first,
+// then by target date.
+func (m *GoalsModel) GoalBoard(userID int64) ([]*Goals, error) {
+	query := `
+        SELECT ` + goalColumns + `
+        FROM daily_goals` + goalCounts + `
+        WHERE user_id = $1
+        AND (status IN ('todo', 'in_progress') OR target_date >= CURRENT_DATE - 30)
+        ORDER BY ` + arrayPosition("priority", goalPriorityGroups) + `, target_date, goal_id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	goals := []*Goals{}
+	for rows.Next() {
+		g, err := scanGoal(rows)
+		if err != nil {
+			return nil, err
+		}
+		goals = append(goals, g)
+	}
+
+	return goals, rows.Err()
+}
+
+// Categories returns the categories the user has given their goals, in alphabetical order
+func (m *GoalsModel) Categories(userID int64) ([]string, error) {
+	query := `
+        SELECT DISTINCT category
+        FROM daily_goals
+        WHERE user_id = $1 AND category <> ''
+        ORDER BY category`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	categories := []string{}
+	for rows.Next() {
+		var category string
+		err := rows.Scan(&category)
+		if err != nil {
+			return nil, err
+		}
+		categories = append(categories, category)
+	}
+
+	return categories, rows.Err()
+}
+
+// ImportedUIDs returns the calendar UIDs of the user's goals that were imported from .ics files
+func (m *GoalsModel) ImportedUIDs(userID int64) (map[string]bool, error) {
+	return importedUIDs(m.DB, "daily_goals", userID)
 }
@@ -0,0 +1,215 @@
+package data
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abankelsey/study_helper/internal/validator"
+)
+
+// the page sizes lists can be asked for
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+// DefaultSort lists the newest entries first, the order lists had before they could be sorted
+const DefaultSort = "-created_at"
+
+// the sort keys each list accepts, prefixed with - to sort in descending order
+var (
+	GoalSortSafelist    = []string{"created_at", "-created_at", "target_date", "-target_date", "title", "-title", "is_completed", "-is_completed"}
+	SessionSortSafelist = []string{"created_at", "-created_at", "start_date", "-start_date", "title", "-title", "is_completed", "-is_completed"}
+	QuoteSortSafelist   = []string{"created_at", "-created_at", "content", "-content"}
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ListFilters holds the sorting, filtering and paging asked for when listing goals,
+// sessions or quotes. Zero values leave a filter off.
+type ListFilters struct {
+	Sort          string
+	SortSafelist  []string
+	Cursor        string // where the page starts, empty for the first page
+	PageSize      int
+	Completed     *bool
+	From          time.Time // date range of the target date, start date or creation date
+	To            time.Time
+	Subject       string // sessions only
+	GroupBy       string // goals only, entries of a group are listed together
+	GroupSafelist []string
+}
+
+// Metadata describes the page of a list that was returned
+type Metadata struct {
+	Sort       string `json:"sort"`
+	PageSize   int    `json:"page_size"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	HasMore    bool   `json:"has_more"`
+}
+
+// validates the sorting, grouping, filtering and paging of a list. A page after the first
+// can only continue a list sorted and grouped the same way.
+func ValidateListFilters(v *validator.Validator, f ListFilters) {
+	v.Check(slices.Contains(f.SortSafelist, f.Sort), "sort", "invalid sort value")
+	v.Check(f.GroupBy == "" || slices.Contains(f.GroupSafelist, f.GroupBy), "group", "invalid group value")
+	v.Check(validator.Between(f.PageSize, 1, MaxPageSize), "page_size", "must be between 1 and "+strconv.Itoa(MaxPageSize))
+	v.Check(f.From.IsZero() || f.To.IsZero() || !f.To.Before(f.From), "to", "must not be before the from date")
+	v.Check(validator.MaxLength(f.Subject, 50), "subject", "must not be more than 50 bytes long")
+
+	if f.Cursor != "" {
+		c, err := decodeCursor(f.Cursor)
+		v.Check(err == nil, "cursor", "invalid cursor")
+		v.Check(c.Sort == f.Sort && c.GroupBy == f.GroupBy && (f.GroupBy != "") == (c.Group != nil), "cursor", "does not match the sort and group of the list")
+	}
+}
+
+// sortKey is the sort value without its direction
+func (f ListFilters) sortKey() string {
+	return strings.TrimPrefix(f.Sort, "-")
+}
+
+// descending reports whether the list is sorted in descending order
+func (f ListFilters) descending() bool {
+	return strings.HasPrefix(f.Sort, "-")
+}
+
+// sortDirection is the SQL direction of the sort
+func (f ListFilters) sortDirection() string {
+	if f.descending() {
+		return "DESC"
+	}
+	return "ASC"
+}
+
+// cursor is the position of the last entry of a page. Value is the entry's sort value
+// written so that comparing two values as strings orders them the same way as the
+// values themselves. Sort and GroupBy record the list the cursor belongs to, since its
+// values only compare against the columns it was made from.
+type cursor struct {
+	Value string `json:"v"`
+	ID    int64  `json:"id"`
+	Date  string `json:"d,omitempty"` // the occurrence date of a recurring session
+	// the entry's group value when the list is grouped
+	Group   *string `json:"g,omitempty"`
+	Sort    string  `json:"s"`
+	GroupBy string  `json:"gb,omitempty"`
+}
+
+func encodeCursor(c cursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string) (cursor, error) {
+	var c cursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	err = json.Unmarshal(b, &c)
+	if err != nil || c.ID < 1 {
+		return c, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// timestampCursorValue writes a timestamp so it sorts as a string
+func timestampCursorValue(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000000000Z")
+}
+
+// dateCursorValue writes a date so it sorts as a string
+func dateCursorValue(t time.Time) string {
+	return t.Format("2006-01-02")
+}
+
+// nullDate passes a zero date to Postgres as NULL
+func nullDate(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
+
+// nullBool passes an unset bool to Postgres as NULL
+func nullBool(b *bool) any {
+	if b == nil {
+		return nil
+	}
+	return *b
+}
+
+// sortColumn is the SQL expression a sort key orders by, and the type cursor values are cast to
+type sortColumn struct {
+	expr string
+	cast string
+}
+
+// keysetPage builds the parts of a paged query that depend on the filters. args are the
+// query's arguments so far, and id is the tie breaking column. groups are the columns the
+// list can be grouped by, nil for lists that can not be. Groups are always in ascending
+// order, with the sort applying inside each group. It returns the condition that starts
+// the page after the cursor, the ORDER BY and LIMIT clauses, and the arguments with the
+// ones those clauses use appended.
+func keysetPage(f ListFilters, columns map[string]sortColumn, groups map[string]sortColumn, id string, args []any) (string, string, []any) {
+	col := columns[f.sortKey()]
+	dir := f.sortDirection()
+	group, grouped := groups[f.GroupBy]
+
+	where := ""
+	if c, err := decodeCursor(f.Cursor); err == nil {
+		op := ">"
+		if f.descending() {
+			op = "<"
+		}
+		args = append(args, c.Value, c.ID)
+		where = "(" + col.expr + ", " + id + ") " + op + " ($" + strconv.Itoa(len(args)-1) + "::" + col.cast + ", $" + strconv.Itoa(len(args)) + ")"
+
+		if grouped && c.Group != nil {
+			args = append(args, *c.Group)
+			value := "$" + strconv.Itoa(len(args)) + "::" + group.cast
+			where = group.expr + " > " + value + " OR (" + group.expr + " = " + value + " AND " + where + ")"
+		}
+		where = " AND (" + where + ")"
+	}
+
+	// One extra row tells whether there is another page
+	args = append(args, f.PageSize+1)
+	order := " ORDER BY " + col.expr + " " + dir + ", " + id + " " + dir + " LIMIT $" + strconv.Itoa(len(args))
+	if grouped {
+		order = " ORDER BY " + group.expr + " ASC, " + strings.TrimPrefix(order, " ORDER BY ")
+	}
+
+	return where, order, args
+}
+
+// arrayPosition is an SQL expression numbering the values of column in the order of
+// values from 1, for sorting by a column that holds one of a few words
+func arrayPosition(column string, values []string) string {
+	return "array_position(ARRAY['" + strings.Join(values, "', '") + "']::text[], " + column + ")"
+}
+
+// positionCursorValue writes the number arrayPosition gives value
+func positionCursorValue(value string, values []string) string {
+	return strconv.Itoa(slices.Index(values, value) + 1)
+}
+
+// pageMetadata trims the extra row fetched by keysetPage off the list and describes the page.
+// last returns the cursor of the entry at index i.
+func pageMetadata(f ListFilters, n int, last func(i int) cursor) (int, Metadata) {
+	metadata := Metadata{Sort: f.Sort, PageSize: f.PageSize}
+	if n > f.PageSize {
+		n = f.PageSize
+		metadata.HasMore = true
+		c := last(n - 1)
+		c.Sort, c.GroupBy = f.Sort, f.GroupBy
+		metadata.NextCursor = encodeCursor(c)
+	}
+	return n, metadata
+}
@@ -0,0 +1,67 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/abankelsey/study_helper/internal/validator"
+)
+
+func TestValidateListFiltersCursor(t *testing.T) {
+	group := "2"
+	byDate := encodeCursor(cursor{Value: "2026-10-18", ID: 7, Sort: "-target_date"})
+	byPriority := encodeCursor(cursor{Value: "2026-10-18", ID: 7, Sort: "-target_date", GroupBy: "priority", Group: &group})
+
+	tests := []struct {
+		name    string
+		sort    string
+		groupBy string
+		cursor  string
+		valid   bool
+	}{
+		{"first page", "-target_date", "", "", true},
+		{"same sort", "-target_date", "", byDate, true},
+		{"other sort column", "title", "", byDate, false},
+		{"other direction", "target_date", "", byDate, false},
+		{"same group", "-target_date", "priority", byPriority, true},
+		{"other group", "-target_date", "status", byPriority, false},
+		{"grouped cursor on an ungrouped list", "-target_date", "", byPriority, false},
+		{"ungrouped cursor on a grouped list", "-target_date", "priority", byDate, false},
+		{"not a cursor", "-target_date", "", "not a cursor", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.NewValidator()
+			ValidateListFilters(v, ListFilters{
+				Sort:          tt.sort,
+				SortSafelist:  GoalSortSafelist,
+				Cursor:        tt.cursor,
+				PageSize:      DefaultPageSize,
+				GroupBy:       tt.groupBy,
+				GroupSafelist: GoalGroupSafelist,
+			})
+			_, invalid := v.Errors["cursor"]
+			if invalid == tt.valid {
+				t.Errorf("cursor errors = %v, want valid %t", v.Errors, tt.valid)
+			}
+		})
+	}
+}
+
+func TestPageMetadataRecordsTheList(t *testing.T) {
+	f := ListFilters{Sort: "title", PageSize: 2, GroupBy: "status"}
+	n, metadata := pageMetadata(f, 3, func(i int) cursor {
+		return cursor{Value: "b", ID: int64(i + 1)}
+	})
+
+	if n != 2 || !metadata.HasMore {
+		t.Fatalf("pageMetadata() = %d, %+v", n, metadata)
+	}
+	c, err := decodeCursor(metadata.NextCursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.ID != 2 || c.Sort != "title" || c.GroupBy != "status" {
+		t.Errorf("next cursor = %+v", c)
+	}
+}
@@ -0,0 +1,218 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/abankelsey/study_helper/internal/validator"
+)
+
+// represents a checklist item of a goal
+type GoalItems struct {
+	Item_id    int64     `json:"item_id"`
+	Goal_id    int64     `json:"goal_id"`
+	Item_text  string    `json:"item_text"`
+	Is_done    bool      `json:"is_done"`
+	Position   int       `json:"position"`
+	Created_at time.Time `json:"created_at"`
+}
+
+// validates the fields of the goal items struct
+func ValidateGoalItems(v *validator.Validator, item *GoalItems) {
+	v.Check(validator.NotBlank(item.Item_text), "item_text", "This field cannot be left blank")
+	v.Check(validator.MaxLength(item.Item_text, 100), "item_text", "must not be more than 100 bytes long")
+}
+
+// GoalItemsModel struct handles database operations related to goal checklists. Every
+// change locks the goal, so the goal is completed once the last item is ticked.
+type GoalItemsModel struct {
+	DB *sql.DB
+}
+
+// ItemList returns the checklist of a goal owned by the user, in order
+func (m *GoalItemsModel) ItemList(goalID int64, userID int64) ([]*GoalItems, error) {
+	query := `
+        SELECT i.item_id, i.goal_id, i.item_text, i.is_done, i.position, i.created_at
+        FROM goal_items i
+        JOIN daily_goals g ON g.goal_id = i.goal_id
+        WHERE i.goal_id = $1 AND g.user_id = $2
+        ORDER BY i.position, i.item_id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, goalID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []*GoalItems{}
+	for rows.Next() {
+		i := &GoalItems{}
+		err := rows.Scan(&i.Item_id, &i.Goal_id, &i.Item_text, &i.Is_done, &i.Position, &i.Created_at)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+
+	return items, rows.Err()
+}
+
+// Insert adds an item to the end of the checklist of a goal owned by the user. A goal
+// that was completed is reopened, since it has something left to do again.
+func (m *GoalItemsModel) Insert(item *GoalItems, userID int64) error {
+	return m.change(item.Goal_id, userID, func(ctx context.Context, tx *sql.Tx) error {
+		query := `
+            INSERT INTO goal_items (goal_id, item_text, is_done, position)
+            VALUES ($1, $2, $3, (SELECT COALESCE(MAX(position), 0) + 1 FROM goal_items WHERE goal_id = $1))
+            RETURNING item_id, position, created_at`
+
+		return tx.QueryRowContext(ctx, query, item.Goal_id, item.Item_text, item.Is_done).Scan(&item.Item_id, &item.Position, &item.Created_at)
+	})
+}
+
+// SetDone ticks or unticks an item of a goal owned by the user
+func (m *GoalItemsModel) SetDone(itemID int64, goalID int64, userID int64, done bool) error {
+	return m.change(goalID, userID, func(ctx context.Context, tx *sql.Tx) error {
+		query := `
+            UPDATE goal_items
+            SET is_done = $1
+            WHERE item_id = $2 AND goal_id = $3`
+
+		result, err := tx.ExecContext(ctx, query, done, itemID, goalID)
+		if err != nil {
+			return err
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rowsAffected == 0 {
+			return sql.ErrNoRows
+		}
+
+		return nil
+	})
+}
+
+// Move swaps an item with the one above it, or below it when up is false. Moving the
+// first item up or the last one down leaves the checklist as it is.
+func (m *GoalItemsModel) Move(itemID int64, goalID int64, userID int64, up bool) error {
+	return m.change(goalID, userID, func(ctx context.Context, tx *sql.Tx) error {
+		var position int
+		err := tx.QueryRowContext(ctx, `SELECT position FROM goal_items WHERE item_id = $1 AND goal_id = $2`, itemID, goalID).Scan(&position)
+		if err != nil {
+			return err
+		}
+
+		query := `
+            SELECT item_id, position
+            FROM goal_items
+            WHERE goal_id = $1 AND (position, item_id) > ($2, $3)
+            ORDER BY position, item_id
+            LIMIT 1`
+		if up {
+			query = `
+            SELECT item_id, position
+            FROM goal_items
+            WHERE goal_id = $1 AND (position, item_id) < ($2, $3)
+            ORDER BY position DESC, item_id DESC
+            LIMIT 1`
+		}
+
+		var neighbourID int64
+		var neighbourPosition int
+		err = tx.QueryRowContext(ctx, query, goalID, position, itemID).Scan(&neighbourID, &neighbourPosition)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil
+			}
+			return err
+		}
+
+		// Items that somehow share a position are pulled apart so the swap shows
+		if neighbourPosition == position {
+			if up {
+				neighbourPosition++
+			} else {
+				position++
+			}
+		}
+
+		query = `
+            UPDATE goal_items
+            SET position = CASE WHEN item_id = $1 THEN $2::integer ELSE $3::integer END
+            WHERE item_id IN ($1, $4)`
+
+		_, err = tx.ExecContext(ctx, query, itemID, neighbourPosition, position, neighbourID)
+		return err
+	})
+}
+
+// Delete removes an item from the checklist of a goal owned by the user
+func (m *GoalItemsModel) Delete(itemID int64, goalID int64, userID int64) error {
+	return m.change(goalID, userID, func(ctx context.Context, tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, `DELETE FROM goal_items WHERE item_id = $1 AND goal_id = $2`, itemID, goalID)
+		if err != nil {
+			return err
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rowsAffected == 0 {
+			return sql.ErrNoRows
+		}
+
+		return nil
+	})
+}
+
+// change runs fn inside a transaction that locks the goal, then completes the goal when
+// every item of its checklist is done and reopens it as in progress when one is not. A
+// goal with an empty checklist keeps the status it was given. Returns sql.ErrNoRows when the goal
+// does not exist or belongs to another user.
+func (m *GoalItemsModel) change(goalID int64, userID int64, fn func(ctx context.Context, tx *sql.Tx) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var id int64
+	err = tx.QueryRowContext(ctx, `SELECT goal_id FROM daily_goals WHERE goal_id = $1 AND user_id = $2 FOR UPDATE`, goalID, userID).Scan(&id)
+	if err != nil {
+		return err
+	}
+
+	err = fn(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	query := `
+        UPDATE daily_goals g
+        SET is_completed = items.all_done,
+            status = CASE WHEN items.all_done THEN 'done' WHEN g.status = 'done' THEN 'in_progress' ELSE g.status END,
+            missed_at = CASE WHEN items.all_done THEN NULL ELSE g.missed_at END
+        FROM (SELECT bool_and(is_done) AS all_done FROM goal_items WHERE goal_id = $1) items
+        WHERE g.goal_id = $1
+        AND items.all_done IS NOT NULL
+        AND COALESCE(g.is_completed, FALSE) <> items.all_done`
+
+	_, err = tx.ExecContext(ctx, query, goalID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,111 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// what happens to the user's goals left unfinished past their target date
+const (
+	GoalRollOver   = "roll" // moved to the user's new day
+	GoalMarkMissed = "miss" // kept on their date and marked missed
+)
+
+// GoalRollOverModes are the settings a user can pick for unfinished goals
+var GoalRollOverModes = []string{GoalRollOver, GoalMarkMissed}
+
+// represents one time an unfinished goal was rolled forward or marked missed
+type GoalRollOvers struct {
+	Rollover_id int64      `json:"rollover_id"`
+	Goal_id     int64      `json:"goal_id"`
+	Action      string     `json:"action"` // rolled or missed
+	From_date   time.Time  `json:"from_date"`
+	To_date     *time.Time `json:"to_date,omitempty"` // empty when the goal was marked missed
+	Created_at  time.Time  `json:"created_at"`
+}
+
+// GoalRollOversModel struct handles rolling over unfinished goals and their history
+type GoalRollOversModel struct {
+	DB *sql.DB
+}
+
+// RollOver deals with every goal still to do or in progress whose target date is over in
+// its user's time zone. Depending on the user's setting the goal is moved to their today or marked
+// missed, and either is recorded in its history. Goals another server is rolling over at
+// the same time are skipped, so running it again right away does nothing. Returns how many
+// goals were rolled and how many were marked missed.
+func (m *GoalRollOversModel) RollOver(ctx context.Context) (int, int, error) {
+	query := `
+        WITH due AS (
+            SELECT g.goal_id, g.target_date, u.goal_rollover AS mode, (NOW() AT TIME ZONE u.timezone)::date AS today
+            FROM daily_goals g
+            JOIN users u ON u.user_id = g.user_id
+            WHERE NOT COALESCE(g.is_completed, FALSE)
+            AND g.missed_at IS NULL
+            AND g.target_date < (NOW() AT TIME ZONE u.timezone)::date
+            FOR UPDATE OF g SKIP LOCKED
+        ),
+        changed AS (
+            UPDATE daily_goals g
+            SET target_date = CASE WHEN d.mode = 'roll' THEN d.today ELSE g.target_date END,
+                missed_at = CASE WHEN d.mode = 'roll' THEN NULL ELSE NOW() END,
+                status = CASE WHEN d.mode = 'roll' THEN g.status ELSE 'missed' END
+            FROM due d
+            WHERE g.goal_id = d.goal_id
+            RETURNING g.goal_id, d.target_date AS from_date, d.today, d.mode
+        ),
+        recorded AS (
+            INSERT INTO goal_rollovers (goal_id, action, from_date, to_date)
+            SELECT goal_id,
+                   CASE WHEN mode = 'roll' THEN 'rolled' ELSE 'missed' END,
+                   from_date,
+                   CASE WHEN mode = 'roll' THEN today END
+            FROM changed
+            RETURNING action
+        )
+        SELECT COUNT(*) FILTER (WHERE action = 'rolled'), COUNT(*) FILTER (WHERE action = 'missed')
+        FROM recorded`
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	var rolled, missed int
+	err := m.DB.QueryRowContext(ctx, query).Scan(&rolled, &missed)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return rolled, missed, nil
+}
+
+// History returns the roll-overs of a goal owned by the user, oldest first
+func (m *GoalRollOversModel) History(goalID int64, userID int64) ([]*GoalRollOvers, error) {
+	query := `
+        SELECT r.rollover_id, r.goal_id, r.action, r.from_date, r.to_date, r.created_at
+        FROM goal_rollovers r
+        JOIN daily_goals g ON g.goal_id = r.goal_id
+        WHERE r.goal_id = $1 AND g.user_id = $2
+        ORDER BY r.created_at, r.rollover_id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, goalID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := []*GoalRollOvers{}
+	for rows.Next() {
+		r := &GoalRollOvers{}
+		err := rows.Scan(&r.Rollover_id, &r.Goal_id, &r.Action, &r.From_date, &r.To_date, &r.Created_at)
+		if err != nil {
+			return nil, err
+		}
+		history = append(history, r)
+	}
+
+	return history, rows.Err()
+}
@@ -0,0 +1,148 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/abankelsey/study_helper/internal/migrate"
+	"github.com/abankelsey/study_helper/migrations"
+	_ "github.com/lib/pq"
+)
+
+// testDB connects to the database named by STUDY_HELPER_TEST_DSN and brings its schema
+// up to date. Tests that need Postgres are skipped when it is not set.
+func testDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	dsn := os.Getenv("STUDY_HELPER_TEST_DSN")
+	if dsn == "" {
+		t.Skip("STUDY_HELPER_TEST_DSN is not set")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	m, err := migrate.New(db, migrations.FS, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = m.Up(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+// testUser creates a user that is deleted, with everything it owns, when the test ends
+func testUser(t *testing.T, db *sql.DB, name string) int64 {
+	t.Helper()
+
+	u := &Users{
+		Name:      name,
+		Email:     fmt.Sprintf("%s-%d@example.com", name, time.Now().UnixNano()),
+		Activated: true,
+	}
+	err := (&UsersModel{DB: db}).Insert(u, "pa55word1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Exec("DELETE FROM users WHERE user_id = $1", u.User_id)
+	})
+
+	return u.User_id
+}
+
+func TestOtherUsersRecordsAreNotFound(t *testing.T) {
+	db := testDB(t)
+	owner := testUser(t, db, "owner")
+	other := testUser(t, db, "other")
+
+	goals := &GoalsModel{DB: db}
+	sessions := &SessionsModel{DB: db}
+	quotes := &QuotesModel{DB: db}
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+
+	goal := &Goals{User_id: owner, Goal_text: "Revise calculus", Target_date: today}
+	if err := goals.Insert(goal); err != nil {
+		t.Fatal(err)
+	}
+	session := &Sessions{User_id: owner, Title: "Calculus", Subject: "Maths", Start_date: today, End_date: today.Add(time.Hour)}
+	if err := sessions.Insert(session); err != nil {
+		t.Fatal(err)
+	}
+	quote := &Quotes{User_id: owner, Content: "Keep going"}
+	if err := quotes.Insert(quote); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		call func() error
+	}{
+		{"GetGoalByID", func() error {
+			_, err := goals.GetGoalByID(goal.Goal_id, other)
+			return err
+		}},
+		{"EditGoal", func() error {
+			edited := *goal
+			edited.Goal_text = "Taken over"
+			return goals.EditGoal(&edited, other)
+		}},
+		{"DeleteGoal", func() error { return goals.DeleteGoal(goal.Goal_id, other) }},
+		{"GetSessionByID", func() error {
+			_, err := sessions.GetSessionByID(session.Session_id, other)
+			return err
+		}},
+		{"EditSession", func() error {
+			edited := *session
+			edited.Title = "Taken over"
+			return sessions.EditSession(&edited, other)
+		}},
+		{"DeleteSession", func() error { return sessions.DeleteSession(session.Session_id, other) }},
+		{"GetQuoteByID", func() error {
+			_, err := quotes.GetQuoteByID(quote.Quote_id, other)
+			return err
+		}},
+		{"EditQuote", func() error {
+			edited := *quote
+			edited.Content = "Taken over"
+			return quotes.EditQuote(&edited, other)
+		}},
+		{"DeleteQuote", func() error { return quotes.DeleteQuote(quote.Quote_id, other) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.call(); !errors.Is(err, sql.ErrNoRows) {
+				t.Errorf("%s as another user error = %v, want sql.ErrNoRows", tt.name, err)
+			}
+		})
+	}
+
+	// The owner's records are left as they were
+	g, err := goals.GetGoalByID(goal.Goal_id, owner)
+	if err != nil || g.Goal_text != "Revise calculus" {
+		t.Errorf("owner's goal = %+v, %v", g, err)
+	}
+	s, err := sessions.GetSessionByID(session.Session_id, owner)
+	if err != nil || s.Title != "Calculus" {
+		t.Errorf("owner's session = %+v, %v", s, err)
+	}
+	q, err := quotes.GetQuoteByID(quote.Quote_id, owner)
+	if err != nil || q.Content != "Keep going" {
+		t.Errorf("owner's quote = %+v, %v", q, err)
+	}
+}
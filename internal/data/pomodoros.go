@@ -0,0 +1,246 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/abankelsey/study_helper/internal/validator"
+)
+
+// the phases of a pomodoro cycle
+const (
+	PhaseWork       = "work"
+	PhaseShortBreak = "short_break"
+	PhaseLongBreak  = "long_break"
+)
+
+var ErrPhaseNotFinished = errors.New("pomodoro phase has not finished yet")
+
+// represents the pomodoro settings and progress of a study session
+type Pomodoros struct {
+	Session_id               int64     `json:"session_id"`
+	Work_minutes             int       `json:"work_minutes"`
+	Short_break_minutes      int       `json:"short_break_minutes"`
+	Long_break_minutes       int       `json:"long_break_minutes"`
+	Cycles_before_long_break int       `json:"cycles_before_long_break"`
+	Phase                    string    `json:"phase"`
+	Cycle                    int       `json:"cycle"`
+	Phase_started_at         time.Time `json:"phase_started_at"`
+	Completed_pomodoros      int       `json:"completed_pomodoros"`
+}
+
+// validates the fields of the pomodoros struct
+func ValidatePomodoros(v *validator.Validator, p *Pomodoros) {
+	v.Check(validator.Between(p.Work_minutes, 1, 120), "work_minutes", "Must be between 1 and 120 minutes")
+	v.Check(validator.Between(p.Short_break_minutes, 1, 60), "short_break_minutes", "Must be between 1 and 60 minutes")
+	v.Check(validator.Between(p.Long_break_minutes, 1, 120), "long_break_minutes", "Must be between 1 and 120 minutes")
+	v.Check(validator.Between(p.Cycles_before_long_break, 1, 12), "cycles_before_long_break", "Must be between 1 and 12 cycles")
+}
+
+// PhaseLength returns how long the current phase lasts
+func (p *Pomodoros) PhaseLength() time.Duration {
+	switch p.Phase {
+	case PhaseShortBreak:
+		return time.Duration(p.Short_break_minutes) * time.Minute
+	case PhaseLongBreak:
+		return time.Duration(p.Long_break_minutes) * time.Minute
+	default:
+		return time.Duration(p.Work_minutes) * time.Minute
+	}
+}
+
+// RemainingSeconds returns the seconds left in the current phase, never below zero
+func (p *Pomodoros) RemainingSeconds() int64 {
+	remaining := p.PhaseLength() - time.Since(p.Phase_started_at)
+	if remaining < 0 {
+		return 0
+	}
+	return int64(remaining.Seconds())
+}
+
+// next moves the pomodoro on to the phase that follows the current one
+func (p *Pomodoros) next() {
+	switch p.Phase {
+	case PhaseWork:
+		if p.Cycle >= p.Cycles_before_long_break {
+			p.Phase = PhaseLongBreak
+		} else {
+			p.Phase = PhaseShortBreak
+		}
+	case PhaseShortBreak:
+		p.Phase = PhaseWork
+		p.Cycle++
+	case PhaseLongBreak:
+		p.Phase = PhaseWork
+		p.Cycle = 1
+	}
+}
+
+// PomodorosModel struct handles database operations related to pomodoros
+type PomodorosModel struct {
+	DB *sql.DB
+}
+
+// Get returns the pomodoro of a session owned by the user
+func (m *PomodorosModel) Get(sessionID int64, userID int64) (*Pomodoros, error) {
+	query := `
+    SELECT p.session_id, p.work_minutes, p.short_break_minutes, p.long_break_minutes, p.cycles_before_long_break,
+           p.phase, p.cycle, p.phase_started_at,
+           (SELECT COUNT(*) FROM pomodoros c WHERE c.session_id = p.session_id)
+    FROM session_pomodoros p
+    JOIN study_sessions s ON s.session_id = p.session_id
+    WHERE p.session_id = $1 AND s.user_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var p Pomodoros
+	err := m.DB.QueryRowContext(ctx, query, sessionID, userID).Scan(
+		&p.Session_id,
+		&p.Work_minutes,
+		&p.Short_break_minutes,
+		&p.Long_break_minutes,
+		&p.Cycles_before_long_break,
+		&p.Phase,
+		&p.Cycle,
+		&p.Phase_started_at,
+		&p.Completed_pomodoros,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+// Start saves the pomodoro settings of a session and begins the first work phase
+func (m *PomodorosModel) Start(p *Pomodoros, userID int64) error {
+	query := `
+    INSERT INTO session_pomodoros (session_id, work_minutes, short_break_minutes, long_break_minutes, cycles_before_long_break)
+    SELECT session_id, $3, $4, $5, $6
+    FROM study_sessions
+    WHERE session_id = $1 AND user_id = $2
+    ON CONFLICT (session_id) DO UPDATE
+    SET work_minutes = EXCLUDED.work_minutes,
+        short_break_minutes = EXCLUDED.short_break_minutes,
+        long_break_minutes = EXCLUDED.long_break_minutes,
+        cycles_before_long_break = EXCLUDED.cycles_before_long_break,
+        phase = 'work',
+        cycle = 1,
+        phase_started_at = NOW()
+    RETURNING phase, cycle, phase_started_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(
+		ctx,
+		query,
+		p.Session_id,
+		userID,
+		p.Work_minutes,
+		p.Short_break_minutes,
+		p.Long_break_minutes,
+		p.Cycles_before_long_break,
+	).Scan(&p.Phase, &p.Cycle, &p.Phase_started_at)
+}
+
+// Advance ends the current phase and starts the next one. A finished work phase is
+// recorded as a completed pomodoro, a skipped one is not.
+func (m *PomodorosModel) Advance(sessionID int64, userID int64, skip bool) (*Pomodoros, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+    SELECT p.session_id, p.work_minutes, p.short_break_minutes, p.long_break_minutes, p.cycles_before_long_break,
+           p.phase, p.cycle, p.phase_started_at
+    FROM session_pomodoros p
+    JOIN study_sessions s ON s.session_id = p.session_id
+    WHERE p.session_id = $1 AND s.user_id = $2
+    FOR UPDATE OF p`
+
+	var p Pomodoros
+	err = tx.QueryRowContext(ctx, query, sessionID, userID).Scan(
+		&p.Session_id,
+		&p.Work_minutes,
+		&p.Short_break_minutes,
+		&p.Long_break_minutes,
+		&p.Cycles_before_long_break,
+		&p.Phase,
+		&p.Cycle,
+		&p.Phase_started_at,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if !skip && p.RemainingSeconds() > 0 {
+		return nil, ErrPhaseNotFinished
+	}
+
+	if p.Phase == PhaseWork && !skip {
+		query = `
+        INSERT INTO pomodoros (session_id, cycle, work_minutes, started_at)
+        VALUES ($1, $2, $3, $4)`
+
+		_, err = tx.ExecContext(ctx, query, p.Session_id, p.Cycle, p.Work_minutes, p.Phase_started_at)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	p.next()
+
+	query = `
+    UPDATE session_pomodoros
+    SET phase = $1, cycle = $2, phase_started_at = NOW()
+    WHERE session_id = $3
+    RETURNING phase_started_at, (SELECT COUNT(*) FROM pomodoros WHERE session_id = $3)`
+
+	err = tx.QueryRowContext(ctx, query, p.Phase, p.Cycle, p.Session_id).Scan(&p.Phase_started_at, &p.Completed_pomodoros)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+// End switches a session out of pomodoro mode, keeping the completed pomodoros
+func (m *PomodorosModel) End(sessionID int64, userID int64) error {
+	query := `
+    DELETE FROM session_pomodoros p
+    USING study_sessions s
+    WHERE s.session_id = p.session_id AND p.session_id = $1 AND s.user_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, sessionID, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
@@ -81,6 +81,64 @@ func (m *QuotesModel) QuoteList(userID int64) ([]*Quotes, error) {
 	return quotes, nil
 }
 
+// quoteSortColumns are the columns the quote sort keys order by
+var quoteSortColumns = map[string]sortColumn{
+	"created_at": {"created_at", "timestamptz"},
+	"content":    {"content", "text"},
+}
+
+// quoteCursor is the position of the quote in a list sorted by key
+func quoteCursor(q *Quotes, key string) cursor {
+	if key == "content" {
+		return cursor{Value: q.Content, ID: q.Quote_id}
+	}
+	return cursor{Value: timestampCursorValue(q.Created_at), ID: q.Quote_id}
+}
+
+// Retrieve one page of the user's quotes, sorted and filtered as asked. The date range
+// applies to the day each quote was added.
+func (m *QuotesModel) QuotePage(userID int64, filters ListFilters) ([]*Quotes, Metadata, error) {
+	args := []any{userID, nullDate(filters.From), nullDate(filters.To)}
+	where, order, args := keysetPage(filters, quoteSortColumns, nil, "quote_id", args)
+
+	query := `
+        SELECT quote_id, content, user_id, created_at
+        FROM quotes
+        WHERE user_id = $1
+        AND ($2::date IS NULL OR created_at >= $2::date)
+        AND ($3::date IS NULL OR created_at < $3::date + 1)` + where + order
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	quotes := []*Quotes{}
+
+	for rows.Next() {
+		q := &Quotes{}
+		err := rows.Scan(&q.Quote_id, &q.Content, &q.User_id, &q.Created_at)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		quotes = append(quotes, q)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	n, metadata := pageMetadata(filters, len(quotes), func(i int) cursor {
+		return quoteCursor(quotes[i], filters.sortKey())
+	})
+
+	return quotes[:n], metadata, nil
+}
+
 func (m *QuotesModel) DeleteQuote(quoteID int64, userID int64) error {
 	query := `
     DELETE FROM quotes WHERE quote_id = $1 AND user_id = $2`
@@ -104,3 +162,52 @@ func (m *QuotesModel) DeleteQuote(quoteID int64, userID int64) error {
 
 	return nil
 }
+
+// Get the quote info based on the quote, if it belongs to the user
+func (m *QuotesModel) GetQuoteByID(id int64, userID int64) (*Quotes, error) {
+	stmt := `
+    SELECT quote_id, content, user_id, created_at
+    FROM quotes
+    WHERE quote_id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	row := m.DB.QueryRowContext(ctx, stmt, id, userID)
+
+	var q Quotes
+	err := row.Scan(&q.Quote_id, &q.Content, &q.User_id, &q.Created_at)
+	if err != nil {
+		return nil, err
+	}
+
+	return &q, nil
+}
+
+// Edits a quote entry in the database
+func (m *QuotesModel) EditQuote(quote *Quotes, userID int64) error {
+	query := `
+        UPDATE quotes
+        SET content = $1
+        WHERE quote_id = $2 AND user_id = $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, quote.Content, quote.Quote_id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	// Nothing was changed when the record does not exist or belongs to another user
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
@@ -0,0 +1,170 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"html"
+	"html/template"
+	"strings"
+	"time"
+
+	"github.com/abankelsey/study_helper/internal/validator"
+)
+
+// the kinds of entries a search can find
+const (
+	SearchGoal    = "goal"
+	SearchSession = "session"
+	SearchQuote   = "quote"
+)
+
+// SearchLimit is the most results a search returns
+const SearchLimit = 50
+
+// the markers ts_headline puts around matched words. They are control characters so they
+// can not clash with anything a user typed.
+const (
+	highlightStart = "\x02"
+	highlightStop  = "\x03"
+)
+
+// represents a goal, session or quote matching a search
+type SearchResult struct {
+	Type    string    `json:"type"`
+	ID      int64     `json:"id"`
+	Title   string    `json:"title"`
+	Snippet string    `json:"snippet"` // the matched text, with highlight markers around matched words
+	Rank    float64   `json:"rank"`
+	Date    time.Time `json:"date"` // the target date, start date or the day a quote was added
+}
+
+// counts how many entries of each kind match a search
+type SearchFacets struct {
+	Goals    int `json:"goals"`
+	Sessions int `json:"sessions"`
+	Quotes   int `json:"quotes"`
+}
+
+// represents the results of a search
+type Search struct {
+	Query   string          `json:"query"`
+	Type    string          `json:"type,omitempty"` // only results of this kind are returned when set
+	Results []*SearchResult `json:"results"`
+	Facets  SearchFacets    `json:"facets"`
+}
+
+// Total is the number of entries matching the search, of every kind
+func (f SearchFacets) Total() int {
+	return f.Goals + f.Sessions + f.Quotes
+}
+
+// HighlightedSnippet is the snippet as HTML with the matched words in <mark> tags. Everything
+// else is escaped.
+func (r *SearchResult) HighlightedSnippet() template.HTML {
+	s := html.EscapeString(r.Snippet)
+	s = strings.ReplaceAll(s, highlightStart, "<mark>")
+	s = strings.ReplaceAll(s, highlightStop, "</mark>")
+	return template.HTML(s)
+}
+
+// validates the search box and the kind of result asked for
+func ValidateSearch(v *validator.Validator, search *Search) {
+	v.Check(validator.NotBlank(search.Query), "q", "Enter something to search for")
+	v.Check(validator.MaxLength(search.Query, 200), "q", "must not be more than 200 bytes long")
+	v.Check(search.Type == "" || search.Type == SearchGoal || search.Type == SearchSession || search.Type == SearchQuote, "type", "must be goal, session or quote")
+}
+
+// SearchModel struct handles full-text search over goals, sessions and quotes
+type SearchModel struct {
+	DB *sql.DB
+}
+
+// Search finds the user's goals, sessions and quotes matching the query, best matches
+// first. The query uses web search syntax, so "quoted phrases", or and -excluded words work.
+// Snippets are only made for the returned page of results, while the facets count every match.
+func (m *SearchModel) Search(userID int64, search *Search) error {
+	query := `
+    WITH q AS (
+        SELECT websearch_to_tsquery('english', $2) AS query
+    ),
+    matches AS (
+        SELECT 'goal' AS kind, g.goal_id AS id, ts_rank(g.search_vector, q.query) AS rank, g.target_date::timestamptz AS date
+        FROM daily_goals g, q
+        WHERE g.user_id = $1 AND g.search_vector @@ q.query
+        UNION ALL
+        SELECT 'session', s.session_id, ts_rank(s.search_vector, q.query), s.start_date::timestamptz
+        FROM study_sessions s, q
+        WHERE s.user_id = $1 AND s.search_vector @@ q.query
+        UNION ALL
+        SELECT 'quote', qu.quote_id, ts_rank(qu.search_vector, q.query), qu.created_at
+        FROM quotes qu, q
+        WHERE qu.user_id = $1 AND qu.search_vector @@ q.query
+    ),
+    facets AS (
+        SELECT COUNT(*) FILTER (WHERE kind = 'goal') AS goals,
+               COUNT(*) FILTER (WHERE kind = 'session') AS sessions,
+               COUNT(*) FILTER (WHERE kind = 'quote') AS quotes
+        FROM matches
+    ),
+    page AS (
+        SELECT * FROM matches
+        WHERE $3 = '' OR kind = $3
+        ORDER BY rank DESC, date DESC, id DESC
+        LIMIT $4
+    )
+    SELECT f.goals, f.sessions, f.quotes, p.kind, p.id, p.rank, p.date,
+           COALESCE(g.goal_text, s.title, qu.content),
+           ts_headline('english',
+               CASE p.kind
+                   WHEN 'goal' THEN g.goal_text
+                   WHEN 'session' THEN concat_ws(' · ', s.title, sub.name, s.description)
+                   ELSE qu.content
+               END,
+               q.query, 'StartSel="' || chr(2) || '", StopSel="' || chr(3) || '", MaxFragments=2, MaxWords=20, MinWords=5')
+    FROM facets f
+    CROSS JOIN q
+    LEFT JOIN page p ON TRUE
+    LEFT JOIN daily_goals g ON p.kind = 'goal' AND g.goal_id = p.id
+    LEFT JOIN study_sessions s ON p.kind = 'session' AND s.session_id = p.id
+    LEFT JOIN subjects sub ON sub.subject_id = s.subject_id
+    LEFT JOIN quotes qu ON p.kind = 'quote' AND qu.quote_id = p.id
+    ORDER BY p.rank DESC, p.date DESC, p.id DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, search.Query, search.Type, SearchLimit)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	search.Results = []*SearchResult{}
+
+	// Every row carries the facets. With no results there is a single row of facets only.
+	for rows.Next() {
+		var kind, title, snippet sql.NullString
+		var id sql.NullInt64
+		var rank sql.NullFloat64
+		var date sql.NullTime
+
+		err := rows.Scan(&search.Facets.Goals, &search.Facets.Sessions, &search.Facets.Quotes, &kind, &id, &rank, &date, &title, &snippet)
+		if err != nil {
+			return err
+		}
+		if !kind.Valid {
+			continue
+		}
+
+		search.Results = append(search.Results, &SearchResult{
+			Type:    kind.String,
+			ID:      id.Int64,
+			Title:   title.String,
+			Snippet: snippet.String,
+			Rank:    rank.Float64,
+			Date:    date.Time,
+		})
+	}
+
+	return rows.Err()
+}
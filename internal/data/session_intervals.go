@@ -0,0 +1,299 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// the states a study session timer can be in
+const (
+	TimerIdle    = "idle"
+	TimerRunning = "running"
+	TimerPaused  = "paused"
+	TimerStopped = "stopped"
+)
+
+var ErrTimerInvalidAction = errors.New("timer action not allowed in the current state")
+
+// represents a stretch of time where the session timer was running
+type SessionIntervals struct {
+	Interval_id     int64      `json:"interval_id"`
+	Session_id      int64      `json:"session_id"`
+	Occurrence_date *time.Time `json:"occurrence_date,omitempty"`
+	Start_action    string     `json:"start_action"`
+	Started_at      time.Time  `json:"started_at"`
+	End_action      string     `json:"end_action,omitempty"`
+	Ended_at        *time.Time `json:"ended_at,omitempty"`
+}
+
+// represents the current state of a session timer
+type TimerState struct {
+	Session_id      int64               `json:"session_id"`
+	Occurrence_date *time.Time          `json:"occurrence_date,omitempty"`
+	Status          string              `json:"status"`
+	Actual_seconds  int64               `json:"actual_seconds"`
+	Stopped_at      *time.Time          `json:"stopped_at,omitempty"`
+	Intervals       []*SessionIntervals `json:"intervals"`
+}
+
+// SessionIntervalsModel struct handles database operations related to session timers
+type SessionIntervalsModel struct {
+	DB *sql.DB
+}
+
+// timerStoppedAt returns when the timer of a session owned by the user was stopped. A
+// recurring session has a timer for each occurrence, named by date, which is stopped on
+// the occurrence's exception. date is the zero time for a one-off session. With lock the
+// session row stays locked until the transaction ends.
+func timerStoppedAt(ctx context.Context, q querier, sessionID int64, userID int64, date time.Time, lock bool) (*time.Time, error) {
+	s := &Sessions{Session_id: sessionID}
+	var stoppedAt *time.Time
+
+	query := `
+    SELECT rrule, start_date, stopped_at
+    FROM study_sessions
+    WHERE session_id = $1 AND user_id = $2`
+	if lock {
+		query += `
+    FOR UPDATE`
+	}
+
+	err := q.QueryRowContext(ctx, query, sessionID, userID).Scan(&s.Rrule, &s.Start_date, &stoppedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.Rrule == "" {
+		if !date.IsZero() {
+			return nil, ErrNotAnOccurrence
+		}
+		return stoppedAt, nil
+	}
+	if !s.IsOccurrence(date) {
+		return nil, ErrNotAnOccurrence
+	}
+
+	var cancelled bool
+	stoppedAt = nil
+	query = `
+    SELECT is_cancelled, stopped_at
+    FROM session_exceptions
+    WHERE session_id = $1 AND occurrence_date = $2`
+
+	err = q.QueryRowContext(ctx, query, sessionID, date).Scan(&cancelled, &stoppedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if cancelled {
+		return nil, sql.ErrNoRows
+	}
+
+	return stoppedAt, nil
+}
+
+// State returns the timer state and logged intervals of a session owned by the user, or of
+// the occurrence of a recurring session on date
+func (m *SessionIntervalsModel) State(sessionID int64, userID int64, date time.Time) (*TimerState, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	state := &TimerState{Session_id: sessionID}
+	if !date.IsZero() {
+		state.Occurrence_date = &date
+	}
+
+	stoppedAt, err := timerStoppedAt(ctx, m.DB, sessionID, userID, date, false)
+	if err != nil {
+		return nil, err
+	}
+	state.Stopped_at = stoppedAt
+
+	query := `
+    SELECT interval_id, session_id, occurrence_date, start_action, started_at, COALESCE(end_action, ''), ended_at
+    FROM session_intervals
+    WHERE session_id = $1 AND occurrence_date IS NOT DISTINCT FROM $2::date
+    ORDER BY started_at, interval_id`
+
+	rows, err := m.DB.QueryContext(ctx, query, sessionID, nullDate(date))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		i := &SessionIntervals{}
+		err := rows.Scan(&i.Interval_id, &i.Session_id, &i.Occurrence_date, &i.Start_action, &i.Started_at, &i.End_action, &i.Ended_at)
+		if err != nil {
+			return nil, err
+		}
+		state.Intervals = append(state.Intervals, i)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	for _, i := range state.Intervals {
+		end := now
+		if i.Ended_at != nil {
+			end = *i.Ended_at
+		}
+		state.Actual_seconds += int64(end.Sub(i.Started_at).Seconds())
+	}
+
+	switch {
+	case state.Stopped_at != nil:
+		state.Status = TimerStopped
+	case len(state.Intervals) == 0:
+		state.Status = TimerIdle
+	case state.Intervals[len(state.Intervals)-1].Ended_at == nil:
+		state.Status = TimerRunning
+	default:
+		state.Status = TimerPaused
+	}
+
+	return state, nil
+}
+
+// Start begins timing a session that has never been started
+func (m *SessionIntervalsModel) Start(sessionID int64, userID int64, date time.Time) error {
+	return m.transition(sessionID, userID, date, "start")
+}
+
+// Pause closes the running interval of a session
+func (m *SessionIntervalsModel) Pause(sessionID int64, userID int64, date time.Time) error {
+	return m.transition(sessionID, userID, date, "pause")
+}
+
+// Resume opens a new interval on a paused session
+func (m *SessionIntervalsModel) Resume(sessionID int64, userID int64, date time.Time) error {
+	return m.transition(sessionID, userID, date, "resume")
+}
+
+// Stop closes any running interval and marks the session, or only its occurrence, as completed
+func (m *SessionIntervalsModel) Stop(sessionID int64, userID int64, date time.Time) error {
+	return m.transition(sessionID, userID, date, "stop")
+}
+
+// transition applies a timer action inside a transaction that locks the session row
+func (m *SessionIntervalsModel) transition(sessionID int64, userID int64, date time.Time, action string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Lock the session so concurrent clicks cannot open two intervals
+	stoppedAt, err := timerStoppedAt(ctx, tx, sessionID, userID, date, true)
+	if err != nil {
+		return err
+	}
+	if stoppedAt != nil {
+		return ErrTimerInvalidAction
+	}
+	occurrence := nullDate(date)
+
+	var intervals, open int
+	query := `
+    SELECT COUNT(*), COUNT(*) FILTER (WHERE ended_at IS NULL)
+    FROM session_intervals
+    WHERE session_id = $1 AND occurrence_date IS NOT DISTINCT FROM $2::date`
+
+	err = tx.QueryRowContext(ctx, query, sessionID, occurrence).Scan(&intervals, &open)
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case "start", "resume":
+		if open > 0 || (action == "start") != (intervals == 0) {
+			return ErrTimerInvalidAction
+		}
+
+		query = `
+        INSERT INTO session_intervals (session_id, occurrence_date, start_action)
+        VALUES ($1, $2, $3)`
+
+		_, err = tx.ExecContext(ctx, query, sessionID, occurrence, action)
+		if err != nil {
+			return err
+		}
+
+		// A timed occurrence gets an exception, which lists it with its own minutes
+		if !date.IsZero() {
+			query = `
+            INSERT INTO session_exceptions (session_id, occurrence_date)
+            VALUES ($1, $2)
+            ON CONFLICT (session_id, occurrence_date) DO NOTHING`
+
+			_, err = tx.ExecContext(ctx, query, sessionID, date)
+			if err != nil {
+				return err
+			}
+		}
+
+	case "pause":
+		if open == 0 {
+			return ErrTimerInvalidAction
+		}
+
+		query = `
+        UPDATE session_intervals
+        SET ended_at = NOW(), end_action = 'pause'
+        WHERE session_id = $1 AND occurrence_date IS NOT DISTINCT FROM $2::date AND ended_at IS NULL`
+
+		_, err = tx.ExecContext(ctx, query, sessionID, occurrence)
+		if err != nil {
+			return err
+		}
+
+	case "stop":
+		if intervals == 0 {
+			return ErrTimerInvalidAction
+		}
+
+		query = `
+        UPDATE session_intervals
+        SET ended_at = NOW(), end_action = 'stop'
+        WHERE session_id = $1 AND occurrence_date IS NOT DISTINCT FROM $2::date AND ended_at IS NULL`
+
+		_, err = tx.ExecContext(ctx, query, sessionID, occurrence)
+		if err != nil {
+			return err
+		}
+
+		// Only a stopped timer completes the session, and the rest of a series stays open
+		query = `
+        UPDATE study_sessions
+        SET stopped_at = NOW(), is_completed = TRUE
+        WHERE session_id = $1`
+		args := []any{sessionID}
+		if !date.IsZero() {
+			query = `
+            INSERT INTO session_exceptions (session_id, occurrence_date, is_completed, stopped_at)
+            VALUES ($1, $2, TRUE, NOW())
+            ON CONFLICT (session_id, occurrence_date) DO UPDATE
+            SET is_completed = TRUE, stopped_at = NOW()`
+			args = append(args, date)
+		}
+
+		_, err = tx.ExecContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+
+	default:
+		return ErrTimerInvalidAction
+	}
+
+	return tx.Commit()
+}
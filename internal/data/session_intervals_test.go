@@ -0,0 +1,56 @@
+package data
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStoppingAnOccurrenceLeavesTheSeriesOpen(t *testing.T) {
+	db := testDB(t)
+	user := testUser(t, db, "timer")
+
+	sessions := &SessionsModel{DB: db}
+	intervals := &SessionIntervalsModel{DB: db}
+
+	first := time.Now().UTC().Truncate(24 * time.Hour)
+	next := first.AddDate(0, 0, 1)
+
+	series := &Sessions{User_id: user, Title: "Calculus", Description: "Limits", Subject: "Maths", Start_date: first, End_date: first.Add(time.Hour), Rrule: "FREQ=DAILY"}
+	if err := sessions.Insert(series); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := intervals.Start(series.Session_id, user, time.Time{}); !errors.Is(err, ErrNotAnOccurrence) {
+		t.Fatalf("starting the series without a date error = %v, want ErrNotAnOccurrence", err)
+	}
+
+	if err := intervals.Start(series.Session_id, user, first); err != nil {
+		t.Fatal(err)
+	}
+	if err := intervals.Stop(series.Session_id, user, first); err != nil {
+		t.Fatal(err)
+	}
+
+	stopped, err := intervals.State(series.Session_id, user, first)
+	if err != nil || stopped.Status != TimerStopped {
+		t.Fatalf("stopped occurrence state = %+v, %v", stopped, err)
+	}
+
+	open, err := intervals.State(series.Session_id, user, next)
+	if err != nil || open.Status != TimerIdle || len(open.Intervals) != 0 {
+		t.Fatalf("next occurrence state = %+v, %v", open, err)
+	}
+	if err := intervals.Start(series.Session_id, user, next); err != nil {
+		t.Errorf("starting the next occurrence error = %v", err)
+	}
+
+	completed := true
+	page, _, err := sessions.SessionPage(user, ListFilters{Sort: "start_date", PageSize: DefaultPageSize, Completed: &completed}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page) != 1 || page[0].Occurrence_date == nil || !page[0].Occurrence_date.Equal(first) {
+		t.Errorf("completed sessions = %+v, want only the stopped occurrence", page)
+	}
+}
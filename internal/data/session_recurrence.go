@@ -0,0 +1,287 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/abankelsey/study_helper/internal/rrule"
+)
+
+// RecurrenceHorizon is how far past today open ended series are expanded
+const RecurrenceHorizon = 365 * 24 * time.Hour
+
+var ErrNotAnOccurrence = errors.New("date is not an occurrence of the session")
+
+// represents a change to a single occurrence of a recurring session,
+// nil fields keep the value of the series. The timer of an occurrence
+// is stopped and completes it here.
+type SessionException struct {
+	Occurrence_date time.Time  `json:"occurrence_date"`
+	Is_cancelled    bool       `json:"is_cancelled"`
+	Title           *string    `json:"title,omitempty"`
+	Description     *string    `json:"description,omitempty"`
+	Subject         *string    `json:"subject,omitempty"`
+	Subject_id      *int64     `json:"-"`
+	Start_date      *time.Time `json:"start_date,omitempty"`
+	End_date        *time.Time `json:"end_date,omitempty"`
+	Is_completed    *bool      `json:"is_completed,omitempty"`
+	Stopped_at      *time.Time `json:"stopped_at,omitempty"`
+	// minutes the timer of the occurrence ran
+	Actual_minutes int64 `json:"-"`
+}
+
+// Occurrences expands a recurring session into its individual occurrences up to the
+// recurrence horizon. One-off sessions are returned unchanged.
+func (s *Sessions) Occurrences() []*Sessions {
+	if s.Rrule == "" {
+		return []*Sessions{s}
+	}
+
+	r, err := rrule.Parse(s.Rrule)
+	if err != nil {
+		return []*Sessions{s}
+	}
+
+	dates := r.Between(s.Start_date, s.Start_date, time.Now().Add(RecurrenceHorizon))
+
+	occurrences := make([]*Sessions, 0, len(dates))
+	for _, d := range dates {
+		occurrences = append(occurrences, s.occurrence(d))
+	}
+	return occurrences
+}
+
+// occurrence is the occurrence of the recurring session on the date. Each occurrence lasts
+// as long as the first one, and has its own timer, which has not run until an exception
+// says so.
+func (s *Sessions) occurrence(date time.Time) *Sessions {
+	o := *s
+	o.Occurrence_date = &date
+	o.Start_date = date
+	o.End_date = date.Add(s.End_date.Sub(s.Start_date))
+	o.Is_completed = false
+	o.Actual_minutes = 0
+	return &o
+}
+
+// IsOccurrence reports whether the date is one of the occurrences of a recurring session
+func (s *Sessions) IsOccurrence(date time.Time) bool {
+	if s.Rrule == "" {
+		return false
+	}
+
+	r, err := rrule.Parse(s.Rrule)
+	if err != nil {
+		return false
+	}
+
+	return len(r.Between(s.Start_date, date, date)) == 1
+}
+
+// Apply overrides the fields of an occurrence with the ones changed by the exception
+func (e *SessionException) Apply(o *Sessions) {
+	if e.Title != nil {
+		o.Title = *e.Title
+	}
+	if e.Description != nil {
+		o.Description = *e.Description
+	}
+	if e.Subject != nil {
+		o.Subject = *e.Subject
+	}
+	if e.Subject_id != nil {
+		o.Subject_id = *e.Subject_id
+	}
+	if e.Start_date != nil {
+		o.Start_date = *e.Start_date
+	}
+	if e.End_date != nil {
+		o.End_date = *e.End_date
+	}
+	if e.Is_completed != nil {
+		o.Is_completed = *e.Is_completed
+	}
+	o.Actual_minutes = e.Actual_minutes
+}
+
+// expandRecurring replaces every recurring session in the list with its occurrences,
+// applying the edits and cancellations made to single occurrences
+func (m *SessionsModel) expandRecurring(ctx context.Context, userID int64, sessions []*Sessions) ([]*Sessions, error) {
+	exceptions, err := m.exceptions(ctx, userID, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var expanded []*Sessions
+	for _, s := range sessions {
+		for _, o := range s.Occurrences() {
+			if o.Occurrence_date != nil {
+				if e, ok := exceptions[s.Session_id][*o.Occurrence_date]; ok {
+					if e.Is_cancelled {
+						continue
+					}
+					e.Apply(o)
+				}
+			}
+			expanded = append(expanded, o)
+		}
+	}
+
+	return expanded, nil
+}
+
+// exceptions loads the occurrence exceptions of the user's sessions, keyed by session
+// and occurrence date. A sessionID of 0 loads them for every session.
+func (m *SessionsModel) exceptions(ctx context.Context, userID int64, sessionID int64) (map[int64]map[time.Time]*SessionException, error) {
+	query := `
+    SELECT e.session_id, e.occurrence_date, e.is_cancelled, e.title, e.description, sub.name, e.subject_id, e.start_date, e.end_date,
+           e.is_completed, e.stopped_at,
+           COALESCE((
+               SELECT FLOOR(SUM(EXTRACT(EPOCH FROM COALESCE(i.ended_at, NOW()) - i.started_at)) / 60)
+               FROM session_intervals i
+               WHERE i.session_id = e.session_id AND i.occurrence_date = e.occurrence_date
+           ), 0)::bigint
+    FROM session_exceptions e
+    JOIN study_sessions s ON s.session_id = e.session_id
+    LEFT JOIN subjects sub ON sub.subject_id = e.subject_id
+    WHERE s.user_id = $1 AND ($2 = 0 OR e.session_id = $2)`
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	exceptions := map[int64]map[time.Time]*SessionException{}
+	for rows.Next() {
+		var id int64
+		e := &SessionException{}
+		err := rows.Scan(&id, &e.Occurrence_date, &e.Is_cancelled, &e.Title, &e.Description, &e.Subject, &e.Subject_id, &e.Start_date, &e.End_date, &e.Is_completed, &e.Stopped_at, &e.Actual_minutes)
+		if err != nil {
+			return nil, err
+		}
+
+		// DATE columns come back as midnight UTC, the same as expanded occurrences
+		e.Occurrence_date = e.Occurrence_date.UTC()
+		if exceptions[id] == nil {
+			exceptions[id] = map[time.Time]*SessionException{}
+		}
+		exceptions[id][e.Occurrence_date] = e
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return exceptions, nil
+}
+
+// Exceptions returns the edited and cancelled occurrences of the user's recurring
+// sessions, keyed by session and occurrence date
+func (m *SessionsModel) Exceptions(userID int64) (map[int64]map[time.Time]*SessionException, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.exceptions(ctx, userID, 0)
+}
+
+// GetOccurrence returns a single occurrence of a recurring session with its edits applied
+func (m *SessionsModel) GetOccurrence(sessionID int64, userID int64, date time.Time) (*Sessions, error) {
+	s, err := m.GetSessionByID(sessionID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !s.IsOccurrence(date) {
+		return nil, ErrNotAnOccurrence
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	exceptions, err := m.exceptions(ctx, userID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	day := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+	o := s.occurrence(day)
+
+	if e, ok := exceptions[sessionID][day]; ok {
+		if e.Is_cancelled {
+			return nil, sql.ErrNoRows
+		}
+		e.Apply(o)
+	}
+
+	return o, nil
+}
+
+// EditOccurrence changes a single occurrence of a recurring session, leaving the rest of the series alone.
+// Whether the occurrence is completed is kept as it was, only its own timer completes it.
+func (m *SessionsModel) EditOccurrence(session *Sessions, userID int64, date time.Time) error {
+	s, err := m.GetSessionByID(session.Session_id, userID)
+	if err != nil {
+		return err
+	}
+	if !s.IsOccurrence(date) {
+		return ErrNotAnOccurrence
+	}
+
+	query := `
+    INSERT INTO session_exceptions (session_id, occurrence_date, title, description, subject_id, start_date, end_date)
+    VALUES ($1, $2, $3, $4, $5, $6, $7)
+    ON CONFLICT (session_id, occurrence_date) DO UPDATE
+    SET is_cancelled = FALSE,
+        title = EXCLUDED.title,
+        description = EXCLUDED.description,
+        subject_id = EXCLUDED.subject_id,
+        start_date = EXCLUDED.start_date,
+        end_date = EXCLUDED.end_date`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	subjectID, err := findOrCreateSubject(ctx, m.DB, userID, session.Subject)
+	if err != nil {
+		return err
+	}
+	session.Subject_id = subjectID
+
+	_, err = m.DB.ExecContext(
+		ctx,
+		query,
+		session.Session_id,
+		date,
+		session.Title,
+		session.Description,
+		session.Subject_id,
+		session.Start_date,
+		session.End_date,
+	)
+	return err
+}
+
+// DeleteOccurrence cancels a single occurrence of a recurring session
+func (m *SessionsModel) DeleteOccurrence(sessionID int64, userID int64, date time.Time) error {
+	s, err := m.GetSessionByID(sessionID, userID)
+	if err != nil {
+		return err
+	}
+	if !s.IsOccurrence(date) {
+		return ErrNotAnOccurrence
+	}
+
+	query := `
+    INSERT INTO session_exceptions (session_id, occurrence_date, is_cancelled)
+    VALUES ($1, $2, TRUE)
+    ON CONFLICT (session_id, occurrence_date) DO UPDATE
+    SET is_cancelled = TRUE`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err = m.DB.ExecContext(ctx, query, sessionID, date)
+	return err
+}
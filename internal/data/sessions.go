@@ -1,10 +1,15 @@
 package data
 
 import (
+	"cmp"
 	"context"
 	"database/sql"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/abankelsey/study_helper/internal/rrule"
 	"github.com/abankelsey/study_helper/internal/validator"
 )
 
@@ -14,13 +19,36 @@ type Sessions struct {
 	User_id      int64     `json:"user_id"`
 	Title        string    `json:"title"`
 	Description  string    `json:"description"`
-	Subject      string    `json:"subject"`
+	Subject      string    `json:"subject"` // the name of the subject
+	Subject_id   int64     `json:"subject_id"`
 	Start_date   time.Time `json:"start_date"`
 	End_date     time.Time `json:"end_date"`
 	Is_completed bool      `json:"is_completed"`
 	Created_at   time.Time `json:"created_at"`
+	// minutes actually studied according to the session timer
+	Actual_minutes int64 `json:"actual_minutes"`
+	// pomodoros finished while studying this session
+	Completed_pomodoros int64 `json:"completed_pomodoros"`
+	// RFC 5545 recurrence rule, empty for one-off sessions
+	Rrule string `json:"rrule,omitempty"`
+	// the day of this occurrence when the session is part of a recurring series
+	Occurrence_date *time.Time `json:"occurrence_date,omitempty"`
+	// UID of the calendar event the session was imported from
+	Ical_uid string `json:"ical_uid,omitempty"`
 }
 
+// actualMinutesSQL sums the logged timer intervals of study_sessions row s, counting a running interval up to now
+const actualMinutesSQL = `
+    COALESCE((
+        SELECT FLOOR(SUM(EXTRACT(EPOCH FROM COALESCE(i.ended_at, NOW()) - i.started_at)) / 60)
+        FROM session_intervals i
+        WHERE i.session_id = s.session_id
+    ), 0)::bigint`
+
+// completedPomodorosSQL counts the finished pomodoros of study_sessions row s
+const completedPomodorosSQL = `
+    (SELECT COUNT(*) FROM pomodoros p WHERE p.session_id = s.session_id)`
+
 // validates the fields of the sessions struct
 func ValidateSessions(v *validator.Validator, sessions *Sessions) {
 	v.Check(validator.NotBlank(sessions.Title), "title", "This field cannot be left blank")
@@ -31,57 +59,102 @@ func ValidateSessions(v *validator.Validator, sessions *Sessions) {
 	v.Check(validator.MaxLength(sessions.Subject, 50), "subject", "must not be more than 50 bytes long")
 	v.Check(validator.IsValidDate(sessions.Start_date), "start_date", "Start date must be provided")
 	v.Check(validator.IsValidDate(sessions.End_date), "end_date", "End date must be provided")
+	v.Check(!sessions.End_date.Before(sessions.Start_date), "end_date", "End date must not be before the start date")
+
+	if sessions.Rrule != "" {
+		v.Check(validator.MaxLength(sessions.Rrule, 200), "rrule", "must not be more than 200 bytes long")
+		_, err := rrule.Parse(sessions.Rrule)
+		v.Check(err == nil, "rrule", "Must be a valid repeat rule, e.g. FREQ=WEEKLY;BYDAY=MO,WE,FR;UNTIL=20261215")
+	}
 }
 
 type SessionsModel struct {
 	DB *sql.DB
 }
 
-// Adds new todo entry into the database
+// Adds new todo entry into the database. A new session is never completed, only stopping
+// its timer completes it.
 func (m *SessionsModel) Insert(sessions *Sessions) error {
-	query := `
-    INSERT INTO study_sessions (title, description, subject, start_date, end_date, is_completed, user_id)
-    VALUES ($1, $2, $3, $4, $5, $6, $7)
-    RETURNING session_id, created_at`
-
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	return m.DB.QueryRowContext(
+	return insertSession(ctx, m.DB, sessions)
+}
+
+// insertSession runs the session insert on either a *sql.DB or a *sql.Tx
+func insertSession(ctx context.Context, q querier, sessions *Sessions) error {
+	query := `
+    INSERT INTO study_sessions (title, description, subject_id, start_date, end_date, is_completed, user_id, rrule, ical_uid)
+    VALUES ($1, $2, $3, $4, $5, FALSE, $6, $7, $8)
+    RETURNING session_id, created_at, is_completed`
+
+	// The subject is typed in by name and created the first time it is used
+	subjectID, err := findOrCreateSubject(ctx, q, sessions.User_id, sessions.Subject)
+	if err != nil {
+		return err
+	}
+	sessions.Subject_id = subjectID
+
+	return q.QueryRowContext(
 		ctx,
 		query,
 		sessions.Title,
 		sessions.Description,
-		sessions.Subject,
+		sessions.Subject_id,
 		sessions.Start_date,
 		sessions.End_date,
-		sessions.Is_completed,
 		sessions.User_id,
-	).Scan(&sessions.Session_id, &sessions.Created_at)
+		sessions.Rrule,
+		sessions.Ical_uid,
+	).Scan(&sessions.Session_id, &sessions.Created_at, &sessions.Is_completed)
 }
 
-// Retrieve list of all session entries from the database
+// Retrieve list of all session entries from the database, with recurring sessions
+// expanded into their occurrences
 func (m *SessionsModel) SessionList(userID int64) ([]*Sessions, error) {
+	sessions, err := m.SeriesList(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Recurring sessions are listed as their individual occurrences
+	return m.expandRecurring(ctx, userID, sessions)
+}
+
+// Retrieve list of all session entries from the database, one per recurring series
+func (m *SessionsModel) SeriesList(userID int64) ([]*Sessions, error) {
 	query := `
-    SELECT session_id, title, description, subject, start_date, end_date, is_completed, user_id, created_at
-    FROM study_sessions
-    WHERE user_id = $1
-    ORDER BY created_at DESC`
+    SELECT ` + sessionColumns + `
+    FROM study_sessions s
+    JOIN subjects sub ON sub.subject_id = s.subject_id
+    WHERE s.user_id = $1
+    ORDER BY s.created_at DESC`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	rows, err := m.DB.QueryContext(ctx, query, userID)
+	return m.querySessions(ctx, query, userID)
+}
+
+// sessionColumns are the columns scanned by querySessions, of study_sessions s joined with subjects sub
+const sessionColumns = `s.session_id, s.title, s.description, sub.name, s.subject_id, s.start_date, s.end_date, s.is_completed, s.user_id, s.created_at, s.rrule, s.ical_uid,` + actualMinutesSQL + `,` + completedPomodorosSQL
+
+// querySessions runs a query selecting sessionColumns and scans the sessions it returns
+func (m *SessionsModel) querySessions(ctx context.Context, query string, args ...any) ([]*Sessions, error) {
+	rows, err := m.DB.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var sessions []*Sessions
+	sessions := []*Sessions{}
 
 	for rows.Next() {
 		s := &Sessions{}
-		err := rows.Scan(&s.Session_id, &s.Title, &s.Description, &s.Subject, &s.Start_date, &s.End_date, &s.Is_completed, &s.User_id, &s.Created_at)
+		err := rows.Scan(&s.Session_id, &s.Title, &s.Description, &s.Subject, &s.Subject_id, &s.Start_date, &s.End_date, &s.Is_completed, &s.User_id, &s.Created_at, &s.Rrule, &s.Ical_uid, &s.Actual_minutes, &s.Completed_pomodoros)
 		if err != nil {
 			return nil, err
 		}
@@ -95,6 +168,238 @@ func (m *SessionsModel) SessionList(userID int64) ([]*Sessions, error) {
 	return sessions, nil
 }
 
+// sessionSortColumns are the columns the session sort keys order by. Titles are compared
+// byte by byte, the way expanded occurrences are compared when they are merged in.
+var sessionSortColumns = map[string]sortColumn{
+	"created_at":   {"s.created_at", "timestamptz"},
+	"start_date":   {"s.start_date", "date"},
+	"title":        {`s.title COLLATE "C"`, "text"},
+	"is_completed": {"s.is_completed", "boolean"},
+}
+
+// sessionCursor is the position of the session or occurrence in a list sorted by key
+func sessionCursor(s *Sessions, key string) cursor {
+	c := cursor{ID: s.Session_id}
+	if s.Occurrence_date != nil {
+		c.Date = dateCursorValue(*s.Occurrence_date)
+	}
+	switch key {
+	case "start_date":
+		c.Value = dateCursorValue(s.Start_date)
+	case "title":
+		c.Value = s.Title
+	case "is_completed":
+		c.Value = strconv.FormatBool(s.Is_completed)
+	default:
+		c.Value = timestampCursorValue(s.Created_at)
+	}
+	return c
+}
+
+// compareCursors orders two positions of a list sorted in ascending order
+func compareCursors(a, b cursor) int {
+	return cmp.Or(strings.Compare(a.Value, b.Value), cmp.Compare(a.ID, b.ID), strings.Compare(a.Date, b.Date))
+}
+
+// compareSorted orders two positions of a list sorted as the filters ask
+func (f ListFilters) compareSorted(a, b cursor) int {
+	if f.descending() {
+		return compareCursors(b, a)
+	}
+	return compareCursors(a, b)
+}
+
+// matches reports whether the session passes the filters
+func (s *Sessions) matches(f ListFilters) bool {
+	if f.Completed != nil && s.Is_completed != *f.Completed {
+		return false
+	}
+	day := dateCursorValue(s.Start_date)
+	if !f.From.IsZero() && day < dateCursorValue(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && day > dateCursorValue(f.To) {
+		return false
+	}
+	if f.Subject != "" && !strings.EqualFold(strings.TrimSpace(s.Subject), f.Subject) {
+		return false
+	}
+	return true
+}
+
+// Retrieve one page of the user's sessions, sorted and filtered as asked. With expand,
+// recurring sessions are listed as their occurrences. Occurrences only exist once a series
+// is expanded, so one-off sessions are paged in SQL and merged with the few occurrences
+// that can be on the page. Each occurrence is completed on its own, so the completed
+// filter is checked on the occurrence, not on its series.
+func (m *SessionsModel) SessionPage(userID int64, filters ListFilters, expand bool) ([]*Sessions, Metadata, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Without expand a series is listed as one row, the same as a one-off session
+	args := []any{userID, nullBool(filters.Completed), nullDate(filters.From), nullDate(filters.To), filters.Subject, !expand}
+	where, order, args := keysetPage(filters, sessionSortColumns, nil, "s.session_id", args)
+
+	query := `
+    SELECT ` + sessionColumns + `
+    FROM study_sessions s
+    JOIN subjects sub ON sub.subject_id = s.subject_id
+    WHERE s.user_id = $1
+    AND ($2::boolean IS NULL OR s.is_completed = $2)
+    AND ($3::date IS NULL OR s.start_date >= $3::date)
+    AND ($4::date IS NULL OR s.start_date < $4::date + 1)
+    AND ($5 = '' OR lower(btrim(sub.name)) = lower($5))
+    AND ($6 OR s.rrule = '')` + where + order
+
+	sessions, err := m.querySessions(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	key := filters.sortKey()
+
+	if expand {
+		occurrences, err := m.pageOccurrences(ctx, userID, filters)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		sessions = append(sessions, occurrences...)
+		slices.SortFunc(sessions, func(a, b *Sessions) int {
+			return filters.compareSorted(sessionCursor(a, key), sessionCursor(b, key))
+		})
+
+		// One extra session tells whether there is another page
+		sessions = sessions[:min(len(sessions), filters.PageSize+1)]
+	}
+
+	n, metadata := pageMetadata(filters, len(sessions), func(i int) cursor {
+		return sessionCursor(sessions[i], key)
+	})
+
+	return sessions[:n], metadata, nil
+}
+
+// pageOccurrences returns the occurrences of the user's recurring sessions that can be on
+// the page: the first ones of each series after the cursor that pass the filters, and
+// every occurrence changed by an exception, since those can sort anywhere
+func (m *SessionsModel) pageOccurrences(ctx context.Context, userID int64, f ListFilters) ([]*Sessions, error) {
+	query := `
+    SELECT ` + sessionColumns + `
+    FROM study_sessions s
+    JOIN subjects sub ON sub.subject_id = s.subject_id
+    WHERE s.user_id = $1 AND s.rrule <> ''`
+
+	series, err := m.querySessions(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	exceptions, err := m.exceptions(ctx, userID, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	after, err := decodeCursor(f.Cursor)
+	hasCursor := err == nil
+	key := f.sortKey()
+
+	onPage := func(o *Sessions) bool {
+		return o.matches(f) && (!hasCursor || f.compareSorted(sessionCursor(o, key), after) > 0)
+	}
+
+	// An occurrence is only completed by its own timer, which gives it an exception
+	onlyEdited := f.Completed != nil && *f.Completed
+
+	var occurrences []*Sessions
+	for _, s := range series {
+		r, err := rrule.Parse(s.Rrule)
+		if err != nil {
+			continue
+		}
+		edited := exceptions[s.Session_id]
+
+		for date, e := range edited {
+			if e.Is_cancelled || !s.IsOccurrence(date) {
+				continue
+			}
+			o := s.occurrence(date)
+			e.Apply(o)
+			if onPage(o) {
+				occurrences = append(occurrences, o)
+			}
+		}
+
+		from, to, ok := occurrenceWindow(s, f, after, hasCursor)
+		if !ok || onlyEdited {
+			continue
+		}
+
+		// Unedited occurrences of a series sort by date, so the page needs at most as
+		// many of them as it holds
+		dates := r.Between(s.Start_date, from, to)
+		if f.descending() {
+			slices.Reverse(dates)
+		}
+		found := 0
+		for _, d := range dates {
+			if found > f.PageSize {
+				break
+			}
+			if _, ok := edited[d]; ok {
+				continue
+			}
+			o := s.occurrence(d)
+			if onPage(o) {
+				occurrences = append(occurrences, o)
+				found++
+			}
+		}
+	}
+
+	return occurrences, nil
+}
+
+// occurrenceWindow is the range of dates the unedited occurrences of the series on the page
+// can fall in, given the date filters and the cursor. ok is false when there are none.
+func occurrenceWindow(s *Sessions, f ListFilters, after cursor, hasCursor bool) (time.Time, time.Time, bool) {
+	from, to := s.Start_date, time.Now().Add(RecurrenceHorizon)
+	if !f.From.IsZero() && f.From.After(from) {
+		from = f.From
+	}
+	if !f.To.IsZero() && f.To.Before(to) {
+		to = f.To
+	}
+
+	if hasCursor {
+		var day time.Time
+		series := sessionCursor(s, f.sortKey())
+
+		switch {
+		case f.sortKey() == "start_date":
+			// An unedited occurrence starts on its own day
+			day, _ = time.Parse("2006-01-02", after.Value)
+		case after.ID == s.Session_id && after.Value == series.Value:
+			// The cursor is in this series, whose occurrences only differ by date
+			day, _ = time.Parse("2006-01-02", after.Date)
+		case f.compareSorted(series, cursor{Value: after.Value, ID: after.ID}) < 0:
+			// Every unedited occurrence of the series is before the cursor
+			return from, to, false
+		}
+
+		if !day.IsZero() {
+			if f.descending() && day.Before(to) {
+				to = day
+			}
+			if !f.descending() && day.After(from) {
+				from = day
+			}
+		}
+	}
+
+	return from, to, !to.Before(from)
+}
+
 // DeleteSession removes a session entry from the database using its ID
 func (m *SessionsModel) DeleteSession(sessionID int64, userID int64) error {
 	query := `
@@ -120,16 +425,21 @@ func (m *SessionsModel) DeleteSession(sessionID int64, userID int64) error {
 	return nil
 }
 
-// Get the session info based on the session
-func (m *SessionsModel) GetSessionByID(id int64) (*Sessions, error) {
+// Get the session info based on the session, if it belongs to the user
+func (m *SessionsModel) GetSessionByID(id int64, userID int64) (*Sessions, error) {
 	stmt := `
-    SELECT session_id, title, description, subject, start_date, end_date, is_completed, user_id, created_at
-    FROM study_sessions
-    WHERE session_id = $1`
-	row := m.DB.QueryRow(stmt, id)
+    SELECT s.session_id, s.title, s.description, sub.name, s.subject_id, s.start_date, s.end_date, s.is_completed, s.user_id, s.created_at, s.rrule, s.ical_uid,` + actualMinutesSQL + `,` + completedPomodorosSQL + `
+    FROM study_sessions s
+    JOIN subjects sub ON sub.subject_id = s.subject_id
+    WHERE s.session_id = $1 AND s.user_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	row := m.DB.QueryRowContext(ctx, stmt, id, userID)
 
 	var s Sessions
-	err := row.Scan(&s.Session_id, &s.Title, &s.Description, &s.Subject, &s.Start_date, &s.End_date, &s.Is_completed, &s.User_id, &s.Created_at)
+	err := row.Scan(&s.Session_id, &s.Title, &s.Description, &s.Subject, &s.Subject_id, &s.Start_date, &s.End_date, &s.Is_completed, &s.User_id, &s.Created_at, &s.Rrule, &s.Ical_uid, &s.Actual_minutes, &s.Completed_pomodoros)
 	if err != nil {
 		return nil, err
 	}
@@ -137,31 +447,91 @@ func (m *SessionsModel) GetSessionByID(id int64) (*Sessions, error) {
 	return &s, nil
 }
 
-// Edits an entry session into the database
-func (m *SessionsModel) EditSession(session *Sessions) error {
+// Edits an entry session into the database. Whether it is completed is kept as stored,
+// since only stopping its timer completes it.
+func (m *SessionsModel) EditSession(session *Sessions, userID int64) error {
 	query := `
         UPDATE study_sessions
         SET title = $1,
 			description = $2,
-			subject = $3,
+			subject_id = $3,
 			start_date = $4,
 			end_date = $5,
-            is_completed = $6
-        WHERE session_id = $7`
+            rrule = $6
+        WHERE session_id = $7 AND user_id = $8`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	_, err := m.DB.ExecContext(
+	subjectID, err := findOrCreateSubject(ctx, m.DB, userID, session.Subject)
+	if err != nil {
+		return err
+	}
+	session.Subject_id = subjectID
+
+	result, err := m.DB.ExecContext(
 		ctx,
 		query,
 		session.Title,
 		session.Description,
-		session.Subject,
+		session.Subject_id,
 		session.Start_date,
 		session.End_date,
-		session.Is_completed,
+		session.Rrule,
 		session.Session_id,
+		userID,
 	)
-	return err
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	// Nothing was changed when the record does not exist or belongs to another user
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// ImportedUIDs returns the calendar UIDs of the user's sessions that were imported from .ics files
+func (m *SessionsModel) ImportedUIDs(userID int64) (map[string]bool, error) {
+	return importedUIDs(m.DB, "study_sessions", userID)
+}
+
+// importedUIDs loads the non-empty ical_uid values of a table for a user
+func importedUIDs(db *sql.DB, table string, userID int64) (map[string]bool, error) {
+	query := `
+    SELECT ical_uid
+    FROM ` + table + `
+    WHERE user_id = $1 AND ical_uid <> ''`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	uids := map[string]bool{}
+	for rows.Next() {
+		var uid string
+		err := rows.Scan(&uid)
+		if err != nil {
+			return nil, err
+		}
+		uids[uid] = true
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return uids, nil
 }
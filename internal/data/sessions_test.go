@@ -0,0 +1,101 @@
+package data
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOccurrenceWindow(t *testing.T) {
+	day := func(value string) time.Time {
+		d, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+
+	series := &Sessions{
+		Session_id: 5,
+		Title:      "Calculus",
+		Start_date: day("2026-01-01"),
+		End_date:   day("2026-01-01").Add(time.Hour),
+		Rrule:      "FREQ=DAILY",
+		Created_at: day("2025-12-01"),
+	}
+	startCursor := cursor{Value: dateCursorValue(day("2026-03-10")), ID: 9}
+
+	tests := []struct {
+		name     string
+		sort     string
+		from, to string
+		after    *cursor
+		wantFrom string
+		wantTo   string
+		wantOK   bool
+	}{
+		{"date filters", "start_date", "2026-02-01", "2026-02-28", nil, "2026-02-01", "2026-02-28", true},
+		{"filters before the series", "start_date", "2025-01-01", "2025-12-31", nil, "", "", false},
+		{"after a start date", "start_date", "", "2026-12-31", &startCursor, "2026-03-10", "2026-12-31", true},
+		{"before a start date", "-start_date", "", "2026-12-31", &startCursor, "2026-01-01", "2026-03-10", true},
+		{"after an occurrence of the series", "title", "", "2026-12-31", &cursor{Value: "Calculus", ID: 5, Date: "2026-06-01"}, "2026-06-01", "2026-12-31", true},
+		{"before an occurrence of the series", "-title", "", "2026-12-31", &cursor{Value: "Calculus", ID: 5, Date: "2026-06-01"}, "2026-01-01", "2026-06-01", true},
+		{"series after the cursor", "title", "", "2026-12-31", &cursor{Value: "Biology", ID: 9}, "2026-01-01", "2026-12-31", true},
+		{"series before the cursor", "title", "", "2026-12-31", &cursor{Value: "Physics", ID: 9}, "", "", false},
+		{"series before the cursor, descending", "-title", "", "2026-12-31", &cursor{Value: "Biology", ID: 9}, "", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := ListFilters{Sort: tt.sort}
+			if tt.from != "" {
+				f.From = day(tt.from)
+			}
+			f.To = day(tt.to)
+
+			var after cursor
+			if tt.after != nil {
+				after = *tt.after
+			}
+
+			from, to, ok := occurrenceWindow(series, f, after, tt.after != nil)
+			if ok != tt.wantOK {
+				t.Fatalf("occurrenceWindow() ok = %t, want %t", ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if !from.Equal(day(tt.wantFrom)) || !to.Equal(day(tt.wantTo)) {
+				t.Errorf("occurrenceWindow() = %s to %s, want %s to %s", from.Format("2006-01-02"), to.Format("2006-01-02"), tt.wantFrom, tt.wantTo)
+			}
+		})
+	}
+}
+
+func TestOccurrencesAreCompletedOnTheirOwn(t *testing.T) {
+	first := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	series := &Sessions{
+		Session_id:     5,
+		Title:          "Calculus",
+		Start_date:     first,
+		End_date:       first.Add(time.Hour),
+		Rrule:          "FREQ=DAILY",
+		Actual_minutes: 90,
+	}
+
+	completed := true
+	stopped := series.occurrence(first)
+	(&SessionException{Occurrence_date: first, Is_completed: &completed, Actual_minutes: 90}).Apply(stopped)
+	next := series.occurrence(first.AddDate(0, 0, 1))
+
+	if !stopped.Is_completed || stopped.Actual_minutes != 90 {
+		t.Errorf("stopped occurrence = completed %t, %d minutes, want completed, 90 minutes", stopped.Is_completed, stopped.Actual_minutes)
+	}
+	if next.Is_completed || next.Actual_minutes != 0 {
+		t.Errorf("next occurrence = completed %t, %d minutes, want open, 0 minutes", next.Is_completed, next.Actual_minutes)
+	}
+
+	f := ListFilters{Completed: &completed}
+	if !stopped.matches(f) || next.matches(f) {
+		t.Errorf("completed filter matches stopped %t, next %t, want only the stopped occurrence", stopped.matches(f), next.matches(f))
+	}
+}
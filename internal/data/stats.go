@@ -0,0 +1,255 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/abankelsey/study_helper/internal/validator"
+)
+
+// MaxStatsDays is the longest date range the statistics can be shown for
+const MaxStatsDays = 366
+
+// represents the hours studied in a day or in a week starting on a Monday
+type PeriodHours struct {
+	Start time.Time `json:"start"`
+	Hours float64   `json:"hours"`
+}
+
+// represents the hours studied of one subject
+type SubjectHours struct {
+	Name   string  `json:"name"`
+	Colour string  `json:"colour"`
+	Hours  float64 `json:"hours"`
+}
+
+// represents how many goals or sessions of the week starting at Start were completed
+type CompletionRate struct {
+	Start     time.Time `json:"start"`
+	Total     int       `json:"total"`
+	Completed int       `json:"completed"`
+}
+
+// Percent is the share of the week's entries that were completed, 0 when there were none
+func (c *CompletionRate) Percent() float64 {
+	if c.Total == 0 {
+		return 0
+	}
+	return float64(c.Completed) / float64(c.Total) * 100
+}
+
+// represents the study statistics of a date range, both ends included
+type Stats struct {
+	From     time.Time         `json:"from"`
+	To       time.Time         `json:"to"`
+	Daily    []*PeriodHours    `json:"daily"`
+	Weekly   []*PeriodHours    `json:"weekly"`
+	Subjects []*SubjectHours   `json:"subjects"`
+	Goals    []*CompletionRate `json:"goals"`    // goals by the week of their target date
+	Sessions []*CompletionRate `json:"sessions"` // sessions by the week they start in
+}
+
+// TotalHours is the time studied over the whole range
+func (s *Stats) TotalHours() float64 {
+	total := 0.0
+	for _, d := range s.Daily {
+		total += d.Hours
+	}
+	return total
+}
+
+// AverageHours is the time studied on an average day of the range
+func (s *Stats) AverageHours() float64 {
+	if len(s.Daily) == 0 {
+		return 0
+	}
+	return s.TotalHours() / float64(len(s.Daily))
+}
+
+// GoalRate sums the goal completion of every week in the range
+func (s *Stats) GoalRate() *CompletionRate {
+	return sumRates(s.From, s.Goals)
+}
+
+// SessionRate sums the session completion of every week in the range
+func (s *Stats) SessionRate() *CompletionRate {
+	return sumRates(s.From, s.Sessions)
+}
+
+func sumRates(start time.Time, rates []*CompletionRate) *CompletionRate {
+	sum := &CompletionRate{Start: start}
+	for _, r := range rates {
+		sum.Total += r.Total
+		sum.Completed += r.Completed
+	}
+	return sum
+}
+
+// validates the date range statistics are asked for
+func ValidateStatsRange(v *validator.Validator, from, to time.Time) {
+	v.Check(!to.Before(from), "to", "must not be before the from date")
+	v.Check(to.Sub(from) < MaxStatsDays*24*time.Hour, "to", "The range can be at most a year long")
+}
+
+// StatsModel struct handles the study statistics, which are worked out in the database
+type StatsModel struct {
+	DB *sql.DB
+}
+
+// Stats works out the user's statistics for the days from and to, both included. Study
+// time comes from the session timers, with a running timer counted up to now. Days start
+// at midnight in the database's time zone, weeks on Monday.
+func (m *StatsModel) Stats(userID int64, from, to time.Time) (*Stats, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Every chart is read from the same snapshot so they add up
+	tx, err := m.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	stats := &Stats{From: from, To: to}
+
+	stats.Daily, err = studyHours(ctx, tx, userID, from, to, "day")
+	if err != nil {
+		return nil, err
+	}
+
+	stats.Weekly, err = studyHours(ctx, tx, userID, from, to, "week")
+	if err != nil {
+		return nil, err
+	}
+
+	stats.Subjects, err = subjectHours(ctx, tx, userID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	stats.Goals, err = completionRates(ctx, tx, goalCompletionSQL, userID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	stats.Sessions, err = completionRates(ctx, tx, sessionCompletionSQL, userID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	return stats, tx.Commit()
+}
+
+// studyHours sums the time studied in every day or week of the range, including the ones
+// nothing was studied in. The first and last weeks only count the days inside the range.
+func studyHours(ctx context.Context, tx *sql.Tx, userID int64, from, to time.Time, unit string) ([]*PeriodHours, error) {
+	query := `
+        WITH periods AS (
+            SELECT p AS label,
+                   GREATEST(p, $2::timestamp) AS starts,
+                   LEAST(p + ('1 ' || $4)::interval, $3::timestamp + interval '1 day') AS ends
+            FROM generate_series(date_trunc($4, $2::timestamp), $3::timestamp, ('1 ' || $4)::interval) p
+        )
+        SELECT p.label,
+               COALESCE(SUM(EXTRACT(EPOCH FROM LEAST(COALESCE(i.ended_at, NOW()), p.ends) - GREATEST(i.started_at, p.starts))), 0) / 3600
+        FROM periods p
+        LEFT JOIN (session_intervals i JOIN study_sessions s ON s.session_id = i.session_id AND s.user_id = $1)
+            ON i.started_at < p.ends AND COALESCE(i.ended_at, NOW()) > p.starts
+        GROUP BY p.label
+        ORDER BY p.label`
+
+	rows, err := tx.QueryContext(ctx, query, userID, from.Format(time.DateOnly), to.Format(time.DateOnly), unit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hours := []*PeriodHours{}
+	for rows.Next() {
+		var h PeriodHours
+		err := rows.Scan(&h.Start, &h.Hours)
+		if err != nil {
+			return nil, err
+		}
+		hours = append(hours, &h)
+	}
+
+	return hours, rows.Err()
+}
+
+// subjectHours sums the time studied of each subject in the range, most studied first.
+// Subjects that were not studied are left out.
+func subjectHours(ctx context.Context, tx *sql.Tx, userID int64, from, to time.Time) ([]*SubjectHours, error) {
+	query := `
+        SELECT sub.name, sub.colour,
+               SUM(EXTRACT(EPOCH FROM LEAST(COALESCE(i.ended_at, NOW()), $3::timestamp + interval '1 day') - GREATEST(i.started_at, $2::timestamp))) / 3600 AS hours
+        FROM session_intervals i
+        JOIN study_sessions s ON s.session_id = i.session_id
+        JOIN subjects sub ON sub.subject_id = s.subject_id
+        WHERE s.user_id = $1
+        AND i.started_at < $3::timestamp + interval '1 day'
+        AND COALESCE(i.ended_at, NOW()) > $2::timestamp
+        GROUP BY sub.subject_id, sub.name, sub.colour
+        ORDER BY hours DESC, sub.name`
+
+	rows, err := tx.QueryContext(ctx, query, userID, from.Format(time.DateOnly), to.Format(time.DateOnly))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subjects := []*SubjectHours{}
+	for rows.Next() {
+		var s SubjectHours
+		err := rows.Scan(&s.Name, &s.Colour, &s.Hours)
+		if err != nil {
+			return nil, err
+		}
+		subjects = append(subjects, &s)
+	}
+
+	return subjects, rows.Err()
+}
+
+// goalCompletionSQL counts the goals due in each week of the range and how many of them were completed
+const goalCompletionSQL = `
+    SELECT w, COUNT(g.goal_id), COUNT(g.goal_id) FILTER (WHERE COALESCE(g.is_completed, FALSE))
+    FROM generate_series(date_trunc('week', $2::timestamp), $3::timestamp, interval '1 week') w
+    LEFT JOIN daily_goals g ON g.user_id = $1
+        AND g.target_date BETWEEN $2::date AND $3::date
+        AND date_trunc('week', g.target_date::timestamp) = w
+    GROUP BY w
+    ORDER BY w`
+
+// sessionCompletionSQL counts the sessions starting in each week of the range and how many
+// of them were completed. A repeating session counts once, in the week of its first occurrence.
+const sessionCompletionSQL = `
+    SELECT w, COUNT(s.session_id), COUNT(s.session_id) FILTER (WHERE COALESCE(s.is_completed, FALSE))
+    FROM generate_series(date_trunc('week', $2::timestamp), $3::timestamp, interval '1 week') w
+    LEFT JOIN study_sessions s ON s.user_id = $1
+        AND s.start_date BETWEEN $2::date AND $3::date
+        AND date_trunc('week', s.start_date::timestamp) = w
+    GROUP BY w
+    ORDER BY w`
+
+// completionRates runs one of the completion queries over the range
+func completionRates(ctx context.Context, tx *sql.Tx, query string, userID int64, from, to time.Time) ([]*CompletionRate, error) {
+	rows, err := tx.QueryContext(ctx, query, userID, from.Format(time.DateOnly), to.Format(time.DateOnly))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rates := []*CompletionRate{}
+	for rows.Next() {
+		var c CompletionRate
+		err := rows.Scan(&c.Start, &c.Total, &c.Completed)
+		if err != nil {
+			return nil, err
+		}
+		rates = append(rates, &c)
+	}
+
+	return rates, rows.Err()
+}
@@ -0,0 +1,140 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// streak freezes are earned for every FreezeEarnDays active days in a row, and at most
+// MaxStreakFreezes can be banked at once
+const (
+	FreezeEarnDays   = 7
+	MaxStreakFreezes = 2
+)
+
+// represents a day the user completed at least one goal or session
+type ActivityDay struct {
+	Day      time.Time `json:"day"`
+	Goals    int       `json:"goals"`
+	Sessions int       `json:"sessions"`
+}
+
+// Count is how many goals and sessions were completed on the day
+func (d *ActivityDay) Count() int {
+	return d.Goals + d.Sessions
+}
+
+// represents the user's streaks of days with something completed
+type Streaks struct {
+	Current        int  `json:"current"`
+	Longest        int  `json:"longest"`
+	Active_today   bool `json:"active_today"`   // the current streak already counts today
+	Freezes_banked int  `json:"freezes_banked"` // always 0 when the user does not use freezes
+	// the days of the user's activity, and the missed days a freeze covered
+	Days   map[time.Time]*ActivityDay `json:"-"`
+	Frozen map[time.Time]bool         `json:"-"`
+}
+
+// civilDay is midnight UTC of the date t falls on where t is, the form every day is kept in
+func civilDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// ComputeStreaks works out the streaks from the active days, up to today. Today only ends
+// a streak once it is over. With freezes on, every FreezeEarnDays active days in a row
+// bank a freeze, and a banked freeze is spent to cover each missed day of a running streak.
+// A covered day keeps the streak going without adding to it.
+func ComputeStreaks(days []*ActivityDay, today time.Time, freezes bool) *Streaks {
+	today = civilDay(today)
+	s := &Streaks{Days: map[time.Time]*ActivityDay{}, Frozen: map[time.Time]bool{}}
+
+	first := today
+	for _, d := range days {
+		day := civilDay(d.Day)
+		s.Days[day] = d
+		if day.Before(first) {
+			first = day
+		}
+	}
+
+	run, earning := 0, 0
+	for day := first; !day.After(today); day = day.AddDate(0, 0, 1) {
+		switch {
+		case s.Days[day] != nil:
+			run++
+			earning++
+			if freezes && earning%FreezeEarnDays == 0 && s.Freezes_banked < MaxStreakFreezes {
+				s.Freezes_banked++
+			}
+		case day.Equal(today):
+			// the day is not over yet
+		case freezes && run > 0 && s.Freezes_banked > 0:
+			s.Freezes_banked--
+			s.Frozen[day] = true
+		default:
+			run, earning = 0, 0
+		}
+		s.Longest = max(s.Longest, run)
+	}
+
+	s.Current = run
+	s.Active_today = s.Days[today] != nil
+
+	return s
+}
+
+// StreaksModel struct handles reading the days the user was active on
+type StreaksModel struct {
+	DB *sql.DB
+}
+
+// Activity returns every day the user completed a goal or a session, oldest first. Days
+// are dates in the user's time zone. Goals and sessions completed before completion times
+// were kept count on their target or end date, and edited occurrences of a repeating
+// session on their occurrence date.
+func (m *StreaksModel) Activity(userID int64) ([]*ActivityDay, error) {
+	query := `
+    WITH u AS (
+        SELECT timezone FROM users WHERE user_id = $1
+    ),
+    done AS (
+        SELECT COALESCE((g.completed_at AT TIME ZONE u.timezone)::date, g.target_date) AS day, 1 AS goals, 0 AS sessions
+        FROM daily_goals g, u
+        WHERE g.user_id = $1 AND g.is_completed
+        UNION ALL
+        SELECT COALESCE((s.completed_at AT TIME ZONE u.timezone)::date, s.end_date), 0, 1
+        FROM study_sessions s, u
+        WHERE s.user_id = $1 AND s.is_completed
+        UNION ALL
+        SELECT e.occurrence_date, 0, 1
+        FROM session_exceptions e
+        JOIN study_sessions s ON s.session_id = e.session_id
+        WHERE s.user_id = $1 AND e.is_completed AND NOT e.is_cancelled
+    )
+    SELECT day, SUM(goals), SUM(sessions)
+    FROM done
+    GROUP BY day
+    ORDER BY day`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	days := []*ActivityDay{}
+	for rows.Next() {
+		var d ActivityDay
+		err := rows.Scan(&d.Day, &d.Goals, &d.Sessions)
+		if err != nil {
+			return nil, err
+		}
+		days = append(days, &d)
+	}
+
+	return days, rows.Err()
+}
@@ -0,0 +1,292 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/abankelsey/study_helper/internal/validator"
+	"github.com/lib/pq"
+)
+
+// DefaultSubjectColour is the colour of subjects created from the session form
+const DefaultSubjectColour = "#5c2d91"
+
+// ColourRX matches a colour written as #rrggbb, the format of colour inputs
+var ColourRX = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+var (
+	ErrDuplicateSubject = errors.New("duplicate subject")
+	ErrSubjectInUse     = errors.New("subject has sessions")
+)
+
+// represents a subject the user studies
+type Subjects struct {
+	Subject_id          int64     `json:"subject_id"`
+	User_id             int64     `json:"user_id"`
+	Name                string    `json:"name"`
+	Colour              string    `json:"colour"`
+	Weekly_target_hours float64   `json:"weekly_target_hours"`
+	Created_at          time.Time `json:"created_at"`
+	// the number of sessions of the subject
+	Session_count int64 `json:"session_count"`
+	// hours studied this week and in total according to the session timers
+	Week_hours  float64 `json:"week_hours"`
+	Total_hours float64 `json:"total_hours"`
+}
+
+// WeekProgress is the percentage of the weekly target studied so far, capped at 100
+func (s *Subjects) WeekProgress() int {
+	if s.Weekly_target_hours <= 0 {
+		return 0
+	}
+	return int(min(100, s.Week_hours/s.Weekly_target_hours*100))
+}
+
+// validates the fields of the subjects struct
+func ValidateSubjects(v *validator.Validator, subject *Subjects) {
+	v.Check(validator.NotBlank(subject.Name), "name", "This field cannot be left blank")
+	v.Check(validator.MaxLength(subject.Name, 50), "name", "must not be more than 50 bytes long")
+	v.Check(ColourRX.MatchString(subject.Colour), "colour", "Must be a colour like #5c2d91")
+	v.Check(subject.Weekly_target_hours >= 0 && subject.Weekly_target_hours <= 168, "weekly_target_hours", "Must be between 0 and 168 hours")
+}
+
+// StartOfWeek returns midnight on the Monday of the week t is in
+func StartOfWeek(t time.Time) time.Time {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+}
+
+// isDuplicateSubject reports whether err is a violation of the unique subject name constraint
+func isDuplicateSubject(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == "subjects_user_id_name_key"
+}
+
+// isSubjectInUse reports whether err is a session still pointing at a deleted subject
+func isSubjectInUse(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23503" && pqErr.Constraint == "study_sessions_subject_id_fkey"
+}
+
+// querier is what subject lookups need from either a *sql.DB or a *sql.Tx
+type querier interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// findOrCreateSubject returns the ID of the user's subject with the name, ignoring case,
+// creating the subject when the user has none by that name
+func findOrCreateSubject(ctx context.Context, q querier, userID int64, name string) (int64, error) {
+	query := `
+    WITH created AS (
+        INSERT INTO subjects (user_id, name, colour)
+        VALUES ($1, $2, $3)
+        ON CONFLICT (user_id, name) DO NOTHING
+        RETURNING subject_id
+    )
+    SELECT subject_id FROM created
+    UNION ALL
+    SELECT subject_id FROM subjects WHERE user_id = $1 AND name = $2
+    LIMIT 1`
+
+	var subjectID int64
+	err := q.QueryRowContext(ctx, query, userID, strings.TrimSpace(name), DefaultSubjectColour).Scan(&subjectID)
+	return subjectID, err
+}
+
+// SubjectsModel struct handles database operations related to subjects
+type SubjectsModel struct {
+	DB *sql.DB
+}
+
+// Adds a new subject into the database
+func (m *SubjectsModel) Insert(subject *Subjects) error {
+	query := `
+        INSERT INTO subjects (user_id, name, colour, weekly_target_hours)
+        VALUES ($1, $2, $3, $4)
+        RETURNING subject_id, created_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(
+		ctx,
+		query,
+		subject.User_id,
+		subject.Name,
+		subject.Colour,
+		subject.Weekly_target_hours,
+	).Scan(&subject.Subject_id, &subject.Created_at)
+	if isDuplicateSubject(err) {
+		return ErrDuplicateSubject
+	}
+	return err
+}
+
+// Retrieve the user's subjects by name, with the hours studied in the week starting at
+// weekStart and in total. A running timer counts up to now.
+func (m *SubjectsModel) SubjectList(userID int64, weekStart time.Time) ([]*Subjects, error) {
+	query := `
+        SELECT sub.subject_id, sub.user_id, sub.name, sub.colour, sub.weekly_target_hours, sub.created_at,
+            (SELECT COUNT(*) FROM study_sessions s WHERE s.subject_id = sub.subject_id),
+            COALESCE((
+                SELECT SUM(EXTRACT(EPOCH FROM LEAST(COALESCE(i.ended_at, NOW()), $3) - GREATEST(i.started_at, $2)))
+                FROM session_intervals i
+                JOIN study_sessions s ON s.session_id = i.session_id
+                WHERE s.subject_id = sub.subject_id AND i.started_at < $3 AND COALESCE(i.ended_at, NOW()) > $2
+            ), 0) / 3600,
+            COALESCE((
+                SELECT SUM(EXTRACT(EPOCH FROM COALESCE(i.ended_at, NOW()) - i.started_at))
+                FROM session_intervals i
+                JOIN study_sessions s ON s.session_id = i.session_id
+                WHERE s.subject_id = sub.subject_id
+            ), 0) / 3600
+        FROM subjects sub
+        WHERE sub.user_id = $1
+        ORDER BY sub.name`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, weekStart, weekStart.AddDate(0, 0, 7))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subjects := []*Subjects{}
+
+	for rows.Next() {
+		s := &Subjects{}
+		err := rows.Scan(&s.Subject_id, &s.User_id, &s.Name, &s.Colour, &s.Weekly_target_hours, &s.Created_at,
+			&s.Session_count, &s.Week_hours, &s.Total_hours)
+		if err != nil {
+			return nil, err
+		}
+		subjects = append(subjects, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return subjects, nil
+}
+
+// Retrieve the names of the user's subjects, to suggest on the session forms
+func (m *SubjectsModel) SubjectNames(userID int64) ([]string, error) {
+	query := `
+        SELECT name
+        FROM subjects
+        WHERE user_id = $1
+        ORDER BY name`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names := []string{}
+
+	for rows.Next() {
+		var name string
+		err := rows.Scan(&name)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return names, nil
+}
+
+// Get the subject info based on the subject, if it belongs to the user
+func (m *SubjectsModel) GetSubjectByID(id int64, userID int64) (*Subjects, error) {
+	query := `
+        SELECT subject_id, user_id, name, colour, weekly_target_hours, created_at
+        FROM subjects
+        WHERE subject_id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var s Subjects
+	err := m.DB.QueryRowContext(ctx, query, id, userID).Scan(&s.Subject_id, &s.User_id, &s.Name, &s.Colour, &s.Weekly_target_hours, &s.Created_at)
+	if err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+// Edits a subject in the database. Its sessions follow the new name.
+func (m *SubjectsModel) EditSubject(subject *Subjects, userID int64) error {
+	query := `
+        UPDATE subjects
+        SET name = $1,
+            colour = $2,
+            weekly_target_hours = $3
+        WHERE subject_id = $4 AND user_id = $5`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, subject.Name, subject.Colour, subject.Weekly_target_hours, subject.Subject_id, userID)
+	if err != nil {
+		if isDuplicateSubject(err) {
+			return ErrDuplicateSubject
+		}
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	// Nothing was changed when the subject does not exist or belongs to another user
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// DeleteSubject removes a subject the user has no sessions for
+func (m *SubjectsModel) DeleteSubject(subjectID int64, userID int64) error {
+	query := `
+	DELETE FROM subjects WHERE subject_id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, subjectID, userID)
+	if err != nil {
+		if isSubjectInUse(err) {
+			return ErrSubjectInUse
+		}
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
@@ -0,0 +1,165 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"time"
+
+	"github.com/abankelsey/study_helper/internal/validator"
+	"github.com/lib/pq"
+)
+
+// TokenResources are the parts of the API a personal token can be given access to
+var TokenResources = []string{"goals", "sessions", "quotes"}
+
+// represents a personal API token used by non-browser clients
+type Tokens struct {
+	Token_id     int64      `json:"token_id"`
+	User_id      int64      `json:"user_id"`
+	Name         string     `json:"name"`
+	Plaintext    string     `json:"token,omitempty"` // only set right after the token is created
+	Token_hash   []byte     `json:"-"`
+	Scopes       []string   `json:"scopes"` // e.g. "goals:read", "goals:write"
+	Last_used_at *time.Time `json:"last_used_at"`
+	Created_at   time.Time  `json:"created_at"`
+}
+
+// Allows reports whether the token may read, or write when write is set, the resource.
+// Write access includes read access.
+func (t *Tokens) Allows(resource string, write bool) bool {
+	if slices.Contains(t.Scopes, resource+":write") {
+		return true
+	}
+	return !write && slices.Contains(t.Scopes, resource+":read")
+}
+
+// validates the fields of the tokens struct
+func ValidateTokens(v *validator.Validator, token *Tokens) {
+	v.Check(validator.NotBlank(token.Name), "name", "This field cannot be left blank")
+	v.Check(validator.MaxLength(token.Name, 50), "name", "must not be more than 50 bytes long")
+	v.Check(len(token.Scopes) > 0, "scopes", "Give the token access to at least one resource")
+
+	for _, scope := range token.Scopes {
+		valid := false
+		for _, resource := range TokenResources {
+			if scope == resource+":read" || scope == resource+":write" {
+				valid = true
+			}
+		}
+		v.Check(valid, "scopes", "Contains an unknown scope")
+	}
+}
+
+// TokensModel struct handles database operations related to personal API tokens
+type TokensModel struct {
+	DB *sql.DB
+}
+
+// Insert creates a token for token.User_id and fills in its plaintext, which is shown once
+// and never stored
+func (m *TokensModel) Insert(token *Tokens) error {
+	plaintext, hash, err := newToken()
+	if err != nil {
+		return err
+	}
+	token.Plaintext = plaintext
+	token.Token_hash = hash
+
+	query := `
+        INSERT INTO tokens (user_id, name, token_hash, scopes)
+        VALUES ($1, $2, $3, $4)
+        RETURNING token_id, created_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(
+		ctx,
+		query,
+		token.User_id,
+		token.Name,
+		token.Token_hash,
+		pq.Array(token.Scopes),
+	).Scan(&token.Token_id, &token.Created_at)
+}
+
+// TokenList returns the tokens of the user, newest first
+func (m *TokensModel) TokenList(userID int64) ([]*Tokens, error) {
+	query := `
+        SELECT token_id, user_id, name, scopes, last_used_at, created_at
+        FROM tokens
+        WHERE user_id = $1
+        ORDER BY created_at DESC, token_id DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []*Tokens
+
+	for rows.Next() {
+		t := &Tokens{}
+		err := rows.Scan(&t.Token_id, &t.User_id, &t.Name, pq.Array(&t.Scopes), &t.Last_used_at, &t.Created_at)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// Authenticate looks up a plaintext token and records that it was just used
+func (m *TokensModel) Authenticate(plaintext string) (*Tokens, error) {
+	query := `
+        UPDATE tokens
+        SET last_used_at = NOW()
+        WHERE token_hash = $1
+        RETURNING token_id, user_id, name, scopes, last_used_at, created_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var t Tokens
+	err := m.DB.QueryRowContext(ctx, query, hashToken(plaintext)).Scan(&t.Token_id, &t.User_id, &t.Name, pq.Array(&t.Scopes), &t.Last_used_at, &t.Created_at)
+	if err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
+
+// Revoke deletes a token of the user so it can no longer be used
+func (m *TokensModel) Revoke(tokenID int64, userID int64) error {
+	query := `
+    DELETE FROM tokens WHERE token_id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, tokenID, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
@@ -0,0 +1,225 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"strings"
+	"time"
+)
+
+// RecoveryCodeCount is how many recovery codes are issued when two-factor authentication is turned on
+const RecoveryCodeCount = 10
+
+// represents the two-factor authentication settings of a user
+type TwoFactor struct {
+	User_id   int64  `json:"user_id"`
+	Email     string `json:"email"` // the account name shown in authenticator apps
+	Secret    string `json:"-"`
+	Enabled   bool   `json:"enabled"`
+	Last_step int64  `json:"-"` // the last TOTP step used, so a code cannot be replayed
+	// recovery codes that have not been used yet
+	Recovery_codes_left int `json:"recovery_codes_left"`
+}
+
+// TwoFactorModel struct handles database operations related to two-factor authentication
+type TwoFactorModel struct {
+	DB *sql.DB
+}
+
+// newRecoveryCodes generates n random one-time recovery codes formatted like "abcde-fghij"
+func newRecoveryCodes(n int) ([]string, error) {
+	codes := make([]string, n)
+	for i := range codes {
+		b := make([]byte, 7)
+		_, err := rand.Read(b)
+		if err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b))[:10]
+		codes[i] = code[:5] + "-" + code[5:]
+	}
+	return codes, nil
+}
+
+// normalizeRecoveryCode ignores the case, spaces and dashes the user typed
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
+
+// Get returns the two-factor settings of the user
+func (m *TwoFactorModel) Get(userID int64) (*TwoFactor, error) {
+	query := `
+        SELECT u.user_id, u.email, u.totp_secret, u.totp_enabled, u.totp_last_step,
+            (SELECT COUNT(*) FROM recovery_codes c WHERE c.user_id = u.user_id AND c.used_at IS NULL)
+        FROM users u
+        WHERE u.user_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var t TwoFactor
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(&t.User_id, &t.Email, &t.Secret, &t.Enabled, &t.Last_step, &t.Recovery_codes_left)
+	if err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
+
+// Enable turns on two-factor authentication with the verified secret. The step the
+// user verified with is recorded so the same code cannot be used to log in.
+// Returns a fresh set of recovery codes, which are only stored hashed.
+func (m *TwoFactorModel) Enable(userID int64, secret string, step int64) ([]string, error) {
+	codes, err := newRecoveryCodes(RecoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+        UPDATE users
+        SET totp_secret = $1, totp_enabled = TRUE, totp_last_step = $2
+        WHERE user_id = $3`
+
+	_, err = tx.ExecContext(ctx, query, secret, step, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = replaceRecoveryCodes(ctx, tx, userID, codes)
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, tx.Commit()
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes of the user with a new set
+func (m *TwoFactorModel) RegenerateRecoveryCodes(userID int64) ([]string, error) {
+	codes, err := newRecoveryCodes(RecoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	err = replaceRecoveryCodes(ctx, tx, userID, codes)
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, tx.Commit()
+}
+
+// replaceRecoveryCodes stores the hashes of codes in place of the user's old recovery codes
+func replaceRecoveryCodes(ctx context.Context, tx *sql.Tx, userID int64, codes []string) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, code := range codes {
+		_, err = tx.ExecContext(ctx, `INSERT INTO recovery_codes (user_id, code_hash) VALUES ($1, $2)`, userID, hashToken(normalizeRecoveryCode(code)))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Disable turns off two-factor authentication and deletes the recovery codes
+func (m *TwoFactorModel) Disable(userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+        UPDATE users
+        SET totp_secret = '', totp_enabled = FALSE, totp_last_step = 0
+        WHERE user_id = $1`
+
+	_, err = tx.ExecContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UseStep records a TOTP step as used. It reports false when the step, or a later one,
+// was already used, which means the code is being replayed.
+func (m *TwoFactorModel) UseStep(userID int64, step int64) (bool, error) {
+	query := `
+        UPDATE users
+        SET totp_last_step = $1
+        WHERE user_id = $2 AND totp_last_step < $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, step, userID)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected == 1, nil
+}
+
+// UseRecoveryCode marks an unused recovery code of the user as used. It reports false
+// when the code is unknown or was already used.
+func (m *TwoFactorModel) UseRecoveryCode(userID int64, code string) (bool, error) {
+	query := `
+        UPDATE recovery_codes
+        SET used_at = NOW()
+        WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, hashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected > 0, nil
+}
@@ -0,0 +1,200 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// represents a logged in browser session. The cookie only holds the plaintext token,
+// so deleting the row signs the browser out.
+type UserSession struct {
+	Session_id   int64     `json:"session_id"`
+	User_id      int64     `json:"user_id"`
+	User_agent   string    `json:"user_agent"`
+	IP           string    `json:"ip"`
+	Created_at   time.Time `json:"created_at"`
+	Last_seen_at time.Time `json:"last_seen_at"`
+	Expiry       time.Time `json:"expiry"`
+	// the user's current session version, a cookie with an older one was invalidated
+	Session_version int `json:"-"`
+}
+
+// UserSessionsModel struct handles database operations related to logged in sessions
+type UserSessionsModel struct {
+	DB *sql.DB
+}
+
+// maxUserAgentLength keeps unusually long user agents from filling the table
+const maxUserAgentLength = 512
+
+// Insert records a new session of the user that expires after ttl unless it is used.
+// Only the hash is stored, the plaintext token is returned once.
+func (m *UserSessionsModel) Insert(userID int64, userAgent string, ip string, ttl time.Duration) (string, error) {
+	plaintext, hash, err := newToken()
+	if err != nil {
+		return "", err
+	}
+
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Expired sessions of the user are cleaned up as new ones are created
+	_, err = m.DB.ExecContext(ctx, `DELETE FROM user_sessions WHERE user_id = $1 AND expiry <= NOW()`, userID)
+	if err != nil {
+		return "", err
+	}
+
+	query := `
+        INSERT INTO user_sessions (user_id, token_hash, user_agent, ip, expiry)
+        VALUES ($1, $2, $3, $4, $5)`
+
+	_, err = m.DB.ExecContext(ctx, query, userID, hash, userAgent, ip, time.Now().Add(ttl))
+	if err != nil {
+		return "", err
+	}
+
+	return plaintext, nil
+}
+
+// GetByToken returns the unexpired session of the plaintext token
+func (m *UserSessionsModel) GetByToken(plaintext string) (*UserSession, error) {
+	query := `
+        SELECT s.session_id, s.user_id, s.user_agent, s.ip, s.created_at, s.last_seen_at, s.expiry, u.session_version
+        FROM user_sessions s
+        JOIN users u ON u.user_id = s.user_id
+        WHERE s.token_hash = $1 AND s.expiry > NOW()`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var s UserSession
+	err := m.DB.QueryRowContext(ctx, query, hashToken(plaintext)).Scan(
+		&s.Session_id,
+		&s.User_id,
+		&s.User_agent,
+		&s.IP,
+		&s.Created_at,
+		&s.Last_seen_at,
+		&s.Expiry,
+		&s.Session_version,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+// Touch records that the session was just used and extends it by ttl. To avoid a write
+// on every request, sessions seen in the last minute are left alone.
+func (m *UserSessionsModel) Touch(sessionID int64, ip string, ttl time.Duration) error {
+	query := `
+        UPDATE user_sessions
+        SET last_seen_at = NOW(), ip = $1, expiry = $2
+        WHERE session_id = $3 AND last_seen_at < NOW() - INTERVAL '1 minute'`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, ip, time.Now().Add(ttl), sessionID)
+	return err
+}
+
+// SessionList returns the unexpired sessions of the user, most recently used first
+func (m *UserSessionsModel) SessionList(userID int64) ([]*UserSession, error) {
+	query := `
+        SELECT session_id, user_id, user_agent, ip, created_at, last_seen_at, expiry
+        FROM user_sessions
+        WHERE user_id = $1 AND expiry > NOW()
+        ORDER BY last_seen_at DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []*UserSession
+	for rows.Next() {
+		var s UserSession
+		err := rows.Scan(&s.Session_id, &s.User_id, &s.User_agent, &s.IP, &s.Created_at, &s.Last_seen_at, &s.Expiry)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, &s)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// Revoke signs out one session of the user
+func (m *UserSessionsModel) Revoke(sessionID int64, userID int64) error {
+	query := `
+        DELETE FROM user_sessions
+        WHERE session_id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, sessionID, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// RevokeToken signs out the session of the plaintext token, if there is one
+func (m *UserSessionsModel) RevokeToken(plaintext string) error {
+	query := `
+        DELETE FROM user_sessions WHERE token_hash = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, hashToken(plaintext))
+	return err
+}
+
+// RevokeOthers signs out every session of the user except the one to keep
+func (m *UserSessionsModel) RevokeOthers(userID int64, keepSessionID int64) error {
+	query := `
+        DELETE FROM user_sessions WHERE user_id = $1 AND session_id <> $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, keepSessionID)
+	return err
+}
+
+// RevokeAll signs out every session of the user
+func (m *UserSessionsModel) RevokeAll(userID int64) error {
+	query := `
+        DELETE FROM user_sessions WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID)
+	return err
+}
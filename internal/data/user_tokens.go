@@ -0,0 +1,60 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// ScopeActivation tokens are emailed to new users to confirm their address
+const ScopeActivation = "activation"
+
+// ScopePasswordReset tokens let a user who forgot their password choose a new one
+const ScopePasswordReset = "password-reset"
+
+// ScopeEmailChange tokens are emailed to a new address to confirm it before it replaces the old one
+const ScopeEmailChange = "email-change"
+
+// ScopeUnlock tokens let the owner of an account locked by failed logins unlock it
+const ScopeUnlock = "unlock"
+
+// UserTokensModel struct handles database operations related to the single-use,
+// expiring tokens emailed to users
+type UserTokensModel struct {
+	DB *sql.DB
+}
+
+// New creates a token for the user that expires after ttl. Only the hash is stored,
+// the plaintext token is returned once.
+func (m *UserTokensModel) New(userID int64, ttl time.Duration, scope string) (string, error) {
+	plaintext, hash, err := newToken()
+	if err != nil {
+		return "", err
+	}
+
+	query := `
+        INSERT INTO user_tokens (token_hash, user_id, scope, expiry)
+        VALUES ($1, $2, $3, $4)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err = m.DB.ExecContext(ctx, query, hash, userID, scope, time.Now().Add(ttl))
+	if err != nil {
+		return "", err
+	}
+
+	return plaintext, nil
+}
+
+// DeleteAllForUser removes every token of the scope belonging to the user
+func (m *UserTokensModel) DeleteAllForUser(scope string, userID int64) error {
+	query := `
+    DELETE FROM user_tokens WHERE scope = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, scope, userID)
+	return err
+}
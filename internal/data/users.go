@@ -5,7 +5,9 @@ import (
 	"database/sql"
 	"errors"
 	"github.com/abankelsey/study_helper/internal/validator"
+	"github.com/lib/pq"
 	"golang.org/x/crypto/bcrypt"
+	"slices"
 	"time"
 )
 
@@ -17,16 +19,53 @@ type Users struct {
 	Password_hash []byte    `json:"password_hash"`
 	Activated     bool      `json:"activated"`
 	Created_at    time.Time `json:"created_at"`
+	// bumped to log out every session of the user, e.g. after a password reset
+	Session_version int `json:"-"`
+	// a new email address waiting to be confirmed from the emailed link
+	Pending_email string `json:"-"`
+	// IANA name of the time zone the user's days are counted in
+	Timezone string `json:"timezone"`
+	// whether missed days may be covered by banked streak freezes
+	Streak_freezes bool `json:"streak_freezes"`
+	// what happens to goals left unfinished past their target date, roll or miss
+	Goal_rollover string `json:"goal_rollover"`
+}
+
+// Location is the user's time zone, or UTC if it can not be loaded
+func (u *Users) Location() *time.Location {
+	loc, err := time.LoadLocation(u.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
 }
 
 // validates the fields of the users struct
 func ValidateUsers(v *validator.Validator, users *Users, password string) {
+	ValidateProfile(v, users)
+	ValidatePassword(v, password)
+}
+
+// validates the name and email of the users struct
+func ValidateProfile(v *validator.Validator, users *Users) {
 	v.Check(validator.NotBlank(users.Name), "name", "This field cannot be left blank")
 	v.Check(validator.MaxLength(users.Name, 50), "name", "Must not be more than 50 characters long")
 	v.Check(validator.NotBlank(users.Email), "email", "This field cannot be left blank")
 	v.Check(validator.IsValidEmail(users.Email), "email", "Must be a valid email address")
 	v.Check(validator.MaxLength(users.Email, 100), "email", "Must not be more than 100 characters long")
+}
+
+// validates the time zone and goal roll-over setting of the users struct
+func ValidatePreferences(v *validator.Validator, users *Users) {
+	v.Check(validator.NotBlank(users.Timezone), "timezone", "This field cannot be left blank")
+	v.Check(validator.MaxLength(users.Timezone, 64), "timezone", "Must not be more than 64 characters long")
+	_, err := time.LoadLocation(users.Timezone)
+	v.Check(err == nil && users.Timezone != "Local", "timezone", "Must be a time zone name like America/Belize")
+	v.Check(slices.Contains(GoalRollOverModes, users.Goal_rollover), "goal_rollover", "Must be roll or miss")
+}
 
+// validates a new plaintext password
+func ValidatePassword(v *validator.Validator, password string) {
 	v.Check(validator.NotBlank(password), "password", "This field cannot be left blank")
 	v.Check(validator.MinLength(password, 8), "password", "Password must be at least 8 characters long")
 	v.Check(validator.MaxLength(password, 72), "password", "Password must not be more than 72 characters long") // bcrypt max
@@ -42,6 +81,18 @@ type UsersModel struct {
 
 var ErrInvalidCredentials = errors.New("invalid credentials")
 
+// ErrDuplicateEmail is returned when an email address already belongs to another account
+var ErrDuplicateEmail = errors.New("duplicate email")
+
+// isDuplicateEmail reports whether err is a violation of the unique email constraint
+func isDuplicateEmail(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == "users_email_key"
+}
+
+// ErrNotActivated is returned for a correct password on an account whose email is not confirmed yet
+var ErrNotActivated = errors.New("account not activated")
+
 // Insert a new user into the database with hashed password
 func (m *UsersModel) Insert(users *Users, plainPassword string) error {
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(plainPassword), 12)
@@ -59,10 +110,18 @@ func (m *UsersModel) Insert(users *Users, plainPassword string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	return m.DB.QueryRowContext(
+	err = m.DB.QueryRowContext(
 		ctx, query,
 		users.Name, users.Email, users.Password_hash, users.Activated,
 	).Scan(&users.User_id, &users.Created_at)
+	if err != nil {
+		if isDuplicateEmail(err) {
+			return ErrDuplicateEmail
+		}
+		return err
+	}
+
+	return nil
 }
 
 // Authenticate checks if a user exists and the password is correct
@@ -70,10 +129,9 @@ func (m *UsersModel) Authenticate(email, plainPassword string) (*Users, error) {
 	var user Users
 
 	query := `
-        SELECT user_id, password_hash
+        SELECT user_id, password_hash, activated, session_version
         FROM users
-        WHERE email = $1
-		AND activated = TRUE`
+        WHERE email = $1`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -81,6 +139,8 @@ func (m *UsersModel) Authenticate(email, plainPassword string) (*Users, error) {
 	err := m.DB.QueryRowContext(ctx, query, email).Scan(
 		&user.User_id,
 		&user.Password_hash,
+		&user.Activated,
+		&user.Session_version,
 	)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -95,6 +155,11 @@ func (m *UsersModel) Authenticate(email, plainPassword string) (*Users, error) {
 		return nil, ErrInvalidCredentials
 	}
 
+	// Only tell the user to activate once they have proven they own the account
+	if !user.Activated {
+		return nil, ErrNotActivated
+	}
+
 	return &user, nil
 }
 
@@ -103,7 +168,7 @@ func (m *UsersModel) GetUser(userID int64) (*Users, error) {
 	var user Users
 
 	query := `
-        SELECT user_id, username, email, password_hash, activated, created_at
+        SELECT user_id, name, email, password_hash, activated, created_at, pending_email, timezone, streak_freezes, goal_rollover
         FROM users
         WHERE user_id = $1`
 
@@ -117,6 +182,10 @@ func (m *UsersModel) GetUser(userID int64) (*Users, error) {
 		&user.Password_hash,
 		&user.Activated,
 		&user.Created_at,
+		&user.Pending_email,
+		&user.Timezone,
+		&user.Streak_freezes,
+		&user.Goal_rollover,
 	)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -127,3 +196,367 @@ func (m *UsersModel) GetUser(userID int64) (*Users, error) {
 
 	return &user, nil
 }
+
+// GetByEmail fetches a user by email address
+func (m *UsersModel) GetByEmail(email string) (*Users, error) {
+	var user Users
+
+	query := `
+        SELECT user_id, name, email, password_hash, activated, created_at
+        FROM users
+        WHERE email = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, email).Scan(
+		&user.User_id,
+		&user.Name,
+		&user.Email,
+		&user.Password_hash,
+		&user.Activated,
+		&user.Created_at,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// Activate marks the owner of an unexpired activation token as activated and deletes
+// their activation tokens so the link only works once
+func (m *UsersModel) Activate(plaintext string) (*Users, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+        UPDATE users
+        SET activated = TRUE
+        WHERE user_id = (
+            SELECT user_id FROM user_tokens
+            WHERE token_hash = $1 AND scope = $2 AND expiry > NOW()
+        )
+        RETURNING user_id, name, email, activated, created_at`
+
+	var user Users
+	err = tx.QueryRowContext(ctx, query, hashToken(plaintext), ScopeActivation).Scan(
+		&user.User_id,
+		&user.Name,
+		&user.Email,
+		&user.Activated,
+		&user.Created_at,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM user_tokens WHERE user_id = $1 AND scope = $2`, user.User_id, ScopeActivation)
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, tx.Commit()
+}
+
+// GetForToken fetches the owner of an unexpired token of the scope
+func (m *UsersModel) GetForToken(scope string, plaintext string) (*Users, error) {
+	var user Users
+
+	query := `
+        SELECT u.user_id, u.name, u.email, u.activated, u.created_at
+        FROM users u
+        JOIN user_tokens t ON t.user_id = u.user_id
+        WHERE t.token_hash = $1 AND t.scope = $2 AND t.expiry > NOW()`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, hashToken(plaintext), scope).Scan(
+		&user.User_id,
+		&user.Name,
+		&user.Email,
+		&user.Activated,
+		&user.Created_at,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// ResetPassword sets a new password for the owner of an unexpired password reset token.
+// The user's reset tokens are deleted and every existing session is logged out.
+func (m *UsersModel) ResetPassword(plaintext string, newPassword string) (*Users, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), 12)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Opening the emailed link also proves the user owns the address, so the account is activated
+	query := `
+        UPDATE users
+        SET password_hash = $1,
+            activated = TRUE,
+            session_version = session_version + 1
+        WHERE user_id = (
+            SELECT user_id FROM user_tokens
+            WHERE token_hash = $2 AND scope = $3 AND expiry > NOW()
+        )
+        RETURNING user_id, name, email, activated, created_at, session_version`
+
+	var user Users
+	err = tx.QueryRowContext(ctx, query, hashedPassword, hashToken(plaintext), ScopePasswordReset).Scan(
+		&user.User_id,
+		&user.Name,
+		&user.Email,
+		&user.Activated,
+		&user.Created_at,
+		&user.Session_version,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM user_tokens WHERE user_id = $1 AND scope = $2`, user.User_id, ScopePasswordReset)
+	if err != nil {
+		return nil, err
+	}
+
+	// Every logged in device has to log in again with the new password
+	_, err = tx.ExecContext(ctx, `DELETE FROM user_sessions WHERE user_id = $1`, user.User_id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, tx.Commit()
+}
+
+// SessionVersion returns the current session version of the user, sessions created
+// with an older version are no longer valid
+func (m *UsersModel) SessionVersion(userID int64) (int, error) {
+	query := `
+        SELECT session_version
+        FROM users
+        WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var version int
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(&version)
+	if err != nil {
+		return 0, err
+	}
+
+	return version, nil
+}
+
+// MatchesPassword reports whether plainPassword is the user's current password
+func (m *UsersModel) MatchesPassword(userID int64, plainPassword string) (bool, error) {
+	query := `
+        SELECT password_hash
+        FROM users
+        WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var hash []byte
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(&hash)
+	if err != nil {
+		return false, err
+	}
+
+	err = bcrypt.CompareHashAndPassword(hash, []byte(plainPassword))
+	if err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// UpdateName changes the name of the user
+func (m *UsersModel) UpdateName(userID int64, name string) error {
+	query := `
+        UPDATE users
+        SET name = $1
+        WHERE user_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, name, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// UpdatePreferences changes the time zone of the user, whether they bank streak freezes
+// and what happens to their unfinished goals
+func (m *UsersModel) UpdatePreferences(userID int64, preferences *Users) error {
+	query := `
+        UPDATE users
+        SET timezone = $1, streak_freezes = $2, goal_rollover = $3
+        WHERE user_id = $4`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, preferences.Timezone, preferences.Streak_freezes, preferences.Goal_rollover, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// RequestEmailChange keeps email as the user's pending address until it is confirmed.
+// Returns ErrDuplicateEmail if another account already uses it.
+func (m *UsersModel) RequestEmailChange(userID int64, email string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var taken bool
+	err := m.DB.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE email = $1 AND user_id <> $2)`, email, userID).Scan(&taken)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrDuplicateEmail
+	}
+
+	query := `
+        UPDATE users
+        SET pending_email = $1
+        WHERE user_id = $2`
+
+	_, err = m.DB.ExecContext(ctx, query, email, userID)
+	return err
+}
+
+// ConfirmEmailChange makes the pending address of the owner of an unexpired email change
+// token their email. Password reset links sent to the old address stop working.
+func (m *UsersModel) ConfirmEmailChange(plaintext string) (*Users, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+        UPDATE users
+        SET email = pending_email, pending_email = ''
+        WHERE pending_email <> '' AND user_id = (
+            SELECT user_id FROM user_tokens
+            WHERE token_hash = $1 AND scope = $2 AND expiry > NOW()
+        )
+        RETURNING user_id, name, email, activated, created_at`
+
+	var user Users
+	err = tx.QueryRowContext(ctx, query, hashToken(plaintext), ScopeEmailChange).Scan(
+		&user.User_id,
+		&user.Name,
+		&user.Email,
+		&user.Activated,
+		&user.Created_at,
+	)
+	if err != nil {
+		if isDuplicateEmail(err) {
+			return nil, ErrDuplicateEmail
+		}
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM user_tokens WHERE user_id = $1 AND scope IN ($2, $3)`, user.User_id, ScopeEmailChange, ScopePasswordReset)
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, tx.Commit()
+}
+
+// ChangePassword sets a new password for the user
+func (m *UsersModel) ChangePassword(userID int64, newPassword string) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), 12)
+	if err != nil {
+		return err
+	}
+
+	query := `
+        UPDATE users
+        SET password_hash = $1
+        WHERE user_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err = m.DB.ExecContext(ctx, query, hashedPassword, userID)
+	return err
+}
+
+// Delete removes the user. Their goals, study sessions, quotes and everything else that
+// belongs to them are removed by the database's foreign keys.
+func (m *UsersModel) Delete(userID int64) error {
+	query := `
+        DELETE FROM users
+        WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
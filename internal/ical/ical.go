@@ -0,0 +1,208 @@
+// Package ical reads and writes the parts of iCalendar (RFC 5545) that the study
+// helper exchanges with calendar clients: VCALENDAR objects holding VEVENT and
+// VTODO components.
+package ical
+
+import (
+	"bufio"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// the date formats used by DATE and DATE-TIME values
+const (
+	DateFormat     = "20060102"
+	DateTimeFormat = "20060102T150405Z"
+)
+
+// Property is a single content line such as DTSTART;VALUE=DATE:20261018
+type Property struct {
+	Name   string
+	Params map[string]string
+	Value  string
+}
+
+// Component is a VEVENT, VTODO or any other BEGIN/END block
+type Component struct {
+	Name       string
+	Properties []*Property
+	Components []*Component
+}
+
+// Calendar is a VCALENDAR object
+type Calendar struct {
+	Component
+}
+
+// NewCalendar returns an empty calendar identified by prodID
+func NewCalendar(prodID string, name string) *Calendar {
+	c := &Calendar{Component{Name: "VCALENDAR"}}
+	c.Add("VERSION", "2.0")
+	c.Add("PRODID", prodID)
+	c.Add("CALSCALE", "GREGORIAN")
+	if name != "" {
+		c.AddText("X-WR-CALNAME", name)
+	}
+	return c
+}
+
+// NewComponent returns an empty component such as VEVENT or VTODO
+func NewComponent(name string) *Component {
+	return &Component{Name: name}
+}
+
+// Add appends a property whose value is already encoded. Params are given as
+// name, value pairs.
+func (c *Component) Add(name string, value string, params ...string) {
+	p := &Property{Name: name, Value: value}
+	if len(params) > 1 {
+		p.Params = map[string]string{}
+		for i := 0; i+1 < len(params); i += 2 {
+			p.Params[params[i]] = params[i+1]
+		}
+	}
+	c.Properties = append(c.Properties, p)
+}
+
+// AddText appends a TEXT property, escaping the value
+func (c *Component) AddText(name string, value string) {
+	c.Add(name, EscapeText(value))
+}
+
+// AddDate appends a DATE property such as DTSTART;VALUE=DATE
+func (c *Component) AddDate(name string, t time.Time) {
+	c.Add(name, t.Format(DateFormat), "VALUE", "DATE")
+}
+
+// AddDateTime appends a UTC DATE-TIME property such as DTSTAMP
+func (c *Component) AddDateTime(name string, t time.Time) {
+	c.Add(name, t.UTC().Format(DateTimeFormat))
+}
+
+// AddComponent nests a component, e.g. a VEVENT inside a VCALENDAR
+func (c *Component) AddComponent(child *Component) {
+	c.Components = append(c.Components, child)
+}
+
+// Get returns the first property with the given name, or nil
+func (c *Component) Get(name string) *Property {
+	for _, p := range c.Properties {
+		if p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// GetAll returns every property with the given name
+func (c *Component) GetAll(name string) []*Property {
+	var props []*Property
+	for _, p := range c.Properties {
+		if p.Name == name {
+			props = append(props, p)
+		}
+	}
+	return props
+}
+
+// WriteTo encodes the calendar with CRLF line endings and folded long lines
+func (c *Calendar) WriteTo(w io.Writer) (int64, error) {
+	cw := &countWriter{w: bufio.NewWriter(w)}
+	c.Component.write(cw)
+	if cw.err != nil {
+		return cw.n, cw.err
+	}
+	return cw.n, cw.w.Flush()
+}
+
+func (c *Component) write(w *countWriter) {
+	w.line("BEGIN:" + c.Name)
+	for _, p := range c.Properties {
+		w.line(p.String())
+	}
+	for _, child := range c.Components {
+		child.write(w)
+	}
+	w.line("END:" + c.Name)
+}
+
+// String formats the property as an unfolded content line
+func (p *Property) String() string {
+	var b strings.Builder
+	b.WriteString(p.Name)
+	for _, name := range sortedKeys(p.Params) {
+		value := p.Params[name]
+		b.WriteString(";" + name + "=")
+		if strings.ContainsAny(value, ":;,") {
+			value = `"` + value + `"`
+		}
+		b.WriteString(value)
+	}
+	b.WriteString(":" + p.Value)
+	return b.String()
+}
+
+// EscapeText escapes a TEXT value
+func EscapeText(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+	return r.Replace(s)
+}
+
+// UnescapeText reverses EscapeText
+func UnescapeText(s string) string {
+	r := strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n")
+	return r.Replace(s)
+}
+
+// countWriter writes folded content lines and remembers the first error
+type countWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+// line writes a content line folded at 75 octets without splitting UTF-8 characters
+func (cw *countWriter) line(s string) {
+	for first := true; len(s) > 0; first = false {
+		limit := 75
+		if !first {
+			limit = 74 // the leading space counts towards the limit
+		}
+		cut := len(s)
+		if cut > limit {
+			cut = limit
+			for cut > 0 && !utf8Start(s[cut]) {
+				cut--
+			}
+		}
+		if !first {
+			cw.write(" ")
+		}
+		cw.write(s[:cut] + "\r\n")
+		s = s[cut:]
+	}
+}
+
+func (cw *countWriter) write(s string) {
+	if cw.err != nil {
+		return
+	}
+	n, err := io.WriteString(cw.w, s)
+	cw.n += int64(n)
+	cw.err = err
+}
+
+func utf8Start(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,222 @@
+package ical
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestEscapeText(t *testing.T) {
+	tests := []struct {
+		text    string
+		escaped string
+	}{
+		{"plain", "plain"},
+		{"Maths; chapter 2, part 1", `Maths\; chapter 2\, part 1`},
+		{`C:\notes`, `C:\\notes`},
+		{"two\nlines", `two\nlines`},
+		{"windows\r\nlines", `windows\nlines`},
+		{`already \n escaped`, `already \\n escaped`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			if got := EscapeText(tt.text); got != tt.escaped {
+				t.Errorf("EscapeText(%q) = %q, want %q", tt.text, got, tt.escaped)
+			}
+			want := strings.ReplaceAll(tt.text, "\r\n", "\n")
+			if got := UnescapeText(tt.escaped); got != want {
+				t.Errorf("UnescapeText(%q) = %q, want %q", tt.escaped, got, want)
+			}
+		})
+	}
+
+	if got := UnescapeText(`one\Ntwo`); got != "one\ntwo" {
+		t.Errorf(`UnescapeText("one\\Ntwo") = %q, want a newline`, got)
+	}
+}
+
+func TestWriteFoldsLongLines(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{"short", "Revise calculus"},
+		{"exactly one line", strings.Repeat("a", 75-len("SUMMARY:"))},
+		{"one octet over", strings.Repeat("a", 76-len("SUMMARY:"))},
+		{"several lines", strings.Repeat("0123456789", 30)},
+		{"multi-byte characters", strings.Repeat("é漢", 60)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cal := NewCalendar("-//test//EN", "")
+			event := NewComponent("VEVENT")
+			event.AddText("SUMMARY", tt.value)
+			cal.AddComponent(event)
+
+			var buf bytes.Buffer
+			n, err := cal.WriteTo(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != int64(buf.Len()) {
+				t.Errorf("WriteTo() = %d, wrote %d bytes", n, buf.Len())
+			}
+
+			out := buf.String()
+			if !strings.HasSuffix(out, "\r\n") {
+				t.Errorf("output does not end with CRLF")
+			}
+			for _, line := range strings.Split(strings.TrimSuffix(out, "\r\n"), "\r\n") {
+				if len(line) > 75 {
+					t.Errorf("line of %d octets: %q", len(line), line)
+				}
+				if !utf8.ValidString(line) {
+					t.Errorf("line splits a character: %q", line)
+				}
+			}
+
+			parsed, err := Parse(strings.NewReader(out))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := parsed.Components[0].Text("SUMMARY"); got != tt.value {
+				t.Errorf("unfolded SUMMARY = %q, want %q", got, tt.value)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	input := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"BEGIN:VEVENT",
+		"UID:abc@example.com",
+		"SUMMARY:Study\\, then",
+		"  rest", // folded with a space, the first space is dropped
+		"DTSTART;VALUE=DATE:20261018",
+		`ATTENDEE;CN="Doe; Jane";ROLE=CHAIR:mailto:jane@example.com`,
+		"BEGIN:VALARM",
+		"ACTION:DISPLAY",
+		"END:VALARM",
+		"END:VEVENT",
+		"BEGIN:VTODO",
+		"SUMMARY:Essay",
+		"END:VTODO",
+		"END:VCALENDAR",
+		"",
+	}, "\n")
+
+	cal, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cal.Components) != 2 {
+		t.Fatalf("got %d components, want 2", len(cal.Components))
+	}
+
+	event := cal.Components[0]
+	if event.Name != "VEVENT" || len(event.Components) != 1 || event.Components[0].Name != "VALARM" {
+		t.Errorf("unexpected nesting: %+v", event)
+	}
+	if got := event.Text("SUMMARY"); got != "Study, then rest" {
+		t.Errorf("SUMMARY = %q", got)
+	}
+	if p := event.Get("DTSTART"); p == nil || !p.IsDate() || p.Params["VALUE"] != "DATE" {
+		t.Errorf("DTSTART = %+v", p)
+	}
+	attendee := event.Get("ATTENDEE")
+	if attendee == nil || attendee.Params["CN"] != "Doe; Jane" || attendee.Params["ROLE"] != "CHAIR" || attendee.Value != "mailto:jane@example.com" {
+		t.Errorf("ATTENDEE = %+v", attendee)
+	}
+	if got := cal.Components[1].Text("SUMMARY"); got != "Essay" {
+		t.Errorf("VTODO SUMMARY = %q", got)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"empty", ""},
+		{"not a calendar", "BEGIN:VEVENT\r\nEND:VEVENT\r\n"},
+		{"missing end", "BEGIN:VCALENDAR\r\nVERSION:2.0\r\n"},
+		{"mismatched end", "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nEND:VTODO\r\nEND:VCALENDAR\r\n"},
+		{"property outside", "VERSION:2.0\r\nBEGIN:VCALENDAR\r\nEND:VCALENDAR\r\n"},
+		{"missing value", "BEGIN:VCALENDAR\r\nVERSION\r\nEND:VCALENDAR\r\n"},
+		{"unterminated quote", "BEGIN:VCALENDAR\r\nX-A;CN=\"open:value\r\nEND:VCALENDAR\r\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(tt.input))
+			if !errors.Is(err, ErrInvalidCalendar) {
+				t.Errorf("Parse() error = %v, want ErrInvalidCalendar", err)
+			}
+		})
+	}
+}
+
+func TestPropertyString(t *testing.T) {
+	c := NewComponent("VEVENT")
+	c.Add("ATTENDEE", "mailto:a@example.com", "ROLE", "CHAIR", "CN", "Doe, Jane")
+	c.AddDate("DTSTART", time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC))
+	c.AddDateTime("DTSTAMP", time.Date(2026, 10, 18, 9, 30, 0, 0, time.FixedZone("UTC+2", 2*60*60)))
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"ATTENDEE", `ATTENDEE;CN="Doe, Jane";ROLE=CHAIR:mailto:a@example.com`},
+		{"DTSTART", "DTSTART;VALUE=DATE:20261018"},
+		{"DTSTAMP", "DTSTAMP:20261018T073000Z"},
+	}
+
+	for _, tt := range tests {
+		if got := c.Get(tt.name).String(); got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPropertyDate(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		params  map[string]string
+		want    string
+		wantErr bool
+	}{
+		{"date", "20261018", nil, "2026-10-18", false},
+		{"UTC date-time", "20261018T233000Z", nil, "2026-10-18", false},
+		{"floating date-time", "20261018T000000", nil, "2026-10-18", false},
+		{"date-time with TZID", "20261018T233000", map[string]string{"TZID": "UTC"}, "2026-10-18", false},
+		{"too short", "2026", nil, "", true},
+		{"not a date", "2026101X", nil, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Property{Name: "DTSTART", Value: tt.value, Params: tt.params}
+			got, err := p.Date()
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Date() = %v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Format("2006-01-02") != tt.want || got.Location() != time.UTC || got.Hour() != 0 {
+				t.Errorf("Date() = %v, want midnight UTC of %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package ical
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+var ErrInvalidCalendar = errors.New("invalid iCalendar data")
+
+// Parse reads the first VCALENDAR object from r
+func Parse(r io.Reader) (*Calendar, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var stack []*Component
+	var cal *Calendar
+
+	for n, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		p, err := parseLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d: %v", ErrInvalidCalendar, n+1, err)
+		}
+
+		switch p.Name {
+		case "BEGIN":
+			c := NewComponent(strings.ToUpper(p.Value))
+			if len(stack) == 0 {
+				if c.Name != "VCALENDAR" {
+					return nil, fmt.Errorf("%w: expected VCALENDAR, found %s", ErrInvalidCalendar, c.Name)
+				}
+				cal = &Calendar{*c}
+				stack = append(stack, &cal.Component)
+				continue
+			}
+			parent := stack[len(stack)-1]
+			parent.AddComponent(c)
+			stack = append(stack, c)
+
+		case "END":
+			if len(stack) == 0 || stack[len(stack)-1].Name != strings.ToUpper(p.Value) {
+				return nil, fmt.Errorf("%w: unexpected END:%s", ErrInvalidCalendar, p.Value)
+			}
+			stack = stack[:len(stack)-1]
+			if len(stack) == 0 {
+				return cal, nil
+			}
+
+		default:
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("%w: property outside of VCALENDAR", ErrInvalidCalendar)
+			}
+			c := stack[len(stack)-1]
+			c.Properties = append(c.Properties, p)
+		}
+	}
+
+	return nil, fmt.Errorf("%w: missing END:VCALENDAR", ErrInvalidCalendar)
+}
+
+// unfold joins folded lines, accepting both CRLF and bare LF line endings
+func unfold(r io.Reader) ([]string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var lines []string
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(line) > 0 && (line[0] == ' ' || line[0] == '\t') && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return lines, nil
+}
+
+// parseLine splits a content line into its name, parameters and value
+func parseLine(line string) (*Property, error) {
+	p := &Property{}
+
+	// The name ends at the first ';' or ':'
+	i := strings.IndexAny(line, ";:")
+	if i <= 0 {
+		return nil, errors.New("missing property name")
+	}
+	p.Name = strings.ToUpper(line[:i])
+	rest := line[i:]
+
+	// Parameters may contain quoted values with ':' or ';' in them
+	for len(rest) > 0 && rest[0] == ';' {
+		rest = rest[1:]
+		eq := strings.IndexByte(rest, '=')
+		if eq <= 0 {
+			return nil, errors.New("malformed parameter")
+		}
+		name := strings.ToUpper(rest[:eq])
+		rest = rest[eq+1:]
+
+		var value string
+		if len(rest) > 0 && rest[0] == '"' {
+			end := strings.IndexByte(rest[1:], '"')
+			if end < 0 {
+				return nil, errors.New("unterminated quoted parameter")
+			}
+			value = rest[1 : end+1]
+			rest = rest[end+2:]
+		} else {
+			end := strings.IndexAny(rest, ";:")
+			if end < 0 {
+				return nil, errors.New("missing property value")
+			}
+			value = rest[:end]
+			rest = rest[end:]
+		}
+
+		if p.Params == nil {
+			p.Params = map[string]string{}
+		}
+		p.Params[name] = value
+	}
+
+	if len(rest) == 0 || rest[0] != ':' {
+		return nil, errors.New("missing property value")
+	}
+	p.Value = rest[1:]
+
+	return p, nil
+}
+
+// Text returns the unescaped value of a TEXT property, or "" when it is missing
+func (c *Component) Text(name string) string {
+	p := c.Get(name)
+	if p == nil {
+		return ""
+	}
+	return UnescapeText(p.Value)
+}
+
+// Date returns the calendar day of a DATE or DATE-TIME property. DATE-TIMEs with a
+// TZID are read in that zone when it is known, floating times are taken as they are.
+func (p *Property) Date() (time.Time, error) {
+	value := p.Value
+	if len(value) < 8 {
+		return time.Time{}, fmt.Errorf("%w: invalid date %q", ErrInvalidCalendar, value)
+	}
+
+	if len(value) == 8 {
+		return time.Parse(DateFormat, value)
+	}
+
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse(DateTimeFormat, value)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return truncate(t), nil
+	}
+
+	loc := time.UTC
+	if tzid := p.Params["TZID"]; tzid != "" {
+		if l, err := time.LoadLocation(tzid); err == nil {
+			loc = l
+		}
+	}
+	t, err := time.ParseInLocation("20060102T150405", value, loc)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return truncate(t), nil
+}
+
+// IsDate reports whether the property holds a DATE rather than a DATE-TIME
+func (p *Property) IsDate() bool {
+	return p.Params["VALUE"] == "DATE" || len(p.Value) == 8
+}
+
+// truncate keeps only the calendar day of t
+func truncate(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,80 @@
+// Package mailer sends the app's emails through a pluggable delivery backend.
+package mailer
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers messages, e.g. over SMTP or to files during development
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// Bytes formats the message as an RFC 5322 email from sender
+func (msg Message) Bytes(sender string) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", sender)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(strings.ReplaceAll(msg.Body, "\r\n", "\n"), "\n", "\r\n"))
+	return b.Bytes()
+}
+
+// SMTPMailer sends messages through an SMTP server, such as a local stand-in like MailHog
+type SMTPMailer struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	Sender   string
+}
+
+// Send delivers the message to the SMTP server
+func (m *SMTPMailer) Send(msg Message) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	addr := m.Host + ":" + strconv.Itoa(m.Port)
+	return smtp.SendMail(addr, auth, m.Sender, []string{msg.To}, msg.Bytes(m.Sender))
+}
+
+// FileMailer writes every message to an .eml file in Dir instead of sending it
+type FileMailer struct {
+	Dir    string
+	Sender string
+}
+
+var unsafeFilename = regexp.MustCompile(`[^a-zA-Z0-9@._-]+`)
+
+// Send writes the message to a new file named after the time and recipient
+func (m *FileMailer) Send(msg Message) error {
+	err := os.MkdirAll(m.Dir, 0o700)
+	if err != nil {
+		return err
+	}
+
+	name := time.Now().Format("20060102T150405.000000000") + "-" + unsafeFilename.ReplaceAllString(msg.To, "_") + ".eml"
+	return os.WriteFile(filepath.Join(m.Dir, name), msg.Bytes(m.Sender), 0o600)
+}
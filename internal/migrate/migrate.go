@@ -0,0 +1,309 @@
+// Package migrate applies the numbered SQL migrations to Postgres and records the
+// schema version in a schema_migrations table. The table has the same layout as the
+// one the golang-migrate CLI uses, so databases migrated with either can be shared.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// lockKey is the Postgres advisory lock held while migrating, so servers starting
+// at the same time take turns
+const lockKey = 7263541894
+
+// ErrDirty is returned when an earlier migration failed half way. Fix the database by
+// hand, then use Force to record the version it is at.
+var ErrDirty = errors.New("database is dirty, fix it by hand and force a version")
+
+// ErrNoChange is returned by Down when no migration is applied
+var ErrNoChange = errors.New("no migration to roll back")
+
+var filenameRX = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// Migration is one numbered schema change with the SQL to apply and undo it
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status is the version a database is at and the migrations it has not applied yet
+type Status struct {
+	Version int64 // 0 when no migration is applied
+	Dirty   bool
+	Applied []*Migration
+	Pending []*Migration
+}
+
+// Migrator applies migrations to a database
+type Migrator struct {
+	DB         *sql.DB
+	Logger     *slog.Logger
+	Migrations []*Migration // in version order
+}
+
+// New loads the migrations in fsys
+func New(db *sql.DB, fsys fs.FS, logger *slog.Logger) (*Migrator, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{DB: db, Logger: logger, Migrations: migrations}, nil
+}
+
+// Load reads the NNNNNN_name.up.sql and NNNNNN_name.down.sql files in fsys
+func Load(fsys fs.FS) ([]*Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, entry := range entries {
+		match := filenameRX.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil || version < 1 {
+			return nil, fmt.Errorf("migrate: invalid version in %s", entry.Name())
+		}
+
+		b, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migrate: version %d is used by %s and %s", version, m.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			m.Up = string(b)
+		} else {
+			m.Down = string(b)
+		}
+	}
+
+	migrations := make([]*Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migrate: version %d has no up migration", m.Version)
+		}
+		migrations = append(migrations, m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// withLock runs fn on one connection while holding the advisory lock
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, lockKey)
+	if err != nil {
+		return err
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, lockKey)
+
+	_, err = conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (version bigint NOT NULL PRIMARY KEY, dirty boolean NOT NULL)`)
+	if err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
+
+// version reads the version the database is at
+func version(ctx context.Context, conn *sql.Conn) (int64, bool, error) {
+	var v int64
+	var dirty bool
+	err := conn.QueryRowContext(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&v, &dirty)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+	return v, dirty, nil
+}
+
+// setVersion records the version in tx. Version 0 means no migration is applied.
+func setVersion(ctx context.Context, tx *sql.Tx, v int64, dirty bool) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM schema_migrations`)
+	if err != nil {
+		return err
+	}
+	if v == 0 {
+		return nil
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, dirty) VALUES ($1, $2)`, v, dirty)
+	return err
+}
+
+// run applies the SQL and records the new version in one transaction, so a failed
+// migration leaves the database as it was
+func (m *Migrator) run(ctx context.Context, conn *sql.Conn, query string, newVersion int64) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	err = setVersion(ctx, tx, newVersion, false)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Up applies every pending migration and returns how many were applied
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	applied := 0
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		current, dirty, err := version(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if dirty {
+			return ErrDirty
+		}
+
+		for _, migration := range m.Migrations {
+			if migration.Version <= current {
+				continue
+			}
+
+			err := m.run(ctx, conn, migration.Up, migration.Version)
+			if err != nil {
+				return fmt.Errorf("migrate: %06d_%s up: %w", migration.Version, migration.Name, err)
+			}
+			m.Logger.Info("applied migration", "version", migration.Version, "name", migration.Name)
+			applied++
+		}
+		return nil
+	})
+
+	return applied, err
+}
+
+// Down rolls back the last n applied migrations and returns how many were rolled back
+func (m *Migrator) Down(ctx context.Context, n int) (int, error) {
+	rolledBack := 0
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		current, dirty, err := version(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if dirty {
+			return ErrDirty
+		}
+		if current == 0 {
+			return ErrNoChange
+		}
+
+		for i := len(m.Migrations) - 1; i >= 0 && rolledBack < n; i-- {
+			migration := m.Migrations[i]
+			if migration.Version > current {
+				continue
+			}
+			if migration.Down == "" {
+				return fmt.Errorf("migrate: %06d_%s has no down migration", migration.Version, migration.Name)
+			}
+
+			var previous int64
+			if i > 0 {
+				previous = m.Migrations[i-1].Version
+			}
+
+			err := m.run(ctx, conn, migration.Down, previous)
+			if err != nil {
+				return fmt.Errorf("migrate: %06d_%s down: %w", migration.Version, migration.Name, err)
+			}
+			m.Logger.Info("rolled back migration", "version", migration.Version, "name", migration.Name)
+			rolledBack++
+		}
+		return nil
+	})
+
+	return rolledBack, err
+}
+
+// Status returns the version the database is at and which migrations are pending
+func (m *Migrator) Status(ctx context.Context) (*Status, error) {
+	status := &Status{}
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		var err error
+		status.Version, status.Dirty, err = version(ctx, conn)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, migration := range m.Migrations {
+		if migration.Version <= status.Version {
+			status.Applied = append(status.Applied, migration)
+		} else {
+			status.Pending = append(status.Pending, migration)
+		}
+	}
+
+	return status, nil
+}
+
+// Force records v as the version of the database and clears the dirty flag without
+// running any SQL. Version 0 means no migration is applied.
+func (m *Migrator) Force(ctx context.Context, v int64) error {
+	known := v == 0
+	for _, migration := range m.Migrations {
+		if migration.Version == v {
+			known = true
+		}
+	}
+	if !known {
+		return fmt.Errorf("migrate: no migration has version %d", v)
+	}
+
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		err = setVersion(ctx, tx, v, false)
+		if err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+}
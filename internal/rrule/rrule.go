@@ -0,0 +1,362 @@
+// Package rrule implements the date based subset of iCalendar (RFC 5545) recurrence
+// rules that study sessions need: FREQ, INTERVAL, COUNT, UNTIL, BYDAY, BYMONTHDAY
+// and BYMONTH. Occurrences are whole days, so time parts are ignored.
+package rrule
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the supported FREQ values
+const (
+	Daily   = "DAILY"
+	Weekly  = "WEEKLY"
+	Monthly = "MONTHLY"
+	Yearly  = "YEARLY"
+)
+
+// MaxOccurrences caps how many occurrences a single rule can expand to
+const MaxOccurrences = 1000
+
+var ErrInvalidRule = errors.New("invalid recurrence rule")
+
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+// WeekdayNum is a BYDAY entry such as MO, 2TU or -1FR
+type WeekdayNum struct {
+	N       int
+	Weekday time.Weekday
+}
+
+// Rule is a parsed RRULE value
+type Rule struct {
+	Freq       string
+	Interval   int
+	Count      int
+	Until      time.Time
+	ByDay      []WeekdayNum
+	ByMonthDay []int
+	ByMonth    []int
+}
+
+// Parse reads an RRULE value such as "FREQ=WEEKLY;BYDAY=MO,WE,FR;UNTIL=20261215".
+// A leading "RRULE:" is accepted.
+func Parse(value string) (*Rule, error) {
+	value = strings.TrimSpace(value)
+	value = strings.TrimPrefix(strings.TrimPrefix(value, "RRULE:"), "rrule:")
+	if value == "" {
+		return nil, fmt.Errorf("%w: empty rule", ErrInvalidRule)
+	}
+
+	r := &Rule{Interval: 1}
+	for _, part := range strings.Split(value, ";") {
+		name, val, ok := strings.Cut(part, "=")
+		if !ok || val == "" {
+			return nil, fmt.Errorf("%w: malformed part %q", ErrInvalidRule, part)
+		}
+
+		var err error
+		switch strings.ToUpper(name) {
+		case "FREQ":
+			r.Freq = strings.ToUpper(val)
+			if r.Freq != Daily && r.Freq != Weekly && r.Freq != Monthly && r.Freq != Yearly {
+				return nil, fmt.Errorf("%w: unsupported FREQ %q", ErrInvalidRule, val)
+			}
+		case "INTERVAL":
+			r.Interval, err = strconv.Atoi(val)
+			if err != nil || r.Interval < 1 {
+				return nil, fmt.Errorf("%w: INTERVAL must be a positive number", ErrInvalidRule)
+			}
+		case "COUNT":
+			r.Count, err = strconv.Atoi(val)
+			if err != nil || r.Count < 1 {
+				return nil, fmt.Errorf("%w: COUNT must be a positive number", ErrInvalidRule)
+			}
+		case "UNTIL":
+			r.Until, err = parseUntil(val)
+			if err != nil {
+				return nil, fmt.Errorf("%w: UNTIL must be a date like 20261215", ErrInvalidRule)
+			}
+		case "BYDAY":
+			for _, day := range strings.Split(val, ",") {
+				wd, err := parseWeekdayNum(day)
+				if err != nil {
+					return nil, err
+				}
+				r.ByDay = append(r.ByDay, wd)
+			}
+		case "BYMONTHDAY":
+			r.ByMonthDay, err = parseInts(val, -31, 31)
+			if err != nil {
+				return nil, fmt.Errorf("%w: BYMONTHDAY must be between -31 and 31", ErrInvalidRule)
+			}
+		case "BYMONTH":
+			r.ByMonth, err = parseInts(val, 1, 12)
+			if err != nil {
+				return nil, fmt.Errorf("%w: BYMONTH must be between 1 and 12", ErrInvalidRule)
+			}
+		case "WKST":
+			// Weeks always start on Monday here, which is the RFC 5545 default
+		default:
+			return nil, fmt.Errorf("%w: unsupported part %q", ErrInvalidRule, name)
+		}
+	}
+
+	if r.Freq == "" {
+		return nil, fmt.Errorf("%w: FREQ is required", ErrInvalidRule)
+	}
+	if r.Count > 0 && !r.Until.IsZero() {
+		return nil, fmt.Errorf("%w: COUNT and UNTIL cannot both be set", ErrInvalidRule)
+	}
+	for _, wd := range r.ByDay {
+		if wd.N != 0 && r.Freq != Monthly && r.Freq != Yearly {
+			return nil, fmt.Errorf("%w: numbered BYDAY needs FREQ=MONTHLY or FREQ=YEARLY", ErrInvalidRule)
+		}
+	}
+
+	return r, nil
+}
+
+// String formats the rule back into its RRULE value
+func (r *Rule) String() string {
+	parts := []string{"FREQ=" + r.Freq}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if !r.Until.IsZero() {
+		parts = append(parts, "UNTIL="+r.Until.Format("20060102"))
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+		for i, wd := range r.ByDay {
+			days[i] = wd.String()
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		parts = append(parts, "BYMONTHDAY="+joinInts(r.ByMonthDay))
+	}
+	if len(r.ByMonth) > 0 {
+		parts = append(parts, "BYMONTH="+joinInts(r.ByMonth))
+	}
+	return strings.Join(parts, ";")
+}
+
+// String formats a BYDAY entry
+func (wd WeekdayNum) String() string {
+	for code, day := range weekdays {
+		if day == wd.Weekday {
+			if wd.N != 0 {
+				return strconv.Itoa(wd.N) + code
+			}
+			return code
+		}
+	}
+	return ""
+}
+
+// Between returns the occurrences of the rule starting at dtstart that fall on or
+// between from and to. COUNT is always counted from dtstart.
+func (r *Rule) Between(dtstart, from, to time.Time) []time.Time {
+	dtstart = truncate(dtstart)
+	from = truncate(from)
+	to = truncate(to)
+	if !r.Until.IsZero() && truncate(r.Until).Before(to) {
+		to = truncate(r.Until)
+	}
+
+	var occurrences []time.Time
+	count := 0
+	for d := dtstart; !d.After(to); d = d.AddDate(0, 0, 1) {
+		if !r.matches(dtstart, d) {
+			continue
+		}
+
+		count++
+		if r.Count > 0 && count > r.Count {
+			break
+		}
+		if !d.Before(from) {
+			occurrences = append(occurrences, d)
+			if len(occurrences) >= MaxOccurrences {
+				break
+			}
+		}
+	}
+
+	return occurrences
+}
+
+// matches reports whether day d is an occurrence of a rule starting at dtstart
+func (r *Rule) matches(dtstart, d time.Time) bool {
+	// Only every INTERVAL-th period takes part in the recurrence
+	var period int
+	switch r.Freq {
+	case Daily:
+		period = int(d.Sub(dtstart).Hours() / 24)
+	case Weekly:
+		period = int(weekStart(d).Sub(weekStart(dtstart)).Hours() / 24 / 7)
+	case Monthly:
+		period = (d.Year()-dtstart.Year())*12 + int(d.Month()) - int(dtstart.Month())
+	case Yearly:
+		period = d.Year() - dtstart.Year()
+	}
+	if period%r.Interval != 0 {
+		return false
+	}
+
+	if len(r.ByMonth) > 0 && !containsInt(r.ByMonth, int(d.Month())) {
+		return false
+	}
+	if len(r.ByMonthDay) > 0 && !matchesMonthDay(r.ByMonthDay, d) {
+		return false
+	}
+	if len(r.ByDay) > 0 && !r.matchesDay(d) {
+		return false
+	}
+
+	// Without BYxxx parts the rule repeats on the same day as dtstart
+	switch r.Freq {
+	case Weekly:
+		if len(r.ByDay) == 0 {
+			return d.Weekday() == dtstart.Weekday()
+		}
+	case Monthly:
+		if len(r.ByDay) == 0 && len(r.ByMonthDay) == 0 {
+			return d.Day() == dtstart.Day()
+		}
+	case Yearly:
+		if len(r.ByDay) == 0 && len(r.ByMonthDay) == 0 {
+			if len(r.ByMonth) == 0 && d.Month() != dtstart.Month() {
+				return false
+			}
+			return d.Day() == dtstart.Day()
+		}
+	}
+
+	return true
+}
+
+// matchesDay checks BYDAY, where a number picks the nth weekday of the month (or of
+// the year for YEARLY rules without BYMONTH)
+func (r *Rule) matchesDay(d time.Time) bool {
+	for _, wd := range r.ByDay {
+		if wd.Weekday != d.Weekday() {
+			continue
+		}
+		if wd.N == 0 {
+			return true
+		}
+
+		var first, last time.Time
+		if r.Freq == Yearly && len(r.ByMonth) == 0 {
+			first = time.Date(d.Year(), time.January, 1, 0, 0, 0, 0, time.UTC)
+			last = first.AddDate(1, 0, -1)
+		} else {
+			first = time.Date(d.Year(), d.Month(), 1, 0, 0, 0, 0, time.UTC)
+			last = first.AddDate(0, 1, -1)
+		}
+
+		nth := int(d.Sub(first).Hours()/24)/7 + 1
+		nthLast := -(int(last.Sub(d).Hours()/24)/7 + 1)
+		if wd.N == nth || wd.N == nthLast {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesMonthDay(days []int, d time.Time) bool {
+	last := time.Date(d.Year(), d.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	for _, day := range days {
+		if day == d.Day() || (day < 0 && last+day+1 == d.Day()) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseWeekdayNum(value string) (WeekdayNum, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	if len(value) < 2 {
+		return WeekdayNum{}, fmt.Errorf("%w: invalid BYDAY %q", ErrInvalidRule, value)
+	}
+
+	day, ok := weekdays[value[len(value)-2:]]
+	if !ok {
+		return WeekdayNum{}, fmt.Errorf("%w: invalid BYDAY %q", ErrInvalidRule, value)
+	}
+
+	wd := WeekdayNum{Weekday: day}
+	if prefix := value[:len(value)-2]; prefix != "" {
+		n, err := strconv.Atoi(prefix)
+		if err != nil || n == 0 || n < -53 || n > 53 {
+			return WeekdayNum{}, fmt.Errorf("%w: invalid BYDAY %q", ErrInvalidRule, value)
+		}
+		wd.N = n
+	}
+	return wd, nil
+}
+
+func parseUntil(value string) (time.Time, error) {
+	// UNTIL may be a DATE or a DATE-TIME, only the date part matters here
+	if len(value) > 8 {
+		value = value[:8]
+	}
+	return time.Parse("20060102", value)
+}
+
+func parseInts(value string, min, max int) ([]int, error) {
+	var ints []int
+	for _, s := range strings.Split(value, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil || n == 0 || n < min || n > max {
+			return nil, ErrInvalidRule
+		}
+		ints = append(ints, n)
+	}
+	return ints, nil
+}
+
+func joinInts(ints []int) string {
+	s := make([]string, len(ints))
+	for i, n := range ints {
+		s[i] = strconv.Itoa(n)
+	}
+	return strings.Join(s, ",")
+}
+
+func containsInt(ints []int, n int) bool {
+	for _, i := range ints {
+		if i == n {
+			return true
+		}
+	}
+	return false
+}
+
+// truncate drops the time of day and location so days can be compared safely
+func truncate(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// weekStart returns the Monday of the week containing d
+func weekStart(d time.Time) time.Time {
+	offset := (int(d.Weekday()) + 6) % 7
+	return d.AddDate(0, 0, -offset)
+}
@@ -0,0 +1,212 @@
+package rrule
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// date is midnight UTC of the given day, the form occurrences are returned in
+func date(value string) time.Time {
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{"empty", ""},
+		{"no FREQ", "BYDAY=MO"},
+		{"unsupported FREQ", "FREQ=HOURLY"},
+		{"malformed part", "FREQ=DAILY;COUNT"},
+		{"unknown part", "FREQ=DAILY;BYHOUR=9"},
+		{"zero COUNT", "FREQ=DAILY;COUNT=0"},
+		{"zero INTERVAL", "FREQ=DAILY;INTERVAL=0"},
+		{"bad UNTIL", "FREQ=DAILY;UNTIL=tomorrow"},
+		{"COUNT and UNTIL", "FREQ=DAILY;COUNT=2;UNTIL=20260101"},
+		{"numbered BYDAY in a weekly rule", "FREQ=WEEKLY;BYDAY=2MO"},
+		{"zero BYDAY number", "FREQ=MONTHLY;BYDAY=0MO"},
+		{"unknown weekday", "FREQ=WEEKLY;BYDAY=XX"},
+		{"BYMONTHDAY out of range", "FREQ=MONTHLY;BYMONTHDAY=32"},
+		{"zero BYMONTHDAY", "FREQ=MONTHLY;BYMONTHDAY=0"},
+		{"BYMONTH out of range", "FREQ=YEARLY;BYMONTH=13"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.value)
+			if !errors.Is(err, ErrInvalidRule) {
+				t.Errorf("Parse(%q) error = %v, want ErrInvalidRule", tt.value, err)
+			}
+		})
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"FREQ=DAILY", "FREQ=DAILY"},
+		{"RRULE:freq=weekly;byday=mo,we,fr;interval=1", "FREQ=WEEKLY;BYDAY=MO,WE,FR"},
+		{"FREQ=MONTHLY;INTERVAL=2;BYDAY=2TU,-1FR;UNTIL=20261215T235959Z", "FREQ=MONTHLY;INTERVAL=2;UNTIL=20261215;BYDAY=2TU,-1FR"},
+		{"FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=-1;COUNT=3;WKST=SU", "FREQ=YEARLY;COUNT=3;BYMONTHDAY=-1;BYMONTH=2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			r, err := Parse(tt.value)
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", tt.value, err)
+			}
+			if got := r.String(); got != tt.want {
+				t.Errorf("String() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBetween(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    string
+		dtstart string
+		from    string
+		to      string
+		want    []string
+	}{
+		{
+			name:    "daily with COUNT",
+			rule:    "FREQ=DAILY;COUNT=3",
+			dtstart: "2026-01-01", from: "2026-01-01", to: "2026-01-31",
+			want: []string{"2026-01-01", "2026-01-02", "2026-01-03"},
+		},
+		{
+			name:    "COUNT is counted from dtstart, not from the window",
+			rule:    "FREQ=DAILY;COUNT=5",
+			dtstart: "2026-01-01", from: "2026-01-04", to: "2026-01-31",
+			want: []string{"2026-01-04", "2026-01-05"},
+		},
+		{
+			name:    "UNTIL is inclusive",
+			rule:    "FREQ=DAILY;UNTIL=20261007",
+			dtstart: "2026-10-05", from: "2026-10-01", to: "2026-10-31",
+			want: []string{"2026-10-05", "2026-10-06", "2026-10-07"},
+		},
+		{
+			name:    "UNTIL as a date-time",
+			rule:    "FREQ=DAILY;UNTIL=20261006T230000Z",
+			dtstart: "2026-10-05", from: "2026-10-01", to: "2026-10-31",
+			want: []string{"2026-10-05", "2026-10-06"},
+		},
+		{
+			name:    "weekly on several days",
+			rule:    "FREQ=WEEKLY;BYDAY=MO,WE,FR",
+			dtstart: "2026-10-05", from: "2026-10-05", to: "2026-10-16",
+			want: []string{"2026-10-05", "2026-10-07", "2026-10-09", "2026-10-12", "2026-10-14", "2026-10-16"},
+		},
+		{
+			name:    "every other week on dtstart's weekday",
+			rule:    "FREQ=WEEKLY;INTERVAL=2",
+			dtstart: "2026-10-05", from: "2026-10-01", to: "2026-11-02",
+			want: []string{"2026-10-05", "2026-10-19", "2026-11-02"},
+		},
+		{
+			name:    "second Tuesday of the month",
+			rule:    "FREQ=MONTHLY;BYDAY=2TU",
+			dtstart: "2026-01-01", from: "2026-01-01", to: "2026-04-30",
+			want: []string{"2026-01-13", "2026-02-10", "2026-03-10", "2026-04-14"},
+		},
+		{
+			name:    "last Friday of the month",
+			rule:    "FREQ=MONTHLY;BYDAY=-1FR",
+			dtstart: "2026-01-01", from: "2026-01-01", to: "2026-04-30",
+			want: []string{"2026-01-30", "2026-02-27", "2026-03-27", "2026-04-24"},
+		},
+		{
+			name:    "last day of the month",
+			rule:    "FREQ=MONTHLY;BYMONTHDAY=-1",
+			dtstart: "2026-01-01", from: "2026-01-01", to: "2026-04-30",
+			want: []string{"2026-01-31", "2026-02-28", "2026-03-31", "2026-04-30"},
+		},
+		{
+			name:    "BYMONTHDAY=31 skips shorter months",
+			rule:    "FREQ=MONTHLY;BYMONTHDAY=31",
+			dtstart: "2026-01-01", from: "2026-01-01", to: "2026-05-31",
+			want: []string{"2026-01-31", "2026-03-31", "2026-05-31"},
+		},
+		{
+			name:    "monthly from the 31st skips shorter months",
+			rule:    "FREQ=MONTHLY",
+			dtstart: "2026-01-31", from: "2026-01-01", to: "2026-05-31",
+			want: []string{"2026-01-31", "2026-03-31", "2026-05-31"},
+		},
+		{
+			name:    "leap day only in leap years",
+			rule:    "FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=29",
+			dtstart: "2026-01-01", from: "2026-01-01", to: "2032-12-31",
+			want: []string{"2028-02-29", "2032-02-29"},
+		},
+		{
+			name:    "yearly on dtstart's date",
+			rule:    "FREQ=YEARLY;COUNT=2",
+			dtstart: "2026-10-18", from: "2026-01-01", to: "2030-12-31",
+			want: []string{"2026-10-18", "2027-10-18"},
+		},
+		{
+			name:    "nothing before dtstart",
+			rule:    "FREQ=DAILY",
+			dtstart: "2026-10-05", from: "2026-10-01", to: "2026-10-04",
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := Parse(tt.rule)
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", tt.rule, err)
+			}
+
+			got := r.Between(date(tt.dtstart), date(tt.from), date(tt.to))
+			if len(got) != len(tt.want) {
+				t.Fatalf("Between() = %v, want %v", got, tt.want)
+			}
+			for i, d := range got {
+				if !d.Equal(date(tt.want[i])) {
+					t.Errorf("occurrence %d = %s, want %s", i, d.Format("2006-01-02"), tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestBetweenIgnoresTimeOfDay(t *testing.T) {
+	r, err := Parse("FREQ=DAILY;COUNT=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loc := time.FixedZone("UTC+10", 10*60*60)
+	got := r.Between(time.Date(2026, 10, 5, 23, 30, 0, 0, loc), date("2026-10-01"), date("2026-10-31"))
+	if len(got) != 2 || !got[0].Equal(date("2026-10-05")) || !got[1].Equal(date("2026-10-06")) {
+		t.Errorf("Between() = %v, want 2026-10-05 and 2026-10-06", got)
+	}
+}
+
+func TestBetweenCapsOccurrences(t *testing.T) {
+	r, err := Parse("FREQ=DAILY")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := r.Between(date("2020-01-01"), date("2020-01-01"), date("2030-01-01"))
+	if len(got) != MaxOccurrences {
+		t.Errorf("len(Between()) = %d, want %d", len(got), MaxOccurrences)
+	}
+}
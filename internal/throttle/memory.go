@@ -0,0 +1,95 @@
+package throttle
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps the failure counts in memory. The counts are lost on restart
+// and are not shared between servers.
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]Entry
+}
+
+// NewMemoryStore returns an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]Entry)}
+}
+
+func (s *MemoryStore) Get(ctx context.Context, key string) (Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.entries[key], nil
+}
+
+func (s *MemoryStore) Add(ctx context.Context, key string, now time.Time, window time.Duration) (Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e := s.entries[key]
+	if now.Sub(e.LastFailure) >= window {
+		e.Failures = 0
+	}
+	e.Failures++
+	e.LastFailure = now
+	s.entries[key] = e
+
+	return e, nil
+}
+
+func (s *MemoryStore) Reserve(ctx context.Context, key string, now time.Time, p Policy) (Entry, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e := s.entries[key]
+	if p.Wait(e, now) > 0 {
+		return e, false, nil
+	}
+	if now.Sub(e.LastFailure) >= p.Window {
+		e.Failures = 0
+	}
+	e.Failures++
+	e.LastFailure = now
+	s.entries[key] = e
+	return e, true, nil
+}
+
+func (s *MemoryStore) Release(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[key]
+	if !ok {
+		return nil
+	}
+	e.Failures--
+	if e.Failures <= 0 {
+		delete(s.entries, key)
+		return nil
+	}
+	s.entries[key] = e
+	return nil
+}
+
+func (s *MemoryStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, key)
+	return nil
+}
+
+func (s *MemoryStore) Prune(ctx context.Context, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, e := range s.entries {
+		if e.LastFailure.Before(before) {
+			delete(s.entries, key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package throttle
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// PostgresStore keeps the failure counts in the login_attempts table, so every
+// server sees the same counts
+type PostgresStore struct {
+	DB *sql.DB
+}
+
+func (s *PostgresStore) Get(ctx context.Context, key string) (Entry, error) {
+	query := `
+        SELECT failures, last_failure
+        FROM login_attempts
+        WHERE key = $1`
+
+	var e Entry
+	err := s.DB.QueryRowContext(ctx, query, key).Scan(&e.Failures, &e.LastFailure)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Entry{}, nil
+		}
+		return Entry{}, err
+	}
+
+	return e, nil
+}
+
+func (s *PostgresStore) Add(ctx context.Context, key string, now time.Time, window time.Duration) (Entry, error) {
+	query := `
+        INSERT INTO login_attempts (key, failures, last_failure)
+        VALUES ($1, 1, $2)
+        ON CONFLICT (key) DO UPDATE
+        SET failures = CASE WHEN login_attempts.last_failure <= $3 THEN 1 ELSE login_attempts.failures + 1 END,
+            last_failure = $2
+        RETURNING failures, last_failure`
+
+	var e Entry
+	err := s.DB.QueryRowContext(ctx, query, key, now, now.Add(-window)).Scan(&e.Failures, &e.LastFailure)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	return e, nil
+}
+
+// Reserve decides and counts the attempt in one statement, so concurrent attempts are
+// counted one after the other. The conflict's WHERE is Policy.Wait written in SQL: a row
+// it rejects is left alone and nothing is returned.
+func (s *PostgresStore) Reserve(ctx context.Context, key string, now time.Time, p Policy) (Entry, bool, error) {
+	query := `
+        INSERT INTO login_attempts (key, failures, last_failure)
+        VALUES ($1, 1, $2)
+        ON CONFLICT (key) DO UPDATE
+        SET failures = CASE WHEN login_attempts.last_failure <= $3 THEN 1 ELSE login_attempts.failures + 1 END,
+            last_failure = $2
+        WHERE login_attempts.last_failure <= $3
+        OR login_attempts.failures <= $4::integer
+        OR login_attempts.last_failure + make_interval(secs => CASE
+            WHEN $5::integer > 0 AND login_attempts.failures >= $5::integer THEN $6::float8
+            ELSE LEAST($7::float8 * power(2, LEAST(login_attempts.failures - $4::integer - 1, 62)), $8::float8)
+        END) <= $2
+        RETURNING failures, last_failure`
+
+	var e Entry
+	err := s.DB.QueryRowContext(ctx, query, key, now, now.Add(-p.Window), p.FreeAttempts, p.LockoutAfter,
+		p.LockoutDuration.Seconds(), p.BaseDelay.Seconds(), p.MaxDelay.Seconds()).Scan(&e.Failures, &e.LastFailure)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			e, err = s.Get(ctx, key)
+			return e, false, err
+		}
+		return Entry{}, false, err
+	}
+
+	return e, true, nil
+}
+
+func (s *PostgresStore) Release(ctx context.Context, key string) error {
+	_, err := s.DB.ExecContext(ctx, `UPDATE login_attempts SET failures = failures - 1 WHERE key = $1 AND failures > 0`, key)
+	return err
+}
+
+func (s *PostgresStore) Reset(ctx context.Context, key string) error {
+	_, err := s.DB.ExecContext(ctx, `DELETE FROM login_attempts WHERE key = $1`, key)
+	return err
+}
+
+func (s *PostgresStore) Prune(ctx context.Context, before time.Time) error {
+	_, err := s.DB.ExecContext(ctx, `DELETE FROM login_attempts WHERE last_failure < $1`, before)
+	return err
+}
@@ -0,0 +1,132 @@
+// Package throttle slows down repeated failures, such as wrong passwords, with an
+// exponential backoff and a temporary lockout. The failure counts are kept in a
+// pluggable Store, in memory for a single server or in Postgres when several
+// servers need to share them.
+package throttle
+
+import (
+	"context"
+	"time"
+)
+
+// Entry is the failure count of a key
+type Entry struct {
+	Failures    int
+	LastFailure time.Time
+}
+
+// Store keeps the failure counts. Add and Reserve must be atomic, so that concurrent
+// failures are all counted and concurrent attempts can not all get past the policy.
+type Store interface {
+	// Get returns the entry of key, or a zero Entry when there is none
+	Get(ctx context.Context, key string) (Entry, error)
+	// Add records a failure at now. A count whose last failure is older than
+	// window starts again from one.
+	Add(ctx context.Context, key string, now time.Time, window time.Duration) (Entry, error)
+	// Reserve counts an attempt at now, before it is known to fail, when the policy
+	// allows one and returns the entry after it. When the policy makes key wait,
+	// nothing is counted and the entry is returned with false.
+	Reserve(ctx context.Context, key string, now time.Time, p Policy) (Entry, bool, error)
+	// Release takes back one attempt counted by Reserve, once it did not fail
+	Release(ctx context.Context, key string) error
+	// Reset forgets the failures of key
+	Reset(ctx context.Context, key string) error
+	// Prune deletes the entries whose last failure is before the cutoff
+	Prune(ctx context.Context, before time.Time) error
+}
+
+// Policy decides how long to wait after a number of failures
+type Policy struct {
+	// FreeAttempts is how many failures are allowed before any delay
+	FreeAttempts int
+	// BaseDelay is the first delay, it doubles with each failure after that
+	BaseDelay time.Duration
+	// MaxDelay caps the backoff
+	MaxDelay time.Duration
+	// LockoutAfter is the number of failures that locks the key
+	LockoutAfter int
+	// LockoutDuration is how long a locked key stays locked
+	LockoutDuration time.Duration
+	// Window is how long without failures before the count is forgotten.
+	// It should be longer than LockoutDuration.
+	Window time.Duration
+}
+
+// Locked reports whether the entry has reached the lockout
+func (p Policy) Locked(e Entry) bool {
+	return p.LockoutAfter > 0 && e.Failures >= p.LockoutAfter
+}
+
+// Wait returns how long after now the next attempt is allowed, or 0 if it is allowed now
+func (p Policy) Wait(e Entry, now time.Time) time.Duration {
+	if e.Failures <= p.FreeAttempts || now.Sub(e.LastFailure) >= p.Window {
+		return 0
+	}
+
+	var delay time.Duration
+	if p.Locked(e) {
+		delay = p.LockoutDuration
+	} else {
+		delay = p.BaseDelay
+		for i := p.FreeAttempts + 1; i < e.Failures && delay < p.MaxDelay; i++ {
+			delay *= 2
+		}
+		if delay > p.MaxDelay {
+			delay = p.MaxDelay
+		}
+	}
+
+	wait := e.LastFailure.Add(delay).Sub(now)
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
+
+// Limiter applies a policy to the keys of a store
+type Limiter struct {
+	Store  Store
+	Policy Policy
+}
+
+// Check returns how long the caller must wait before trying key again
+func (l *Limiter) Check(ctx context.Context, key string) (time.Duration, error) {
+	e, err := l.Store.Get(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	return l.Policy.Wait(e, time.Now()), nil
+}
+
+// Fail records a failure of key and returns its new entry
+func (l *Limiter) Fail(ctx context.Context, key string) (Entry, error) {
+	return l.Store.Add(ctx, key, time.Now(), l.Policy.Window)
+}
+
+// Reserve counts an attempt of key before it is made, so that concurrent attempts can not
+// all get past the backoff before any of them fails. It returns how long the caller must
+// wait when the attempt is not allowed, always more than 0, and the entry of key. An
+// attempt that turns out not to fail is taken back with Release or Reset.
+func (l *Limiter) Reserve(ctx context.Context, key string) (time.Duration, Entry, error) {
+	now := time.Now()
+	e, ok, err := l.Store.Reserve(ctx, key, now, l.Policy)
+	if err != nil {
+		return 0, Entry{}, err
+	}
+	if ok {
+		return 0, e, nil
+	}
+
+	// The entry may have been read after the wait ended, the attempt was refused anyway
+	return max(l.Policy.Wait(e, now), time.Second), e, nil
+}
+
+// Release takes back an attempt of key counted by Reserve that did not fail
+func (l *Limiter) Release(ctx context.Context, key string) error {
+	return l.Store.Release(ctx, key)
+}
+
+// Reset forgets the failures of key, e.g. after a successful login
+func (l *Limiter) Reset(ctx context.Context, key string) error {
+	return l.Store.Reset(ctx, key)
+}
@@ -0,0 +1,247 @@
+package throttle
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+var testPolicy = Policy{
+	FreeAttempts:    3,
+	BaseDelay:       time.Second,
+	MaxDelay:        8 * time.Second,
+	LockoutAfter:    10,
+	LockoutDuration: 15 * time.Minute,
+	Window:          time.Hour,
+}
+
+func TestPolicyWait(t *testing.T) {
+	last := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		failures int
+		since    time.Duration // time from the last failure to now
+		want     time.Duration
+	}{
+		{"no failures", 0, 0, 0},
+		{"free attempts", 3, 0, 0},
+		{"first delay", 4, 0, time.Second},
+		{"doubles", 5, 0, 2 * time.Second},
+		{"doubles again", 6, 0, 4 * time.Second},
+		{"reaches the cap", 7, 0, 8 * time.Second},
+		{"capped", 9, 0, 8 * time.Second},
+		{"locked out", 10, 0, 15 * time.Minute},
+		{"still locked out", 25, 0, 15 * time.Minute},
+		{"part of the delay has passed", 4, 400 * time.Millisecond, 600 * time.Millisecond},
+		{"delay has passed", 4, 2 * time.Second, 0},
+		{"lockout has passed", 10, 15 * time.Minute, 0},
+		{"count forgotten after the window", 10, time.Hour, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := Entry{Failures: tt.failures, LastFailure: last}
+			if got := testPolicy.Wait(e, last.Add(tt.since)); got != tt.want {
+				t.Errorf("Wait() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyLocked(t *testing.T) {
+	tests := []struct {
+		policy   Policy
+		failures int
+		want     bool
+	}{
+		{testPolicy, 9, false},
+		{testPolicy, 10, true},
+		{testPolicy, 11, true},
+		{Policy{}, 1000, false}, // no lockout configured
+	}
+
+	for _, tt := range tests {
+		if got := tt.policy.Locked(Entry{Failures: tt.failures}); got != tt.want {
+			t.Errorf("Locked(%d failures) = %t, want %t", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	start := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+
+	steps := []struct {
+		name string
+		do   func() (Entry, error)
+		want int
+	}{
+		{"first failure", func() (Entry, error) { return s.Add(ctx, "a", start, time.Hour) }, 1},
+		{"second failure", func() (Entry, error) { return s.Add(ctx, "a", start.Add(time.Minute), time.Hour) }, 2},
+		{"other keys are separate", func() (Entry, error) { return s.Add(ctx, "b", start, time.Hour) }, 1},
+		{"count restarts after the window", func() (Entry, error) { return s.Add(ctx, "a", start.Add(2*time.Hour), time.Hour) }, 1},
+		{"get", func() (Entry, error) { return s.Get(ctx, "a") }, 1},
+		{"reset", func() (Entry, error) {
+			if err := s.Reset(ctx, "a"); err != nil {
+				return Entry{}, err
+			}
+			return s.Get(ctx, "a")
+		}, 0},
+		{"prune old entries", func() (Entry, error) {
+			if err := s.Prune(ctx, start.Add(time.Second)); err != nil {
+				return Entry{}, err
+			}
+			return s.Get(ctx, "b")
+		}, 0},
+	}
+
+	for _, step := range steps {
+		e, err := step.do()
+		if err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if e.Failures != step.want {
+			t.Errorf("%s: failures = %d, want %d", step.name, e.Failures, step.want)
+		}
+	}
+}
+
+func TestMemoryStoreConcurrentAdds(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	now := time.Now()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.Add(ctx, "key", now, time.Hour)
+		}()
+	}
+	wg.Wait()
+
+	e, _ := s.Get(ctx, "key")
+	if e.Failures != 50 {
+		t.Errorf("failures = %d, want 50", e.Failures)
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	ctx := context.Background()
+	l := &Limiter{Store: NewMemoryStore(), Policy: Policy{
+		FreeAttempts: 2,
+		BaseDelay:    time.Minute,
+		MaxDelay:     time.Hour,
+		Window:       time.Hour,
+	}}
+
+	for i := 1; i <= 3; i++ {
+		wait, err := l.Check(ctx, "key")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if wait != 0 {
+			t.Fatalf("attempt %d has to wait %v", i, wait)
+		}
+		if _, err := l.Fail(ctx, "key"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	wait, err := l.Check(ctx, "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wait <= 0 || wait > time.Minute {
+		t.Errorf("wait after 3 failures = %v, want up to a minute", wait)
+	}
+
+	if err := l.Reset(ctx, "key"); err != nil {
+		t.Fatal(err)
+	}
+	if wait, _ := l.Check(ctx, "key"); wait != 0 {
+		t.Errorf("wait after reset = %v, want 0", wait)
+	}
+}
+
+func TestLimiterReserve(t *testing.T) {
+	ctx := context.Background()
+	l := &Limiter{Store: NewMemoryStore(), Policy: Policy{
+		FreeAttempts:    2,
+		BaseDelay:       time.Minute,
+		MaxDelay:        time.Hour,
+		LockoutAfter:    5,
+		LockoutDuration: time.Hour,
+		Window:          2 * time.Hour,
+	}}
+
+	for i := 1; i <= 3; i++ {
+		wait, e, err := l.Reserve(ctx, "key")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if wait != 0 || e.Failures != i {
+			t.Fatalf("attempt %d: wait %v, failures %d", i, wait, e.Failures)
+		}
+	}
+
+	// The third failure starts the backoff, and a refused attempt is not counted
+	wait, e, err := l.Reserve(ctx, "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wait <= 0 || wait > time.Minute || e.Failures != 3 {
+		t.Errorf("refused attempt: wait %v, failures %d", wait, e.Failures)
+	}
+
+	// A reserved attempt that did not fail is taken back
+	if err := l.Release(ctx, "key"); err != nil {
+		t.Fatal(err)
+	}
+	if e, _ := l.Store.Get(ctx, "key"); e.Failures != 2 {
+		t.Errorf("failures after release = %d, want 2", e.Failures)
+	}
+	if wait, _, _ := l.Reserve(ctx, "key"); wait != 0 {
+		t.Errorf("wait after release = %v, want 0", wait)
+	}
+}
+
+func TestLimiterReserveConcurrent(t *testing.T) {
+	ctx := context.Background()
+	l := &Limiter{Store: NewMemoryStore(), Policy: Policy{
+		FreeAttempts: 3,
+		BaseDelay:    time.Minute,
+		MaxDelay:     time.Hour,
+		Window:       time.Hour,
+	}}
+
+	// A burst of guesses gets the free attempts and one more, the rest have to wait
+	var mu sync.Mutex
+	allowed := 0
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			wait, _, err := l.Reserve(ctx, "key")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if wait == 0 {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if allowed != 4 {
+		t.Errorf("%d attempts allowed, want 4", allowed)
+	}
+}
@@ -0,0 +1,112 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA1 key of the RFC 6238 test vectors, "12345678901234567890", in base32
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCodeRFC6238Vectors(t *testing.T) {
+	// The RFC lists 8 digit codes, a 6 digit code is their last six digits
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		step := Step(time.Unix(tt.unix, 0))
+		got, err := Code(rfcSecret, step)
+		if err != nil {
+			t.Fatalf("Code(%d) error = %v", tt.unix, err)
+		}
+		if got != tt.want {
+			t.Errorf("Code at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestCodeInvalidSecret(t *testing.T) {
+	_, err := Code("not base32!", 1)
+	if err == nil {
+		t.Error("Code() with an invalid secret did not fail")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := Step(now)
+	codeAt := func(s int64) string {
+		code, err := Code(rfcSecret, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code
+	}
+
+	tests := []struct {
+		name     string
+		secret   string
+		code     string
+		want     bool
+		wantStep int64
+	}{
+		{"current step", rfcSecret, codeAt(step), true, step},
+		{"previous step", rfcSecret, codeAt(step - 1), true, step - 1},
+		{"next step", rfcSecret, codeAt(step + 1), true, step + 1},
+		{"two steps old", rfcSecret, codeAt(step - 2), false, 0},
+		{"two steps ahead", rfcSecret, codeAt(step + 2), false, 0},
+		{"spaces are ignored", rfcSecret, " " + codeAt(step)[:3] + " " + codeAt(step)[3:] + " ", true, step},
+		{"lower case secret", "gezdgnbvgy3tqojqgezdgnbvgy3tqojq", codeAt(step), true, step},
+		{"too short", rfcSecret, codeAt(step)[:5], false, 0},
+		{"too long", rfcSecret, codeAt(step) + "0", false, 0},
+		{"invalid secret", "not base32!", codeAt(step), false, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotStep, ok := Validate(tt.secret, tt.code, now)
+			if ok != tt.want || gotStep != tt.wantStep {
+				t.Errorf("Validate(%q) = %d, %t, want %d, %t", tt.code, gotStep, ok, tt.wantStep, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	a, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a == b {
+		t.Error("two secrets are the same")
+	}
+	key, err := encoding.DecodeString(a)
+	if err != nil || len(key) != 20 {
+		t.Errorf("secret %q decodes to %d bytes, %v", a, len(key), err)
+	}
+	if _, err := Code(a, 1); err != nil {
+		t.Errorf("Code() with a generated secret error = %v", err)
+	}
+}
+
+func TestURI(t *testing.T) {
+	got := URI("ABC", "Study Helper", "k@example.com")
+	want := "otpauth://totp/Study%20Helper:k@example.com?algorithm=SHA1&digits=6&issuer=Study%20Helper&period=30&secret=ABC"
+	if got != want {
+		t.Errorf("URI() = %q, want %q", got, want)
+	}
+}
@@ -69,3 +69,8 @@ func HasUpper(value string) bool {
 func HasSymbol(value string) bool {
 	return regexp.MustCompile(`[!@#\$%\^&\*\(\)_\+\-=\[\]{};':"\\|,.<>\/?]`).MatchString(value)
 }
+
+// Checks if an integer falls within the inclusive range min..max
+func Between(value int, min int, max int) bool {
+	return value >= min && value <= max
+}
@@ -1,4 +1,6 @@
 -- Filename: migrations/000001_create_users_table.up.sql
+CREATE EXTENSION IF NOT EXISTS citext;
+
 CREATE TABLE IF NOT EXISTS users (
   user_id bigserial PRIMARY KEY,
   name text NOT NULL,
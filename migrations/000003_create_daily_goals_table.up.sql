@@ -1,5 +1,5 @@
 -- Filename: migrations/000003_create_daily_goals_table.up.sql
-CREATE TABLE daily_goals (
+CREATE TABLE IF NOT EXISTS daily_goals (
 goal_id bigserial PRIMARY KEY,
 user_id integer NOT NULL,
 goal_text varchar NOT NULL,
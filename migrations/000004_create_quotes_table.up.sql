@@ -1,5 +1,5 @@
 -- Filename: migrations/000004_create_quotes_table.up.sql
-CREATE TABLE quotes(
+CREATE TABLE IF NOT EXISTS quotes (
 quote_id bigserial PRIMARY KEY,
 user_id integer NOT NULL,
 content text NOT NULL,
@@ -0,0 +1,3 @@
+-- Filename: migrations/000005_create_session_intervals_table.down.sql
+DROP TABLE IF EXISTS session_intervals;
+ALTER TABLE study_sessions DROP COLUMN IF EXISTS stopped_at;
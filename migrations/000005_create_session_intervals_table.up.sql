@@ -0,0 +1,13 @@
+-- Filename: migrations/000005_create_session_intervals_table.up.sql
+ALTER TABLE study_sessions ADD COLUMN IF NOT EXISTS stopped_at timestamp(0) WITH TIME ZONE;
+
+CREATE TABLE IF NOT EXISTS session_intervals (
+interval_id bigserial PRIMARY KEY,
+session_id bigint NOT NULL REFERENCES study_sessions (session_id) ON DELETE CASCADE,
+start_action text NOT NULL CHECK (start_action IN ('start', 'resume')),
+started_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+end_action text CHECK (end_action IN ('pause', 'stop')),
+ended_at timestamp(0) WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS session_intervals_session_id_idx ON session_intervals (session_id);
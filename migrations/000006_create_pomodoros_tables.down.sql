@@ -0,0 +1,3 @@
+-- Filename: migrations/000006_create_pomodoros_tables.down.sql
+DROP TABLE IF EXISTS pomodoros;
+DROP TABLE IF EXISTS session_pomodoros;
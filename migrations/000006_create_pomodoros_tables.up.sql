@@ -0,0 +1,23 @@
+-- Filename: migrations/000006_create_pomodoros_tables.up.sql
+CREATE TABLE IF NOT EXISTS session_pomodoros (
+session_id bigint PRIMARY KEY REFERENCES study_sessions (session_id) ON DELETE CASCADE,
+work_minutes integer NOT NULL,
+short_break_minutes integer NOT NULL,
+long_break_minutes integer NOT NULL,
+cycles_before_long_break integer NOT NULL,
+phase text NOT NULL DEFAULT 'work' CHECK (phase IN ('work', 'short_break', 'long_break')),
+cycle integer NOT NULL DEFAULT 1,
+phase_started_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS pomodoros (
+pomodoro_id bigserial PRIMARY KEY,
+session_id bigint NOT NULL REFERENCES study_sessions (session_id) ON DELETE CASCADE,
+cycle integer NOT NULL,
+work_minutes integer NOT NULL,
+started_at timestamp(0) WITH TIME ZONE NOT NULL,
+completed_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS pomodoros_session_id_idx ON pomodoros (session_id);
@@ -0,0 +1,3 @@
+-- Filename: migrations/000007_add_session_recurrence.down.sql
+DROP TABLE IF EXISTS session_exceptions;
+ALTER TABLE study_sessions DROP COLUMN IF EXISTS rrule;
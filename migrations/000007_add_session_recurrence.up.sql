@@ -0,0 +1,15 @@
+-- Filename: migrations/000007_add_session_recurrence.up.sql
+ALTER TABLE study_sessions ADD COLUMN IF NOT EXISTS rrule text NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS session_exceptions (
+session_id bigint NOT NULL REFERENCES study_sessions (session_id) ON DELETE CASCADE,
+occurrence_date DATE NOT NULL,
+is_cancelled boolean NOT NULL DEFAULT 'false',
+title text,
+description text,
+subject text,
+start_date DATE,
+end_date DATE,
+is_completed boolean,
+PRIMARY KEY (session_id, occurrence_date)
+);
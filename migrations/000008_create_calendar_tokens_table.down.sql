@@ -0,0 +1,2 @@
+-- Filename: migrations/000008_create_calendar_tokens_table.down.sql
+DROP TABLE IF EXISTS calendar_tokens;
@@ -0,0 +1,6 @@
+-- Filename: migrations/000008_create_calendar_tokens_table.up.sql
+CREATE TABLE IF NOT EXISTS calendar_tokens (
+user_id bigint PRIMARY KEY REFERENCES users (user_id) ON DELETE CASCADE,
+token_hash bytea UNIQUE NOT NULL,
+created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,5 @@
+-- Filename: migrations/000009_add_ical_uids.down.sql
+DROP INDEX IF EXISTS daily_goals_user_id_ical_uid_idx;
+DROP INDEX IF EXISTS study_sessions_user_id_ical_uid_idx;
+ALTER TABLE daily_goals DROP COLUMN IF EXISTS ical_uid;
+ALTER TABLE study_sessions DROP COLUMN IF EXISTS ical_uid;
@@ -0,0 +1,6 @@
+-- Filename: migrations/000009_add_ical_uids.up.sql
+ALTER TABLE study_sessions ADD COLUMN IF NOT EXISTS ical_uid text NOT NULL DEFAULT '';
+ALTER TABLE daily_goals ADD COLUMN IF NOT EXISTS ical_uid text NOT NULL DEFAULT '';
+
+CREATE UNIQUE INDEX IF NOT EXISTS study_sessions_user_id_ical_uid_idx ON study_sessions (user_id, ical_uid) WHERE ical_uid <> '';
+CREATE UNIQUE INDEX IF NOT EXISTS daily_goals_user_id_ical_uid_idx ON daily_goals (user_id, ical_uid) WHERE ical_uid <> '';
@@ -0,0 +1,2 @@
+-- Filename: migrations/000010_create_tokens_table.down.sql
+DROP TABLE IF EXISTS tokens;
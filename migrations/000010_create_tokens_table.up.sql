@@ -0,0 +1,12 @@
+-- Filename: migrations/000010_create_tokens_table.up.sql
+CREATE TABLE IF NOT EXISTS tokens (
+token_id bigserial PRIMARY KEY,
+user_id bigint NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+name text NOT NULL,
+token_hash bytea UNIQUE NOT NULL,
+scopes text[] NOT NULL,
+last_used_at timestamp(0) WITH TIME ZONE,
+created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS tokens_user_id_idx ON tokens (user_id);
@@ -0,0 +1,2 @@
+-- Filename: migrations/000011_create_user_tokens_table.down.sql
+DROP TABLE IF EXISTS user_tokens;
@@ -0,0 +1,9 @@
+-- Filename: migrations/000011_create_user_tokens_table.up.sql
+CREATE TABLE IF NOT EXISTS user_tokens (
+token_hash bytea PRIMARY KEY,
+user_id bigint NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+scope text NOT NULL,
+expiry timestamp(0) WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS user_tokens_user_id_scope_idx ON user_tokens (user_id, scope);
@@ -0,0 +1,2 @@
+-- Filename: migrations/000012_add_users_session_version.down.sql
+ALTER TABLE users DROP COLUMN IF EXISTS session_version;
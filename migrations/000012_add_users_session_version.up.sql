@@ -0,0 +1,2 @@
+-- Filename: migrations/000012_add_users_session_version.up.sql
+ALTER TABLE users ADD COLUMN IF NOT EXISTS session_version integer NOT NULL DEFAULT 1;
@@ -0,0 +1,13 @@
+-- Filename: migrations/000013_add_two_factor.up.sql
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_secret text NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_enabled bool NOT NULL DEFAULT FALSE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_last_step bigint NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+code_id bigserial PRIMARY KEY,
+user_id bigint NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+code_hash bytea NOT NULL,
+used_at timestamp(0) WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS recovery_codes_user_id_idx ON recovery_codes (user_id);
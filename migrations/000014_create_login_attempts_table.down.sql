@@ -0,0 +1,2 @@
+-- Filename: migrations/000014_create_login_attempts_table.down.sql
+DROP TABLE IF EXISTS login_attempts;
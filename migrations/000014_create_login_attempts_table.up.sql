@@ -0,0 +1,8 @@
+-- Filename: migrations/000014_create_login_attempts_table.up.sql
+CREATE TABLE IF NOT EXISTS login_attempts (
+key text PRIMARY KEY,
+failures integer NOT NULL DEFAULT 0,
+last_failure timestamp(0) WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS login_attempts_last_failure_idx ON login_attempts (last_failure);
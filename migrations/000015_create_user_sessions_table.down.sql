@@ -0,0 +1,2 @@
+-- Filename: migrations/000015_create_user_sessions_table.down.sql
+DROP TABLE IF EXISTS user_sessions;
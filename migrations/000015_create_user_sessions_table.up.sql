@@ -0,0 +1,13 @@
+-- Filename: migrations/000015_create_user_sessions_table.up.sql
+CREATE TABLE IF NOT EXISTS user_sessions (
+session_id bigserial PRIMARY KEY,
+user_id bigint NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+token_hash bytea UNIQUE NOT NULL,
+user_agent text NOT NULL DEFAULT '',
+ip text NOT NULL DEFAULT '',
+created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+last_seen_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+expiry timestamp(0) WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS user_sessions_user_id_idx ON user_sessions (user_id);
@@ -0,0 +1,2 @@
+-- Filename: migrations/000016_add_users_pending_email.down.sql
+ALTER TABLE users DROP COLUMN IF EXISTS pending_email;
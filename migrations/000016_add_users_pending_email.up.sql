@@ -0,0 +1,2 @@
+-- Filename: migrations/000016_add_users_pending_email.up.sql
+ALTER TABLE users ADD COLUMN IF NOT EXISTS pending_email citext NOT NULL DEFAULT '';
@@ -0,0 +1,3 @@
+-- Filename: migrations/000017_repair_orphaned_rows.down.sql
+-- The removed rows cannot be brought back, there is nothing to undo
+SELECT 1;
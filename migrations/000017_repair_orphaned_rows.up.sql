@@ -0,0 +1,9 @@
+-- Filename: migrations/000017_repair_orphaned_rows.up.sql
+-- Rows of users that no longer exist can never be shown to anyone, so they are
+-- removed before foreign keys are added
+DELETE FROM study_sessions s WHERE NOT EXISTS (SELECT 1 FROM users u WHERE u.user_id = s.user_id);
+DELETE FROM daily_goals g WHERE NOT EXISTS (SELECT 1 FROM users u WHERE u.user_id = g.user_id);
+DELETE FROM quotes q WHERE NOT EXISTS (SELECT 1 FROM users u WHERE u.user_id = q.user_id);
+
+-- Sessions saved with the dates the wrong way round are swapped, so the dates check can be added
+UPDATE study_sessions SET start_date = end_date, end_date = start_date WHERE end_date < start_date;
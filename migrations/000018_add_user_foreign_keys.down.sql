@@ -0,0 +1,10 @@
+-- Filename: migrations/000018_add_user_foreign_keys.down.sql
+ALTER TABLE study_sessions DROP CONSTRAINT IF EXISTS study_sessions_dates_check;
+
+ALTER TABLE study_sessions DROP CONSTRAINT IF EXISTS study_sessions_user_id_fkey;
+ALTER TABLE daily_goals DROP CONSTRAINT IF EXISTS daily_goals_user_id_fkey;
+ALTER TABLE quotes DROP CONSTRAINT IF EXISTS quotes_user_id_fkey;
+
+ALTER TABLE study_sessions ALTER COLUMN user_id TYPE integer;
+ALTER TABLE daily_goals ALTER COLUMN user_id TYPE integer;
+ALTER TABLE quotes ALTER COLUMN user_id TYPE integer;
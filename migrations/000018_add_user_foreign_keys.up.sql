@@ -0,0 +1,20 @@
+-- Filename: migrations/000018_add_user_foreign_keys.up.sql
+-- users.user_id is a bigserial, so the columns pointing at it are bigint too
+ALTER TABLE study_sessions ALTER COLUMN user_id TYPE bigint;
+ALTER TABLE daily_goals ALTER COLUMN user_id TYPE bigint;
+ALTER TABLE quotes ALTER COLUMN user_id TYPE bigint;
+
+ALTER TABLE study_sessions DROP CONSTRAINT IF EXISTS study_sessions_user_id_fkey;
+ALTER TABLE study_sessions ADD CONSTRAINT study_sessions_user_id_fkey
+FOREIGN KEY (user_id) REFERENCES users (user_id) ON DELETE CASCADE;
+
+ALTER TABLE daily_goals DROP CONSTRAINT IF EXISTS daily_goals_user_id_fkey;
+ALTER TABLE daily_goals ADD CONSTRAINT daily_goals_user_id_fkey
+FOREIGN KEY (user_id) REFERENCES users (user_id) ON DELETE CASCADE;
+
+ALTER TABLE quotes DROP CONSTRAINT IF EXISTS quotes_user_id_fkey;
+ALTER TABLE quotes ADD CONSTRAINT quotes_user_id_fkey
+FOREIGN KEY (user_id) REFERENCES users (user_id) ON DELETE CASCADE;
+
+ALTER TABLE study_sessions DROP CONSTRAINT IF EXISTS study_sessions_dates_check;
+ALTER TABLE study_sessions ADD CONSTRAINT study_sessions_dates_check CHECK (end_date >= start_date);
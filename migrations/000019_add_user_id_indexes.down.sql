@@ -0,0 +1,4 @@
+-- Filename: migrations/000019_add_user_id_indexes.down.sql
+DROP INDEX IF EXISTS study_sessions_user_id_created_at_idx;
+DROP INDEX IF EXISTS daily_goals_user_id_created_at_idx;
+DROP INDEX IF EXISTS quotes_user_id_created_at_idx;
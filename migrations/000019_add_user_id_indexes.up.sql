@@ -0,0 +1,5 @@
+-- Filename: migrations/000019_add_user_id_indexes.up.sql
+-- Match the list pages, which show a user's rows newest first
+CREATE INDEX IF NOT EXISTS study_sessions_user_id_created_at_idx ON study_sessions (user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS daily_goals_user_id_created_at_idx ON daily_goals (user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS quotes_user_id_created_at_idx ON quotes (user_id, created_at DESC);
@@ -0,0 +1,16 @@
+-- Filename: migrations/000020_add_search_vectors.down.sql
+DROP TRIGGER IF EXISTS daily_goals_search_vector_trigger ON daily_goals;
+DROP TRIGGER IF EXISTS study_sessions_search_vector_trigger ON study_sessions;
+DROP TRIGGER IF EXISTS quotes_search_vector_trigger ON quotes;
+
+DROP FUNCTION IF EXISTS daily_goals_search_vector();
+DROP FUNCTION IF EXISTS study_sessions_search_vector();
+DROP FUNCTION IF EXISTS quotes_search_vector();
+
+DROP INDEX IF EXISTS daily_goals_search_vector_idx;
+DROP INDEX IF EXISTS study_sessions_search_vector_idx;
+DROP INDEX IF EXISTS quotes_search_vector_idx;
+
+ALTER TABLE daily_goals DROP COLUMN IF EXISTS search_vector;
+ALTER TABLE study_sessions DROP COLUMN IF EXISTS search_vector;
+ALTER TABLE quotes DROP COLUMN IF EXISTS search_vector;
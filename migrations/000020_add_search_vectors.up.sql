@@ -0,0 +1,54 @@
+-- Filename: migrations/000020_add_search_vectors.up.sql
+-- Full-text search columns, kept up to date by triggers whenever the searched text changes
+ALTER TABLE daily_goals ADD COLUMN IF NOT EXISTS search_vector tsvector;
+ALTER TABLE study_sessions ADD COLUMN IF NOT EXISTS search_vector tsvector;
+ALTER TABLE quotes ADD COLUMN IF NOT EXISTS search_vector tsvector;
+
+CREATE OR REPLACE FUNCTION daily_goals_search_vector() RETURNS trigger AS $$
+BEGIN
+    NEW.search_vector := to_tsvector('english', coalesce(NEW.goal_text, ''));
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+-- A session's title counts for more than its subject, and its subject for more than its description
+CREATE OR REPLACE FUNCTION study_sessions_search_vector() RETURNS trigger AS $$
+BEGIN
+    NEW.search_vector :=
+        setweight(to_tsvector('english', coalesce(NEW.title, '')), 'A') ||
+        setweight(to_tsvector('english', coalesce(NEW.subject, '')), 'B') ||
+        setweight(to_tsvector('english', coalesce(NEW.description, '')), 'C');
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION quotes_search_vector() RETURNS trigger AS $$
+BEGIN
+    NEW.search_vector := to_tsvector('english', coalesce(NEW.content, ''));
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS daily_goals_search_vector_trigger ON daily_goals;
+CREATE TRIGGER daily_goals_search_vector_trigger
+    BEFORE INSERT OR UPDATE OF goal_text ON daily_goals
+    FOR EACH ROW EXECUTE FUNCTION daily_goals_search_vector();
+
+DROP TRIGGER IF EXISTS study_sessions_search_vector_trigger ON study_sessions;
+CREATE TRIGGER study_sessions_search_vector_trigger
+    BEFORE INSERT OR UPDATE OF title, subject, description ON study_sessions
+    FOR EACH ROW EXECUTE FUNCTION study_sessions_search_vector();
+
+DROP TRIGGER IF EXISTS quotes_search_vector_trigger ON quotes;
+CREATE TRIGGER quotes_search_vector_trigger
+    BEFORE INSERT OR UPDATE OF content ON quotes
+    FOR EACH ROW EXECUTE FUNCTION quotes_search_vector();
+
+-- Fill in the rows saved before search existed, which fires the triggers
+UPDATE daily_goals SET goal_text = goal_text;
+UPDATE study_sessions SET title = title;
+UPDATE quotes SET content = content;
+
+CREATE INDEX IF NOT EXISTS daily_goals_search_vector_idx ON daily_goals USING GIN (search_vector);
+CREATE INDEX IF NOT EXISTS study_sessions_search_vector_idx ON study_sessions USING GIN (search_vector);
+CREATE INDEX IF NOT EXISTS quotes_search_vector_idx ON quotes USING GIN (search_vector);
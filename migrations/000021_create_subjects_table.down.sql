@@ -0,0 +1,28 @@
+-- Filename: migrations/000021_create_subjects_table.down.sql
+DROP TRIGGER IF EXISTS subjects_rename_search_vector_trigger ON subjects;
+DROP FUNCTION IF EXISTS subjects_rename_search_vector();
+DROP TRIGGER IF EXISTS study_sessions_search_vector_trigger ON study_sessions;
+
+ALTER TABLE study_sessions ADD COLUMN IF NOT EXISTS subject text;
+ALTER TABLE session_exceptions ADD COLUMN IF NOT EXISTS subject text;
+
+UPDATE study_sessions s SET subject = sub.name FROM subjects sub WHERE sub.subject_id = s.subject_id;
+UPDATE session_exceptions e SET subject = sub.name FROM subjects sub WHERE sub.subject_id = e.subject_id;
+
+ALTER TABLE session_exceptions DROP COLUMN IF EXISTS subject_id;
+ALTER TABLE study_sessions DROP COLUMN IF EXISTS subject_id;
+DROP TABLE IF EXISTS subjects;
+
+CREATE OR REPLACE FUNCTION study_sessions_search_vector() RETURNS trigger AS $$
+BEGIN
+    NEW.search_vector :=
+        setweight(to_tsvector('english', coalesce(NEW.title, '')), 'A') ||
+        setweight(to_tsvector('english', coalesce(NEW.subject, '')), 'B') ||
+        setweight(to_tsvector('english', coalesce(NEW.description, '')), 'C');
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER study_sessions_search_vector_trigger
+    BEFORE INSERT OR UPDATE OF title, subject, description ON study_sessions
+    FOR EACH ROW EXECUTE FUNCTION study_sessions_search_vector();
@@ -0,0 +1,114 @@
+-- Filename: migrations/000021_create_subjects_table.up.sql
+-- Subjects become rows of their own, so sessions point at one subject instead of repeating its name
+CREATE TABLE IF NOT EXISTS subjects (
+subject_id bigserial PRIMARY KEY,
+user_id bigint NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+name citext NOT NULL,
+colour text NOT NULL DEFAULT '#5c2d91',
+weekly_target_hours numeric(4, 1) NOT NULL DEFAULT 0,
+created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+CONSTRAINT subjects_user_id_name_key UNIQUE (user_id, name),
+CONSTRAINT subjects_weekly_target_hours_check CHECK (weekly_target_hours BETWEEN 0 AND 168)
+);
+
+-- Every spelling of a subject used by a session or an edited occurrence. Spellings that only
+-- differ in case or surrounding spaces are the same subject, and a plural such as "Maths"
+-- joins "Math" when the user also used the singular. Each subject is named after its most
+-- used spelling.
+CREATE TEMPORARY TABLE subject_spellings ON COMMIT DROP AS
+WITH used AS (
+    SELECT user_id, btrim(subject) AS name, created_at
+    FROM study_sessions
+    WHERE btrim(subject) <> ''
+    UNION ALL
+    SELECT s.user_id, btrim(e.subject), s.created_at
+    FROM session_exceptions e
+    JOIN study_sessions s ON s.session_id = e.session_id
+    WHERE btrim(e.subject) <> ''
+),
+spellings AS (
+    SELECT user_id, name, lower(name) AS key, COUNT(*) AS uses, MIN(created_at) AS first_used
+    FROM used
+    GROUP BY user_id, name
+),
+grouped AS (
+    SELECT sp.*,
+        CASE WHEN sp.key LIKE '%s' AND EXISTS (
+            SELECT 1 FROM spellings o WHERE o.user_id = sp.user_id AND o.key = left(sp.key, -1)
+        ) THEN left(sp.key, -1) ELSE sp.key END AS canonical
+    FROM spellings sp
+)
+SELECT user_id, name,
+    first_value(name) OVER (PARTITION BY user_id, canonical ORDER BY uses DESC, first_used, name) AS chosen
+FROM grouped;
+
+INSERT INTO subjects (user_id, name)
+SELECT DISTINCT user_id, chosen FROM subject_spellings
+ON CONFLICT DO NOTHING;
+
+-- Sessions saved without a subject are put under General
+INSERT INTO subjects (user_id, name)
+SELECT DISTINCT user_id, 'General' FROM study_sessions
+WHERE subject IS NULL OR btrim(subject) = ''
+ON CONFLICT DO NOTHING;
+
+-- A subject can not be deleted while sessions use it. The check waits for the end of the
+-- statement, so deleting a user still removes their sessions and subjects together.
+ALTER TABLE study_sessions ADD COLUMN IF NOT EXISTS subject_id bigint REFERENCES subjects (subject_id);
+ALTER TABLE session_exceptions ADD COLUMN IF NOT EXISTS subject_id bigint REFERENCES subjects (subject_id) ON DELETE SET NULL;
+
+UPDATE study_sessions s
+SET subject_id = sub.subject_id
+FROM subject_spellings sp
+JOIN subjects sub ON sub.user_id = sp.user_id AND sub.name = sp.chosen::citext
+WHERE sp.user_id = s.user_id AND sp.name = btrim(s.subject);
+
+UPDATE study_sessions s
+SET subject_id = sub.subject_id
+FROM subjects sub
+WHERE s.subject_id IS NULL AND sub.user_id = s.user_id AND sub.name = 'General';
+
+UPDATE session_exceptions e
+SET subject_id = sub.subject_id
+FROM study_sessions s, subject_spellings sp, subjects sub
+WHERE s.session_id = e.session_id
+AND sp.user_id = s.user_id AND sp.name = btrim(e.subject)
+AND sub.user_id = sp.user_id AND sub.name = sp.chosen::citext;
+
+ALTER TABLE study_sessions ALTER COLUMN subject_id SET NOT NULL;
+CREATE INDEX IF NOT EXISTS study_sessions_subject_id_idx ON study_sessions (subject_id);
+
+-- The search trigger watched the old column, so it is rebuilt to read the subject's name
+DROP TRIGGER IF EXISTS study_sessions_search_vector_trigger ON study_sessions;
+
+ALTER TABLE study_sessions DROP COLUMN IF EXISTS subject;
+ALTER TABLE session_exceptions DROP COLUMN IF EXISTS subject;
+
+CREATE OR REPLACE FUNCTION study_sessions_search_vector() RETURNS trigger AS $$
+BEGIN
+    NEW.search_vector :=
+        setweight(to_tsvector('english', coalesce(NEW.title, '')), 'A') ||
+        setweight(to_tsvector('english', coalesce((SELECT name FROM subjects WHERE subject_id = NEW.subject_id), '')), 'B') ||
+        setweight(to_tsvector('english', coalesce(NEW.description, '')), 'C');
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER study_sessions_search_vector_trigger
+    BEFORE INSERT OR UPDATE OF title, subject_id, description ON study_sessions
+    FOR EACH ROW EXECUTE FUNCTION study_sessions_search_vector();
+
+-- Renaming a subject changes what its sessions can be found by
+CREATE OR REPLACE FUNCTION subjects_rename_search_vector() RETURNS trigger AS $$
+BEGIN
+    UPDATE study_sessions SET subject_id = subject_id WHERE subject_id = NEW.subject_id;
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS subjects_rename_search_vector_trigger ON subjects;
+CREATE TRIGGER subjects_rename_search_vector_trigger
+    AFTER UPDATE OF name ON subjects
+    FOR EACH ROW EXECUTE FUNCTION subjects_rename_search_vector();
+
+UPDATE study_sessions SET subject_id = subject_id;
@@ -0,0 +1,10 @@
+-- Filename: migrations/000022_add_streaks.down.sql
+DROP TRIGGER IF EXISTS study_sessions_completed_at_trigger ON study_sessions;
+DROP TRIGGER IF EXISTS daily_goals_completed_at_trigger ON daily_goals;
+DROP FUNCTION IF EXISTS set_completed_at();
+
+ALTER TABLE study_sessions DROP COLUMN IF EXISTS completed_at;
+ALTER TABLE daily_goals DROP COLUMN IF EXISTS completed_at;
+
+ALTER TABLE users DROP COLUMN IF EXISTS streak_freezes;
+ALTER TABLE users DROP COLUMN IF EXISTS timezone;
@@ -0,0 +1,33 @@
+-- Filename: migrations/000022_add_streaks.up.sql
+-- Streak days follow the user's own calendar, and freezes are something the user opts into
+ALTER TABLE users ADD COLUMN IF NOT EXISTS timezone text NOT NULL DEFAULT 'UTC';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS streak_freezes boolean NOT NULL DEFAULT FALSE;
+
+-- When a goal or session was ticked off. Rows completed before this column existed keep
+-- it empty, and count on their target or end date instead.
+ALTER TABLE daily_goals ADD COLUMN IF NOT EXISTS completed_at timestamp(0) WITH TIME ZONE;
+ALTER TABLE study_sessions ADD COLUMN IF NOT EXISTS completed_at timestamp(0) WITH TIME ZONE;
+
+CREATE OR REPLACE FUNCTION set_completed_at() RETURNS trigger AS $$
+BEGIN
+    IF NOT COALESCE(NEW.is_completed, FALSE) THEN
+        NEW.completed_at := NULL;
+    ELSIF TG_OP = 'INSERT' THEN
+        -- Restored rows bring the time they were completed with them
+        NEW.completed_at := COALESCE(NEW.completed_at, NOW());
+    ELSIF NOT COALESCE(OLD.is_completed, FALSE) THEN
+        NEW.completed_at := NOW();
+    END IF;
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS daily_goals_completed_at_trigger ON daily_goals;
+CREATE TRIGGER daily_goals_completed_at_trigger
+    BEFORE INSERT OR UPDATE OF is_completed ON daily_goals
+    FOR EACH ROW EXECUTE FUNCTION set_completed_at();
+
+DROP TRIGGER IF EXISTS study_sessions_completed_at_trigger ON study_sessions;
+CREATE TRIGGER study_sessions_completed_at_trigger
+    BEFORE INSERT OR UPDATE OF is_completed ON study_sessions
+    FOR EACH ROW EXECUTE FUNCTION set_completed_at();
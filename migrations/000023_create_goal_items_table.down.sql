@@ -0,0 +1,2 @@
+-- Filename: migrations/000023_create_goal_items_table.down.sql
+DROP TABLE IF EXISTS goal_items;
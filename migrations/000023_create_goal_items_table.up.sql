@@ -0,0 +1,12 @@
+-- Filename: migrations/000023_create_goal_items_table.up.sql
+-- Checklist items of a goal, shown in position order
+CREATE TABLE IF NOT EXISTS goal_items (
+item_id bigserial PRIMARY KEY,
+goal_id bigint NOT NULL REFERENCES daily_goals (goal_id) ON DELETE CASCADE,
+item_text varchar NOT NULL,
+is_done boolean NOT NULL DEFAULT FALSE,
+position integer NOT NULL,
+created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS goal_items_goal_id_position_idx ON goal_items (goal_id, position);
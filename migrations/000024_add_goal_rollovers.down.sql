@@ -0,0 +1,8 @@
+-- Filename: migrations/000024_add_goal_rollovers.down.sql
+DROP INDEX IF EXISTS daily_goals_unfinished_idx;
+DROP TABLE IF EXISTS goal_rollovers;
+
+ALTER TABLE daily_goals DROP COLUMN IF EXISTS missed_at;
+
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_goal_rollover_check;
+ALTER TABLE users DROP COLUMN IF EXISTS goal_rollover;
@@ -0,0 +1,24 @@
+-- Filename: migrations/000024_add_goal_rollovers.up.sql
+-- What happens to a goal left unfinished past its target date: rolled forward to the
+-- next day, or marked missed
+ALTER TABLE users ADD COLUMN IF NOT EXISTS goal_rollover text NOT NULL DEFAULT 'roll';
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_goal_rollover_check;
+ALTER TABLE users ADD CONSTRAINT users_goal_rollover_check CHECK (goal_rollover IN ('roll', 'miss'));
+
+ALTER TABLE daily_goals ADD COLUMN IF NOT EXISTS missed_at timestamp(0) WITH TIME ZONE;
+
+-- Every time a goal was rolled forward or marked missed. Missed goals have no new date.
+CREATE TABLE IF NOT EXISTS goal_rollovers (
+rollover_id bigserial PRIMARY KEY,
+goal_id bigint NOT NULL REFERENCES daily_goals (goal_id) ON DELETE CASCADE,
+action text NOT NULL CHECK (action IN ('rolled', 'missed')),
+from_date date NOT NULL,
+to_date date,
+created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS goal_rollovers_goal_id_idx ON goal_rollovers (goal_id);
+
+-- The scheduler looks for unfinished goals that are past due
+CREATE INDEX IF NOT EXISTS daily_goals_unfinished_idx ON daily_goals (target_date)
+    WHERE NOT COALESCE(is_completed, FALSE) AND missed_at IS NULL;
@@ -0,0 +1,11 @@
+-- Filename: migrations/000025_add_goal_priorities_categories_status.down.sql
+DROP INDEX IF EXISTS daily_goals_unfinished_idx;
+CREATE INDEX IF NOT EXISTS daily_goals_unfinished_idx ON daily_goals (target_date)
+    WHERE NOT COALESCE(is_completed, FALSE) AND missed_at IS NULL;
+
+ALTER TABLE daily_goals DROP CONSTRAINT IF EXISTS daily_goals_status_check;
+ALTER TABLE daily_goals DROP CONSTRAINT IF EXISTS daily_goals_priority_check;
+
+ALTER TABLE daily_goals DROP COLUMN IF EXISTS status;
+ALTER TABLE daily_goals DROP COLUMN IF EXISTS category;
+ALTER TABLE daily_goals DROP COLUMN IF EXISTS priority;
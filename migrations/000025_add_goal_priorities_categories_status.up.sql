@@ -0,0 +1,23 @@
+-- Filename: migrations/000025_add_goal_priorities_categories_status.up.sql
+-- Goals get a priority, an optional category and a status for the board. is_completed and
+-- missed_at are kept in step with the status, done and missed.
+ALTER TABLE daily_goals ADD COLUMN IF NOT EXISTS priority text NOT NULL DEFAULT 'medium';
+ALTER TABLE daily_goals ADD COLUMN IF NOT EXISTS category text NOT NULL DEFAULT '';
+ALTER TABLE daily_goals ADD COLUMN IF NOT EXISTS status text NOT NULL DEFAULT 'todo';
+
+UPDATE daily_goals
+SET status = CASE
+    WHEN COALESCE(is_completed, FALSE) THEN 'done'
+    WHEN missed_at IS NOT NULL THEN 'missed'
+    ELSE 'todo'
+END;
+
+ALTER TABLE daily_goals DROP CONSTRAINT IF EXISTS daily_goals_priority_check;
+ALTER TABLE daily_goals ADD CONSTRAINT daily_goals_priority_check CHECK (priority IN ('low', 'medium', 'high', 'urgent'));
+ALTER TABLE daily_goals DROP CONSTRAINT IF EXISTS daily_goals_status_check;
+ALTER TABLE daily_goals ADD CONSTRAINT daily_goals_status_check CHECK (status IN ('todo', 'in_progress', 'done', 'missed'));
+
+-- The scheduler now looks for goals that are still to do or in progress
+DROP INDEX IF EXISTS daily_goals_unfinished_idx;
+CREATE INDEX IF NOT EXISTS daily_goals_unfinished_idx ON daily_goals (target_date)
+    WHERE status IN ('todo', 'in_progress');
@@ -0,0 +1,3 @@
+-- Filename: migrations/000026_make_is_completed_not_null.down.sql
+ALTER TABLE study_sessions ALTER COLUMN is_completed DROP NOT NULL;
+ALTER TABLE daily_goals ALTER COLUMN is_completed DROP NOT NULL;
@@ -0,0 +1,8 @@
+-- Filename: migrations/000026_make_is_completed_not_null.up.sql
+-- Goals and sessions saved without a completed flag were never completed. Lists page on the
+-- flag, and a NULL would never compare past a cursor.
+UPDATE daily_goals SET is_completed = FALSE WHERE is_completed IS NULL;
+ALTER TABLE daily_goals ALTER COLUMN is_completed SET NOT NULL;
+
+UPDATE study_sessions SET is_completed = FALSE WHERE is_completed IS NULL;
+ALTER TABLE study_sessions ALTER COLUMN is_completed SET NOT NULL;
@@ -0,0 +1,4 @@
+-- Filename: migrations/000027_repair_goal_unfinished_index.down.sql
+DROP INDEX IF EXISTS daily_goals_unfinished_idx;
+CREATE INDEX IF NOT EXISTS daily_goals_unfinished_idx ON daily_goals (target_date)
+    WHERE status IN ('todo', 'in_progress');
@@ -0,0 +1,6 @@
+-- Filename: migrations/000027_repair_goal_unfinished_index.up.sql
+-- The scheduler looks for goals that are neither completed nor missed, which is kept in
+-- step with the status. The index is rebuilt on that predicate so the query can use it.
+DROP INDEX IF EXISTS daily_goals_unfinished_idx;
+CREATE INDEX IF NOT EXISTS daily_goals_unfinished_idx ON daily_goals (target_date)
+    WHERE NOT COALESCE(is_completed, FALSE) AND missed_at IS NULL;
@@ -0,0 +1,7 @@
+-- Filename: migrations/000028_time_session_occurrences.down.sql
+-- Occurrences stopped on their own stay completed on their exceptions, their series stays open
+DROP INDEX IF EXISTS session_intervals_session_id_occurrence_date_idx;
+CREATE INDEX IF NOT EXISTS session_intervals_session_id_idx ON session_intervals (session_id);
+
+ALTER TABLE session_exceptions DROP COLUMN IF EXISTS stopped_at;
+ALTER TABLE session_intervals DROP COLUMN IF EXISTS occurrence_date;
@@ -0,0 +1,37 @@
+-- Filename: migrations/000028_time_session_occurrences.up.sql
+-- Each occurrence of a recurring session is studied on its own, so the timer and completion
+-- belong to the occurrence. Intervals name the occurrence they timed, NULL for a one-off
+-- session, and an occurrence is stopped and completed on its exception.
+ALTER TABLE session_intervals ADD COLUMN IF NOT EXISTS occurrence_date DATE;
+ALTER TABLE session_exceptions ADD COLUMN IF NOT EXISTS stopped_at timestamp(0) WITH TIME ZONE;
+
+DROP INDEX IF EXISTS session_intervals_session_id_idx;
+CREATE INDEX IF NOT EXISTS session_intervals_session_id_occurrence_date_idx ON session_intervals (session_id, occurrence_date);
+
+-- Intervals already logged on a series are put on the day they started
+UPDATE session_intervals i
+SET occurrence_date = (i.started_at AT TIME ZONE 'UTC')::date
+FROM study_sessions s
+WHERE s.session_id = i.session_id AND s.rrule <> '';
+
+-- A stopped series completed the occurrence it was last timed on, and no other
+INSERT INTO session_exceptions (session_id, occurrence_date, is_completed, stopped_at)
+SELECT s.session_id,
+    COALESCE((SELECT MAX(i.occurrence_date) FROM session_intervals i WHERE i.session_id = s.session_id),
+             (s.stopped_at AT TIME ZONE 'UTC')::date),
+    TRUE, s.stopped_at
+FROM study_sessions s
+WHERE s.rrule <> '' AND s.stopped_at IS NOT NULL
+ON CONFLICT (session_id, occurrence_date) DO UPDATE
+SET is_completed = TRUE, stopped_at = EXCLUDED.stopped_at;
+
+-- Occurrences that were timed get an exception too, which is where their minutes are listed from
+INSERT INTO session_exceptions (session_id, occurrence_date)
+SELECT DISTINCT session_id, occurrence_date
+FROM session_intervals
+WHERE occurrence_date IS NOT NULL
+ON CONFLICT (session_id, occurrence_date) DO NOTHING;
+
+UPDATE study_sessions
+SET stopped_at = NULL, is_completed = FALSE
+WHERE rrule <> '' AND (stopped_at IS NOT NULL OR is_completed);
@@ -0,0 +1,9 @@
+// Package migrations embeds the SQL migrations, so the server binary can apply them itself
+package migrations
+
+import "embed"
+
+// FS holds the NNNNNN_name.up.sql and NNNNNN_name.down.sql files
+//
+//go:embed *.sql
+var FS embed.FS